@@ -51,7 +51,8 @@ const (
 	Dev                   = iota + 1
 	Prod
 
-	noccToken = "CLOSED-CAPTIONS=NONE"
+	noccToken   = "CLOSED-CAPTIONS=NONE"
+	ccAttribute = "CLOSED-CAPTIONS="
 )
 
 var (
@@ -236,10 +237,8 @@ func (c Client) PlayFragment(lbryURL, sdHash, fragmentName string, w http.Respon
 		TranscodedCacheMiss.Inc()
 	}
 
-	if strings.HasSuffix(fragmentName, storage.PlaylistExt) {
-		w.Header().Set(ctypeHeaderName, storage.PlaylistContentType)
-	} else if strings.HasSuffix(fragmentName, storage.FragmentExt) {
-		w.Header().Set(ctypeHeaderName, storage.FragmentContentType)
+	if ctype := storage.ContentType(fragmentName); ctype != "" {
+		w.Header().Set(ctypeHeaderName, ctype)
 	}
 
 	w.Header().Set(cacheControlHeaderName, fmt.Sprintf("public, max-age=%v", clientCacheDuration))
@@ -402,7 +401,7 @@ func (c Client) fetchFragment(url, sdHash, name string) (int64, error) {
 		scanner := bufio.NewScanner(r.Body)
 		for scanner.Scan() {
 			s := scanner.Text()
-			if strings.HasPrefix(s, "#EXT-X-STREAM-INF") && !strings.Contains(s, noccToken) {
+			if strings.HasPrefix(s, "#EXT-X-STREAM-INF") && !strings.Contains(s, ccAttribute) {
 				s = fmt.Sprintf("%s,%s", s, noccToken)
 			}
 			b = append(b, s)
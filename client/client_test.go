@@ -16,6 +16,7 @@ import (
 
 	"github.com/karrick/godirwalk"
 	"github.com/lbryio/transcoder/db"
+	"github.com/lbryio/transcoder/ladder"
 	"github.com/lbryio/transcoder/manager"
 	"github.com/lbryio/transcoder/storage"
 	"github.com/lbryio/transcoder/video"
@@ -65,7 +66,7 @@ func (s *clientSuite) SetupSuite() {
 
 	mgr := manager.NewManager(lib, 0)
 
-	workers.SpawnEncoderWorkers(1, mgr)
+	workers.SpawnEncoderWorkers(1, mgr, ladder.NewRegistry())
 	s.httpAPI = manager.NewHttpAPI(
 		manager.ConfigureHttpAPI().
 			Debug(true).
@@ -0,0 +1,336 @@
+package encoder
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lbryio/transcoder/ladder"
+
+	ffmpegt "github.com/floostack/transcoder"
+	"github.com/pkg/errors"
+)
+
+const (
+	chunksDir     = ".chunks"
+	chunkName     = "chunk_%05d.mkv"
+	chunkListName = "chunks.csv"
+	chunkAudio    = "audio.mkv"
+	playlistExt   = ".m3u8"
+)
+
+// ChunkedConfig defines how long videos are split into chunks at keyframes, encoded in parallel
+// and stitched back into continuous HLS playlists.
+type ChunkedConfig struct {
+	// MinDuration is the shortest input chunked encoding is used for, zero disables chunked encoding.
+	MinDuration time.Duration
+	// ChunkDuration is the target chunk length, chunks are cut at the first keyframe after it.
+	ChunkDuration time.Duration
+	// Parallel is the number of chunks encoded at the same time.
+	Parallel int
+}
+
+// chunk is a piece of the input cut at keyframes, `start` and `end` are its boundaries in the input, in seconds.
+type chunk struct {
+	file, dir  string
+	start, end float64
+}
+
+// chunkable is true if the input should be encoded in chunks.
+// Only single-pass HLS ladders segmented into MPEG-TS are supported, as every chunk of an fMP4 ladder
+// would come with its own init segments.
+func (e encoder) chunkable(l ladder.Ladder, meta *ladder.Metadata, duration float64) bool {
+	cfg := e.chunked
+	return cfg.MinDuration > 0 && cfg.ChunkDuration > 0 && cfg.Parallel > 1 &&
+		duration >= cfg.MinDuration.Seconds() &&
+		meta.HasVideo() &&
+		l.StreamType() == ladder.TypeHLS &&
+		!l.FragmentedMP4() &&
+		!l.TwoPass()
+}
+
+// encodeChunked splits the input into chunks, encodes them in parallel with `args` and stitches the results
+// into `output`. Progress of all chunks is reported as a whole through the returned process.
+// Audio is encoded once for the whole input beforehand and copied into chunks, as encoding it chunk by chunk
+// would leave encoder priming gaps at every chunk boundary.
+func (e encoder) encodeChunked(ctx context.Context, input, output string, args *ladder.ArgumentSet, duration float64) (*ffmpegProcess, error) {
+	workDir := path.Join(output, chunksDir)
+	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	chunkArgs := *args
+	var audio string
+	if args.Meta.HasAudio() {
+		audio = path.Join(workDir, chunkAudio)
+		if err := e.encodeAudio(ctx, input, audio, args); err != nil {
+			os.RemoveAll(workDir)
+			return nil, err
+		}
+		chunkArgs.PreencodedAudio = true
+	}
+	chunks, err := e.splitChunks(ctx, input, audio, workDir)
+	if err != nil {
+		os.RemoveAll(workDir)
+		return nil, err
+	}
+	e.log.Info("input split into chunks", "chunks", len(chunks), "parallel", e.chunked.Parallel)
+
+	proc := &ffmpegProcess{progress: make(chan ffmpegt.Progress)}
+	go func() {
+		defer close(proc.progress)
+		defer os.RemoveAll(workDir)
+		proc.err = e.encodeChunks(ctx, chunks, &chunkArgs, duration, proc.progress)
+		if proc.err == nil {
+			proc.err = stitchChunks(output, chunks)
+		}
+	}()
+	return proc, nil
+}
+
+// encodeAudio encodes all output audio streams of the ladder over the whole input into `output`.
+func (e encoder) encodeAudio(ctx context.Context, input, output string, args *ladder.ArgumentSet) error {
+	cmdArgs := append([]string{"-y", "-v", "error", "-i", input}, args.AudioArguments()...)
+	cmd := exec.CommandContext(ctx, e.ffmpegPath, append(cmdArgs, output)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return ErrCancelled
+		}
+		return fmt.Errorf("cannot encode audio: %w", newFFmpegError(err, out))
+	}
+	return nil
+}
+
+// splitChunks cuts the input video at keyframes into chunks of about ChunkDuration. Audio streams are taken
+// from `audio`, which has them already encoded, and copied along with video. Empty `audio` means no audio.
+func (e encoder) splitChunks(ctx context.Context, input, audio, workDir string) ([]chunk, error) {
+	args := []string{"-y", "-v", "error", "-i", input}
+	maps := []string{"-map", "0:v:0"}
+	if audio != "" {
+		args = append(args, "-i", audio)
+		maps = append(maps, "-map", "1:a")
+	}
+	args = append(args, maps...)
+	args = append(args,
+		"-c", "copy",
+		"-f", "segment",
+		"-segment_time", strconv.FormatFloat(e.chunked.ChunkDuration.Seconds(), 'f', 3, 64),
+		"-reset_timestamps", "1",
+		"-segment_list", path.Join(workDir, chunkListName),
+		"-segment_list_type", "csv",
+		path.Join(workDir, chunkName),
+	)
+	cmd := exec.CommandContext(ctx, e.ffmpegPath, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ErrCancelled
+		}
+		return nil, fmt.Errorf("cannot split input into chunks: %w", newFFmpegError(err, out))
+	}
+	return readChunkList(workDir)
+}
+
+// readChunkList reads chunk list written by ffmpeg segment muxer, which has a `name,start,end` line for every chunk.
+func readChunkList(workDir string) ([]chunk, error) {
+	f, err := os.Open(path.Join(workDir, chunkListName))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read chunk list")
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse chunk list")
+	}
+	chunks := []chunk{}
+	for n, r := range records {
+		if len(r) != 3 {
+			return nil, fmt.Errorf("malformed chunk list line: %v", r)
+		}
+		c := chunk{file: path.Join(workDir, r[0]), dir: path.Join(workDir, fmt.Sprintf("out_%05d", n))}
+		if c.start, err = strconv.ParseFloat(r[1], 64); err != nil {
+			return nil, errors.Wrapf(err, "malformed chunk start: %v", r[1])
+		}
+		if c.end, err = strconv.ParseFloat(r[2], 64); err != nil {
+			return nil, errors.Wrapf(err, "malformed chunk end: %v", r[2])
+		}
+		chunks = append(chunks, c)
+	}
+	if len(chunks) == 0 {
+		return nil, errors.New("input produced no chunks")
+	}
+	return chunks, nil
+}
+
+// encodeChunks runs up to ChunkedConfig.Parallel chunk encodes at once. Timestamps of every chunk are shifted
+// to its position in the input so stitched segments play continuously. The first chunk failure stops the rest.
+func (e encoder) encodeChunks(ctx context.Context, chunks []chunk, args *ladder.ArgumentSet, duration float64, progress chan<- ffmpegt.Progress) error {
+	type report struct {
+		n int
+		p ffmpegt.Progress
+	}
+	chunkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ladderArgs := args.GetStrArguments()
+	reports := make(chan report)
+	errs := make(chan error, len(chunks))
+	sem := make(chan struct{}, e.chunked.Parallel)
+	wg := sync.WaitGroup{}
+	for n := range chunks {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if chunkCtx.Err() != nil {
+				return
+			}
+			c := chunks[n]
+			if err := os.MkdirAll(c.dir, os.ModePerm); err != nil {
+				errs <- err
+				cancel()
+				return
+			}
+			cmdArgs := append([]string{"-i", c.file}, ladderArgs...)
+			cmdArgs = append(cmdArgs, "-output_ts_offset", strconv.FormatFloat(c.start, 'f', 6, 64), args.OutputName())
+			proc, err := e.startFFmpeg(chunkCtx, c.dir, cmdArgs, c.end-c.start)
+			if err != nil {
+				errs <- err
+				cancel()
+				return
+			}
+			for p := range proc.progress {
+				reports <- report{n, p}
+			}
+			if err := proc.Err(); err != nil && err != ErrCancelled {
+				errs <- errors.Wrapf(err, "chunk #%v encoding failed", n)
+				cancel()
+			}
+		}(n)
+	}
+	go func() {
+		wg.Wait()
+		close(reports)
+	}()
+
+	latest := make([]ffmpegt.Progress, len(chunks))
+	for r := range reports {
+		latest[r.n] = r.p
+		progress <- chunksProgress(chunks, latest, duration)
+	}
+	close(errs)
+
+	if ctx.Err() != nil {
+		return ErrCancelled
+	}
+	return <-errs
+}
+
+// chunksProgress sums up progress of individual chunks.
+func chunksProgress(chunks []chunk, latest []ffmpegt.Progress, duration float64) ffmpegProgress {
+	var done, speed float64
+	var frames int
+	for n, p := range latest {
+		if p == nil {
+			continue
+		}
+		pct := math.Min(p.GetProgress(), 100)
+		done += (chunks[n].end - chunks[n].start) * pct / 100
+		if pct < 100 {
+			speed += parseSpeed(p.GetSpeed())
+		}
+		f, _ := strconv.Atoi(p.GetFramesProcessed())
+		frames += f
+	}
+	cp := ffmpegProgress{frames: strconv.Itoa(frames), speed: fmt.Sprintf("%.3fx", speed)}
+	if duration > 0 {
+		cp.progress = done / duration * 100
+	}
+	return cp
+}
+
+// stitchChunks joins media playlists of encoded chunks into continuous playlists in `output`, moving and
+// renumbering their segments. Master playlist of the first chunk is used as is.
+func stitchChunks(output string, chunks []chunk) error {
+	entries, err := os.ReadDir(chunks[0].dir)
+	if err != nil {
+		return err
+	}
+	playlists := []string{}
+	for _, e := range entries {
+		if path.Ext(e.Name()) == playlistExt && e.Name() != MasterPlaylist {
+			playlists = append(playlists, e.Name())
+		}
+	}
+	sort.Strings(playlists)
+	for _, name := range playlists {
+		if err := stitchPlaylist(output, name, chunks); err != nil {
+			return errors.Wrapf(err, "cannot stitch %v", name)
+		}
+	}
+	return os.Rename(path.Join(chunks[0].dir, MasterPlaylist), path.Join(output, MasterPlaylist))
+}
+
+func stitchPlaylist(output, name string, chunks []chunk) error {
+	base := strings.TrimSuffix(name, playlistExt)
+	header, body := []string{}, []string{}
+	var targetDuration, seq int
+	for n, c := range chunks {
+		f, err := os.Open(path.Join(c.dir, name))
+		if err != nil {
+			return err
+		}
+		inHeader := true
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			l := strings.TrimSpace(scanner.Text())
+			switch {
+			case l == "", l == "#EXT-X-ENDLIST", strings.HasPrefix(l, "#EXT-X-MEDIA-SEQUENCE:"):
+			case strings.HasPrefix(l, "#EXT-X-TARGETDURATION:"):
+				d, _ := strconv.Atoi(strings.TrimPrefix(l, "#EXT-X-TARGETDURATION:"))
+				if d > targetDuration {
+					targetDuration = d
+				}
+			case strings.HasPrefix(l, "#EXTINF:"):
+				inHeader = false
+				body = append(body, l)
+			case strings.HasPrefix(l, "#"):
+				if !inHeader {
+					body = append(body, l)
+				} else if n == 0 {
+					header = append(header, l)
+				}
+			default:
+				segment := fmt.Sprintf("%v_s%06d%v", base, seq, path.Ext(l))
+				seq++
+				if err := os.Rename(path.Join(c.dir, l), path.Join(output, segment)); err != nil {
+					f.Close()
+					return err
+				}
+				body = append(body, segment)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	lines := append(header,
+		"#EXT-X-TARGETDURATION:"+strconv.Itoa(targetDuration),
+		"#EXT-X-MEDIA-SEQUENCE:0",
+	)
+	lines = append(lines, body...)
+	lines = append(lines, "#EXT-X-ENDLIST", "")
+	return os.WriteFile(path.Join(output, name), []byte(strings.Join(lines, "\n")), os.ModePerm)
+}
@@ -0,0 +1,128 @@
+package encoder
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/lbryio/transcoder/pkg/logging"
+
+	ffmpegt "github.com/floostack/transcoder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadChunkList(t *testing.T) {
+	dir := t.TempDir()
+	list := "chunk_00000.mkv,0.000000,300.300000\nchunk_00001.mkv,300.300000,600.600000\nchunk_00002.mkv,600.600000,650.000000\n"
+	require.NoError(t, os.WriteFile(path.Join(dir, chunkListName), []byte(list), os.ModePerm))
+
+	chunks, err := readChunkList(dir)
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, path.Join(dir, "chunk_00001.mkv"), chunks[1].file)
+	assert.Equal(t, path.Join(dir, "out_00001"), chunks[1].dir)
+	assert.EqualValues(t, 300.3, chunks[1].start)
+	assert.EqualValues(t, 600.6, chunks[1].end)
+
+	require.NoError(t, os.WriteFile(path.Join(dir, chunkListName), []byte("chunk_00000.mkv,zero,1\n"), os.ModePerm))
+	_, err = readChunkList(dir)
+	assert.Error(t, err)
+}
+
+func TestStitchChunks(t *testing.T) {
+	output := t.TempDir()
+	chunks := []chunk{}
+	for n, segments := range [][]string{{"10.000000", "10.000000", "4.500000"}, {"10.000000", "2.100000"}} {
+		c := chunk{dir: path.Join(output, chunksDir, fmt.Sprintf("out_%05d", n))}
+		require.NoError(t, os.MkdirAll(c.dir, os.ModePerm))
+		require.NoError(t, os.WriteFile(path.Join(c.dir, MasterPlaylist), []byte(fmt.Sprintf("#EXTM3U\n# chunk %v\n", n)), os.ModePerm))
+		for v := 0; v < 2; v++ {
+			pl := fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-TARGETDURATION:%v\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-INDEPENDENT-SEGMENTS\n", 10+n)
+			for i, d := range segments {
+				seg := fmt.Sprintf("v%v_s%06d.ts", v, i)
+				pl += fmt.Sprintf("#EXTINF:%v,\n%v\n", d, seg)
+				require.NoError(t, os.WriteFile(path.Join(c.dir, seg), []byte(fmt.Sprintf("%v/%v", n, seg)), os.ModePerm))
+			}
+			pl += "#EXT-X-ENDLIST\n"
+			require.NoError(t, os.WriteFile(path.Join(c.dir, fmt.Sprintf("v%v.m3u8", v)), []byte(pl), os.ModePerm))
+		}
+		chunks = append(chunks, c)
+	}
+
+	require.NoError(t, stitchChunks(output, chunks))
+
+	master, err := os.ReadFile(path.Join(output, MasterPlaylist))
+	require.NoError(t, err)
+	assert.Equal(t, "#EXTM3U\n# chunk 0\n", string(master))
+
+	pl, err := os.ReadFile(path.Join(output, "v1.m3u8"))
+	require.NoError(t, err)
+	assert.Equal(t, `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-TARGETDURATION:11
+#EXT-X-MEDIA-SEQUENCE:0
+#EXTINF:10.000000,
+v1_s000000.ts
+#EXTINF:10.000000,
+v1_s000001.ts
+#EXTINF:4.500000,
+v1_s000002.ts
+#EXTINF:10.000000,
+v1_s000003.ts
+#EXTINF:2.100000,
+v1_s000004.ts
+#EXT-X-ENDLIST
+`, string(pl))
+
+	seg, err := os.ReadFile(path.Join(output, "v1_s000003.ts"))
+	require.NoError(t, err)
+	assert.Equal(t, "1/v1_s000000.ts", string(seg))
+	_, err = os.Stat(path.Join(output, "v0_s000004.ts"))
+	assert.NoError(t, err)
+}
+
+func TestChunksProgress(t *testing.T) {
+	chunks := []chunk{{start: 0, end: 60}, {start: 60, end: 120}, {start: 120, end: 150}}
+	latest := []ffmpegt.Progress{
+		ffmpegProgress{frames: "1500", speed: "3x", progress: 100},
+		ffmpegProgress{frames: "750", speed: "2.5x", progress: 50},
+		nil,
+	}
+	p := chunksProgress(chunks, latest, 150)
+	assert.EqualValues(t, 60, p.GetProgress())
+	assert.Equal(t, "2250", p.GetFramesProcessed())
+	assert.Equal(t, "2.500x", p.GetSpeed())
+}
+
+func TestChunkable(t *testing.T) {
+	e := encoder{&Configuration{
+		chunked: ChunkedConfig{MinDuration: 10 * time.Minute, ChunkDuration: 5 * time.Minute, Parallel: 4},
+		log:     logging.NoopKVLogger{},
+	}}
+	meta, err := ladder.WrapProbe(remuxProbe(1920, 1080, 4000_000, "High", "yuv420p"))
+	require.NoError(t, err)
+
+	assert.True(t, e.chunkable(ladder.Default, meta, 3600))
+	assert.False(t, e.chunkable(ladder.Default, meta, 300))
+
+	// HLS ladder with an HEVC tier is segmented into fMP4 and has init segments for every chunk.
+	hevc := ladder.Default
+	hevc.Tiers = append([]ladder.Tier{}, ladder.Default.Tiers...)
+	hevc.Tiers[0].Codec = ladder.CodecHEVC
+	require.Equal(t, ladder.TypeHLS, hevc.StreamType())
+	assert.False(t, e.chunkable(hevc, meta, 3600))
+
+	av1 := ladder.Default
+	av1.Codec = ladder.CodecAV1
+	assert.False(t, e.chunkable(av1, meta, 3600))
+
+	dash := ladder.Default
+	dash.Format = ladder.TypeDASH
+	assert.False(t, e.chunkable(dash, meta, 3600))
+}
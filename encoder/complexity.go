@@ -0,0 +1,95 @@
+package encoder
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/pkg/errors"
+)
+
+const (
+	complexitySamples      = 3
+	complexitySampleLength = 4.0 // seconds
+	// complexityProbeCRF is the quality level at which an average video is expected to require
+	// the bitrate of the top ladder tier.
+	complexityProbeCRF    = "23"
+	complexityProbePreset = "veryfast"
+)
+
+// measureComplexity encodes a few short samples spread across the input video at constant quality
+// and the resolution of the top ladder tier. The ratio of the resulting bitrate to the tier bitrate
+// is what ladder.Ladder.Adapt takes as content complexity.
+func (e encoder) measureComplexity(ctx context.Context, input string, meta *ladder.Metadata, l ladder.Ladder) (float64, error) {
+	if len(l.Tiers) == 0 {
+		return 0, errors.New("ladder has no tiers")
+	}
+	top := l.Tiers[0]
+	if top.VideoBitrate == 0 {
+		return 0, errors.New("top tier has no bitrate")
+	}
+
+	dur, err := strconv.ParseFloat(meta.FMeta.GetFormat().GetDuration(), 64)
+	if err != nil || dur <= 0 {
+		return 0, fmt.Errorf("cannot determine media duration: %v", meta.FMeta.GetFormat().GetDuration())
+	}
+
+	samples := complexitySamples
+	length := complexitySampleLength
+	if dur < complexitySampleLength*complexitySamples {
+		samples = 1
+		length = math.Min(dur, complexitySampleLength*complexitySamples)
+	}
+
+	var totalBits, totalLength float64
+	for i := 0; i < samples; i++ {
+		start := (dur - length) * float64(i+1) / float64(samples+1)
+		if samples == 1 {
+			start = 0
+		}
+		size, err := e.encodeSample(ctx, input, start, length, top.Height)
+		if err != nil {
+			return 0, errors.Wrapf(err, "cannot encode sample at %.2fs", start)
+		}
+		totalBits += float64(size * 8)
+		totalLength += length
+	}
+
+	complexity := totalBits / totalLength / float64(top.VideoBitrate)
+	e.log.Debug("content complexity measured", "complexity", complexity, "samples", samples, "input", input)
+	return complexity, nil
+}
+
+// encodeSample encodes a video-only fragment of the input and returns its size in bytes.
+func (e encoder) encodeSample(ctx context.Context, input string, start, length float64, height int) (int64, error) {
+	f, err := os.CreateTemp("", "complexity_sample*.ts")
+	if err != nil {
+		return 0, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	cmd := exec.CommandContext(ctx, e.ffmpegPath,
+		"-y", "-v", "error",
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+		"-i", input,
+		"-t", strconv.FormatFloat(length, 'f', 3, 64),
+		"-an", "-sn",
+		"-vf", "scale=-2:"+strconv.Itoa(height),
+		"-c:v", ladder.CodecH264, "-preset", complexityProbePreset, "-crf", complexityProbeCRF,
+		"-f", "mpegts", f.Name(),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("%w: %s", err, out)
+	}
+
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
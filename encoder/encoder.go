@@ -1,12 +1,12 @@
 package encoder
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -14,36 +14,50 @@ import (
 	"github.com/lbryio/transcoder/ladder"
 	"github.com/lbryio/transcoder/pkg/logging"
 
-	ffmpegt "github.com/floostack/transcoder"
-	"github.com/floostack/transcoder/ffmpeg"
 	"github.com/pkg/errors"
 )
 
 const MasterPlaylist = "master.m3u8"
 
 type Encoder interface {
-	Encode(in, out string) (*Result, error)
+	Encode(ctx context.Context, in, out string) (*Result, error)
+	EncodeWithLadder(ctx context.Context, in, out string, l ladder.Ladder) (*Result, error)
 	GetMetadata(input string) (*ladder.Metadata, error)
+	Preflight(input string) (*ladder.Metadata, *PreflightReport, error)
 }
 
 type Configuration struct {
-	ffmpegPath, ffprobePath,
-	thumbnailGeneratorPath string
-
-	ladder ladder.Ladder
-	log    logging.KVLogger
+	ffmpegPath, ffprobePath string
+
+	ladder            ladder.Ladder
+	thumbnails        ThumbnailsConfig
+	preview           PreviewConfig
+	chunked           ChunkedConfig
+	limits            PreflightLimits
+	remux             RemuxConfig
+	analyzeComplexity bool
+	log               logging.KVLogger
 }
 
 type encoder struct {
 	*Configuration
-	tg *ThumbnailGenerator
 }
 
 type Result struct {
 	Input, Output string
 	OrigMeta      *ladder.Metadata
+	Preflight     *PreflightReport
 	Ladder        ladder.Ladder
-	Progress      <-chan ffmpegt.Progress
+	// Complexity is measured content complexity, zero when analysis is disabled or has failed.
+	Complexity  float64
+	AudioTracks []ladder.AudioTrack
+	Subtitles   []ladder.SubtitleTrack
+	Thumbnails  []string
+	// Poster and Preview are names of poster image and animated preview files, empty if extraction failed.
+	Poster, Preview string
+	Progress        <-chan Progress
+
+	err error
 }
 
 // Configure will attempt to lookup paths to ffmpeg and ffprobe.
@@ -51,14 +65,15 @@ type Result struct {
 func Configure() *Configuration {
 	ffmpegPath, _ := exec.LookPath("ffmpeg")
 	ffprobePath, _ := exec.LookPath("ffprobe")
-	tgPath, _ := exec.LookPath("generator")
 
 	return &Configuration{
-		ffmpegPath:             ffmpegPath,
-		ffprobePath:            ffprobePath,
-		thumbnailGeneratorPath: tgPath,
-		ladder:                 ladder.Default,
-		log:                    logging.NoopKVLogger{},
+		ffmpegPath:  ffmpegPath,
+		ffprobePath: ffprobePath,
+		ladder:      ladder.Default,
+		thumbnails:  DefaultThumbnailsConfig,
+		preview:     DefaultPreviewConfig,
+		limits:      DefaultPreflightLimits,
+		log:         logging.NoopKVLogger{},
 	}
 }
 
@@ -86,14 +101,7 @@ func NewEncoder(cfg *Configuration) (Encoder, error) {
 
 	e := encoder{Configuration: cfg}
 
-	tg, err := NewThumbnailGenerator(e.thumbnailGeneratorPath)
-	if err != nil {
-		e.log.Info("thumbnail generator was not configured", "err", err)
-	} else {
-		e.tg = tg
-	}
-
-	e.log.Info("encoder configured", "ffmpeg", e.ffmpegPath, "ffprobe", e.ffprobePath, "generator", e.thumbnailGeneratorPath)
+	e.log.Info("encoder configured", "ffmpeg", e.ffmpegPath, "ffprobe", e.ffprobePath)
 	return &e, nil
 }
 
@@ -107,8 +115,10 @@ func (c *Configuration) FfprobePath(p string) *Configuration {
 	return c
 }
 
-func (c *Configuration) ThumbnailGeneratorPath(p string) *Configuration {
-	c.thumbnailGeneratorPath = p
+// Thumbnails configures seek preview sprite sheets, DefaultThumbnailsConfig is used by default.
+// Zero Interval disables thumbnails.
+func (c *Configuration) Thumbnails(cfg ThumbnailsConfig) *Configuration {
+	c.thumbnails = cfg
 	return c
 }
 
@@ -124,9 +134,64 @@ func (c *Configuration) Ladder(l ladder.Ladder) *Configuration {
 	return c
 }
 
-// Encode does transcoding of specified video file into a series of HLS streams.
-func (e encoder) Encode(input, output string) (*Result, error) {
-	meta, err := e.GetMetadata(input)
+// Preview configures poster image and animated preview extraction, DefaultPreviewConfig is used by default.
+// Zero Duration disables both.
+func (c *Configuration) Preview(cfg PreviewConfig) *Configuration {
+	c.preview = cfg
+	return c
+}
+
+// Chunked enables splitting long videos into chunks which are encoded in parallel, see ChunkedConfig.
+// Disabled by default.
+func (c *Configuration) Chunked(cfg ChunkedConfig) *Configuration {
+	c.chunked = cfg
+	return c
+}
+
+// Limits configures which inputs are accepted by preflight checks, DefaultPreflightLimits are used by default.
+func (c *Configuration) Limits(l PreflightLimits) *Configuration {
+	c.limits = l
+	return c
+}
+
+// Remux enables copying source video into the top ladder tier instead of encoding it, for sources
+// that are already compatible with it. See RemuxConfig, remuxing is disabled by default.
+func (c *Configuration) Remux(cfg RemuxConfig) *Configuration {
+	c.remux = cfg
+	return c
+}
+
+// AnalyzeComplexity enables content complexity analysis before encoding.
+// Ladder tier bitrates and their number are then adapted to the measured complexity
+// so easy to compress content gets encoded with lower bitrates.
+func (c *Configuration) AnalyzeComplexity(enabled bool) *Configuration {
+	c.analyzeComplexity = enabled
+	return c
+}
+
+// Err returns the error transcoding has ended with, ErrCancelled if it was stopped by cancelling its context.
+// It should only be called after Progress channel is closed.
+func (r *Result) Err() error {
+	return r.err
+}
+
+// Encode does transcoding of specified video file into a series of HLS or DASH streams,
+// depending on the configured ladder format.
+// Cancelling `ctx` stops ffmpeg and removes the partially transcoded output.
+func (e encoder) Encode(ctx context.Context, input, output string) (*Result, error) {
+	return e.EncodeWithLadder(ctx, input, output, e.ladder)
+}
+
+// EncodeWithLadder works like Encode but uses the supplied ladder instead of the configured one.
+func (e encoder) EncodeWithLadder(ctx context.Context, input, output string, l ladder.Ladder) (*Result, error) {
+	if len(l.Tiers) == 0 {
+		return nil, errors.New("encoding ladder has no tiers")
+	}
+	input, err := filepath.Abs(input)
+	if err != nil {
+		return nil, err
+	}
+	meta, report, err := e.Preflight(input)
 	if err != nil {
 		return nil, err
 	}
@@ -135,101 +200,175 @@ func (e encoder) Encode(input, output string) (*Result, error) {
 		return nil, err
 	}
 
-	targetLadder, err := e.ladder.Tweak(meta)
+	targetLadder, err := l.Tweak(meta)
 	if err != nil {
 		return nil, err
 	}
-	res := &Result{Input: input, Output: output, OrigMeta: meta, Ladder: targetLadder}
+	res := &Result{Input: input, Output: output, OrigMeta: meta, Preflight: report}
 
-	if e.tg != nil {
-		err := e.tg.Generate(input, path.Join(output, "thumbnails10k.png"))
+	if e.analyzeComplexity && meta.HasVideo() {
+		complexity, err := e.measureComplexity(ctx, input, meta, targetLadder)
 		if err != nil {
-			return nil, err
+			e.log.Warn("complexity analysis failed, proceeding with unadapted ladder", "input", input, "err", err)
+		} else {
+			targetLadder = targetLadder.Adapt(complexity)
+			res.Complexity = complexity
+			e.log.Info("ladder adapted to content complexity", "complexity", complexity, "tiers", len(targetLadder.Tiers))
 		}
 	}
+	if e.remux.MaxBitrateRatio > 0 && report.Decision == PreflightRemux {
+		var reason string
+		targetLadder, reason = e.passthrough(ctx, input, meta, targetLadder)
+		if reason != "" {
+			e.log.Info("source video cannot be passed through, encoding all tiers", "reason", reason)
+		} else {
+			e.log.Info("passing source video through into the top tier", "tier", targetLadder.Tiers[0].Definition)
+		}
+	}
+	res.Ladder = targetLadder
+
+	if e.thumbnails.Interval > 0 && meta.HasVideo() {
+		res.Thumbnails, err = e.generateThumbnails(ctx, input, output, meta)
+		if err != nil {
+			e.log.Warn("thumbnails generation failed, proceeding without them", "input", input, "err", err)
+		}
+	}
+
+	if e.preview.Duration > 0 && meta.HasVideo() {
+		e.extractPosterAndPreview(ctx, input, output, meta, res)
+	}
 
 	args := targetLadder.ArgumentSet(output, meta)
-	vs := meta.VideoStream
+	var passLogDir string
+	if targetLadder.TwoPass() {
+		passLogDir, err = os.MkdirTemp("", "passlog")
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create pass log directory")
+		}
+		args.PassLogDir = passLogDir
+		e.log.Info("running first pass", "input", input)
+		if err := e.runFirstPass(ctx, input, args); err != nil {
+			if ctx.Err() != nil {
+				return nil, e.cancel(output, passLogDir)
+			}
+			os.RemoveAll(passLogDir)
+			return nil, err
+		}
+	}
+	res.AudioTracks = args.AudioTracks()
+	// Subtitle renditions are only supported for outputs having HLS master playlist.
+	if targetLadder.StreamType() != ladder.TypeDASH {
+		res.Subtitles = e.subtitleTracks(input, meta)
+	}
+	var width, height int
+	if meta.HasVideo() {
+		width, height = meta.VideoStream.GetWidth(), meta.VideoStream.GetHeight()
+	}
 	e.log.Info(
 		"starting transcoding",
 		"args", strings.Join(args.GetStrArguments(), " "),
 		"media_duration", meta.FMeta.GetFormat().GetDuration(),
 		"media_bitrate", meta.FMeta.GetFormat().GetBitRate(),
-		"media_width", vs.GetWidth(),
-		"media_height", vs.GetHeight(),
+		"media_width", width,
+		"media_height", height,
+		"audio_only", !meta.HasVideo(),
+		"video_range", meta.VideoRange,
+		"ladder", targetLadder.Name,
 		"input", input, "output", output,
 	)
 
 	dur, _ := strconv.ParseFloat(meta.FMeta.GetFormat().GetDuration(), 64)
 	btr, _ := strconv.ParseFloat(meta.FMeta.GetFormat().GetBitRate(), 64)
 	metrics.EncodedDurationSeconds.Add(dur)
-	metrics.EncodedBitrateMbit.WithLabelValues(fmt.Sprintf("%v", vs.GetHeight())).Observe(btr / 1024 / 1024)
-
-	progress, err := ffmpeg.New(
-		&ffmpeg.Config{
-			FfmpegBinPath:   e.ffmpegPath,
-			FfprobeBinPath:  e.ffprobePath,
-			ProgressEnabled: true,
-			Verbose:         false, // Set this to true if ffmpeg is failing to launch to see the reason
-			OutputDir:       output,
-		}).
-		Input(input).
-		Output("v%v.m3u8").
-		Start(args)
-	if err != nil {
+	metrics.EncodedBitrateMbit.WithLabelValues(fmt.Sprintf("%v", height)).Observe(btr / 1024 / 1024)
+
+	if ctx.Err() != nil {
+		return nil, e.cancel(output, passLogDir)
+	}
+	var proc *ffmpegProcess
+	if e.chunkable(targetLadder, meta, dur) {
+		e.log.Info("encoding in chunks", "input", input, "chunk_duration", e.chunked.ChunkDuration)
+		proc, err = e.encodeChunked(ctx, input, output, args, dur)
+	} else {
+		ffmpegArgs := append([]string{"-i", input}, args.GetStrArguments()...)
+		proc, err = e.startFFmpeg(ctx, output, append(ffmpegArgs, args.OutputName()), dur)
+	}
+	if err == ErrCancelled {
+		return nil, e.cancel(output, passLogDir)
+	} else if err != nil {
+		if passLogDir != "" {
+			os.RemoveAll(passLogDir)
+		}
 		return nil, err
 	}
 
-	res.Progress = progress
+	steps := []func(string) error{}
+	if targetLadder.StreamType() != ladder.TypeDASH {
+		steps = append(steps, e.fillVariantAttributes)
+	}
+	if len(res.Subtitles) > 0 {
+		steps = append(steps, func(output string) error {
+			err := e.extractSubtitles(ctx, input, output, targetLadder.SegmentDuration(), res.Subtitles)
+			if err != nil {
+				return err
+			}
+			return addSubtitleRenditions(path.Join(output, MasterPlaylist), res.Subtitles)
+		})
+	}
+	res.Progress = e.finalize(ctx, proc, newProgressTracker(dur), res, passLogDir, steps...)
 	return res, nil
 }
 
-// getMetadata uses ffprobe to parse video file metadata.
-func (e encoder) GetMetadata(input string) (*ladder.Metadata, error) {
-	meta := &ffmpeg.Metadata{}
-
-	var outb, errb bytes.Buffer
-
-	args := []string{"-i", input, "-print_format", "json", "-show_format", "-show_streams", "-show_error"}
-
-	cmd := exec.Command(e.ffprobePath, args...)
-	cmd.Stdout = &outb
-	cmd.Stderr = &errb
+// finalize relays ffmpeg progress and runs post-processing steps on the output
+// once ffmpeg is done, before closing the returned channel.
+// Partial output is removed if transcoding gets cancelled.
+func (e encoder) finalize(ctx context.Context, proc *ffmpegProcess, tracker *progressTracker, res *Result, passLogDir string, steps ...func(string) error) <-chan Progress {
+	out := make(chan Progress)
+	go func() {
+		defer close(out)
+		for p := range proc.progress {
+			out <- tracker.track(p)
+		}
+		if passLogDir != "" {
+			os.RemoveAll(passLogDir)
+		}
+		if err := proc.Err(); err != nil {
+			if err == ErrCancelled {
+				res.err = e.cancel(res.Output, "")
+			} else {
+				res.err = err
+			}
+			return
+		}
+		for _, step := range steps {
+			if err := step(res.Output); err != nil {
+				if ctx.Err() != nil {
+					res.err = e.cancel(res.Output, "")
+					return
+				}
+				e.log.Error("output post-processing failed", "output", res.Output, "err", err)
+				res.err = errors.Wrap(err, "output post-processing failed")
+				return
+			}
+		}
+	}()
+	return out
+}
 
-	err := cmd.Run()
-	if err != nil {
-		return nil, fmt.Errorf(
-			"error executing (%s) with args (%s) | error: %s | message: %s %s",
-			e.ffprobePath, args, err, outb.String(), errb.String())
+// cancel removes partial output of a cancelled transcoding, returning ErrCancelled.
+func (e encoder) cancel(output, passLogDir string) error {
+	e.log.Info("transcoding cancelled, removing partial output", "output", output)
+	if passLogDir != "" {
+		os.RemoveAll(passLogDir)
 	}
-
-	if err = json.Unmarshal(outb.Bytes(), &meta); err != nil {
-		return nil, err
+	if err := os.RemoveAll(output); err != nil {
+		e.log.Warn("cannot remove partial output", "output", output, "err", err)
 	}
+	return ErrCancelled
+}
 
-	lm, err := ladder.WrapMeta(meta)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to wrap with ladder.Metadata")
-	}
-	lm.FastStart, err = e.checkFastStart(input)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to check for faststart")
-	}
-	return lm, nil
-}
-
-func (e encoder) checkFastStart(input string) (bool, error) {
-	cmd := exec.Command(e.ffmpegPath, "-v", "trace", "-i", input)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	cmd.Run()
-	result := strings.Fields(out.String())
-	var seenMdat bool
-	for _, l := range result {
-		if strings.Contains(l, "moov") && !seenMdat {
-			return true, nil
-		}
-	}
-	return false, nil
+// GetMetadata runs preflight checks on the input, returning its metadata. See Preflight.
+func (e encoder) GetMetadata(input string) (*ladder.Metadata, error) {
+	meta, _, err := e.Preflight(input)
+	return meta, err
 }
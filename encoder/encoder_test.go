@@ -1,6 +1,7 @@
 package encoder
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path"
@@ -62,7 +63,7 @@ func (s *encoderSuite) TestLadder() {
 	file, _, err := c.Download(s.T().TempDir())
 	s.Require().NoError(err)
 	file.Close()
-	res, err := e.Encode(file.Name(), s.out)
+	res, err := e.Encode(context.Background(), file.Name(), s.out)
 	s.Require().NoError(err)
 	s.Equal([]ladder.Tier{
 		{Definition: "360p", Width: 640, Height: 360, VideoBitrate: 500_000, AudioBitrate: "96k", Framerate: 0},
@@ -75,7 +76,7 @@ func (s *encoderSuite) TestEncode() {
 	e, err := NewEncoder(Configure().Log(zapadapter.NewKV(nil)).Ladder(ladder.Default))
 	s.Require().NoError(err)
 
-	res, err := e.Encode(absPath, s.out)
+	res, err := e.Encode(context.Background(), absPath, s.out)
 	s.Require().NoError(err)
 
 	vs := res.OrigMeta.VideoStream
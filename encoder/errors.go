@@ -0,0 +1,134 @@
+package encoder
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// FailureClass categorizes ffmpeg failures by their cause.
+type FailureClass string
+
+const (
+	FailureUnknown          FailureClass = "unknown"
+	FailureCorruptInput     FailureClass = "corrupt_input"
+	FailureUnsupportedCodec FailureClass = "unsupported_codec"
+	FailureOutOfDisk        FailureClass = "out_of_disk"
+	FailureOOM              FailureClass = "oom"
+	FailureInvalidArguments FailureClass = "invalid_arguments"
+	// FailureOutOfLimits is reported for inputs rejected by preflight checks for exceeding configured limits.
+	FailureOutOfLimits FailureClass = "out_of_limits"
+
+	// ffmpegLogTail is how many bytes of ffmpeg log are kept for failure reports.
+	ffmpegLogTail = 4096
+)
+
+// failurePatterns are matched against ffmpeg log in order, the first match determines failure class.
+var failurePatterns = []struct {
+	class FailureClass
+	re    *regexp.Regexp
+}{
+	{FailureOutOfDisk, regexp.MustCompile(`(?i)no space left on device|disk quota exceeded`)},
+	{FailureOOM, regexp.MustCompile(`(?i)cannot allocate memory|out of memory`)},
+	{FailureUnsupportedCodec, regexp.MustCompile(`(?i)decoder (\(codec [^)]*\)|\S+) not found|unknown decoder|unsupported codec|codec not currently supported|no decoder for`)},
+	{FailureInvalidArguments, regexp.MustCompile(`(?i)unrecognized option|option not found|error parsing options|unknown encoder|invalid option|error splitting the argument list|no such filter|error initializing (complex )?filters?|error (initializing|opening) output`)},
+	{FailureCorruptInput, regexp.MustCompile(`(?i)invalid data found when processing input|moov atom not found|could not find codec parameters|error while decoding|corrupt|truncat|end of file|invalid nal unit`)},
+}
+
+// Retriable is true for failures which may not happen again on another attempt, possibly on another worker.
+func (c FailureClass) Retriable() bool {
+	return c == FailureOutOfDisk || c == FailureOOM
+}
+
+// FFmpegError is returned when ffmpeg or ffprobe exits with an error.
+type FFmpegError struct {
+	Class FailureClass
+	// Log is the tail of ffmpeg log output.
+	Log string
+	err error
+}
+
+func (e *FFmpegError) Error() string {
+	msg := fmt.Sprintf("ffmpeg failed (%v): %v", e.Class, e.err)
+	if l := lastLine(e.Log); l != "" {
+		msg += ": " + l
+	}
+	return msg
+}
+
+func (e *FFmpegError) Unwrap() error {
+	return e.err
+}
+
+// FailureOf returns failure class and ffmpeg log tail for an error returned by the encoder.
+// Errors not caused by ffmpeg failures or preflight checks are FailureUnknown.
+func FailureOf(err error) (FailureClass, string) {
+	var fe *FFmpegError
+	if errors.As(err, &fe) {
+		return fe.Class, fe.Log
+	}
+	var pe *PreflightError
+	if errors.As(err, &pe) {
+		return pe.Report.Class(), ""
+	}
+	return FailureUnknown, ""
+}
+
+// newFFmpegError classifies ffmpeg failure by the way it exited and its log output.
+func newFFmpegError(err error, log []byte) *FFmpegError {
+	if len(log) > ffmpegLogTail {
+		log = log[len(log)-ffmpegLogTail:]
+	}
+	fe := &FFmpegError{Class: FailureUnknown, Log: strings.TrimSpace(string(log)), err: err}
+	for _, p := range failurePatterns {
+		if p.re.MatchString(fe.Log) {
+			fe.Class = p.class
+			return fe
+		}
+	}
+	// The kernel OOM killer terminates processes with SIGKILL without them logging anything.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() && ws.Signal() == syscall.SIGKILL {
+			fe.Class = FailureOOM
+		}
+	}
+	return fe
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	return strings.TrimSpace(s[strings.LastIndex(s, "\n")+1:])
+}
+
+// tailBuffer is a writer keeping only the last `size` bytes written into it.
+type tailBuffer struct {
+	sync.Mutex
+	size int
+	buf  []byte
+}
+
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{size: size}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.size {
+		b.buf = append([]byte{}, b.buf[len(b.buf)-b.size:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) Bytes() []byte {
+	b.Lock()
+	defer b.Unlock()
+	return append([]byte{}, b.buf...)
+}
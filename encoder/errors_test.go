@@ -0,0 +1,66 @@
+package encoder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFFmpegError(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+	cases := []struct {
+		log   string
+		class FailureClass
+	}{
+		{"[mov,mp4,m4a,3gp,3g2,mj2 @ 0x55d0] moov atom not found\ninput.mp4: Invalid data found when processing input", FailureCorruptInput},
+		{"[matroska,webm @ 0x5601] Could not find codec parameters for stream 0 (Video: none)", FailureCorruptInput},
+		{"Decoder (codec none) not found for input stream #0:0", FailureUnsupportedCodec},
+		{"Error writing trailer of out.m3u8: No space left on device", FailureOutOfDisk},
+		{"[libx264 @ 0x5583] malloc of size 1048576 failed\nError while opening encoder: Cannot allocate memory", FailureOOM},
+		{"Unrecognized option 'hls_tme'.\nError splitting the argument list: Option not found", FailureInvalidArguments},
+		{"Conversion failed!", FailureUnknown},
+		{"", FailureUnknown},
+	}
+	for _, c := range cases {
+		t.Run(string(c.class), func(t *testing.T) {
+			fe := newFFmpegError(exitErr, []byte(c.log+"\n"))
+			assert.Equal(t, c.class, fe.Class)
+			assert.Equal(t, c.log, fe.Log)
+			assert.True(t, errors.Is(fe, exitErr))
+		})
+	}
+}
+
+func TestFFmpegErrorMessage(t *testing.T) {
+	fe := newFFmpegError(errors.New("exit status 1"), []byte("first line\nError opening output files: Invalid argument\n"))
+	assert.Equal(t, "ffmpeg failed (invalid_arguments): exit status 1: Error opening output files: Invalid argument", fe.Error())
+	assert.False(t, fe.Class.Retriable())
+	assert.True(t, FailureOOM.Retriable())
+	assert.True(t, FailureOutOfDisk.Retriable())
+}
+
+func TestFailureOf(t *testing.T) {
+	fe := newFFmpegError(errors.New("exit status 1"), []byte("No space left on device"))
+	class, log := FailureOf(fmt.Errorf("encoding failed: %w", fe))
+	assert.Equal(t, FailureOutOfDisk, class)
+	assert.Equal(t, "No space left on device", log)
+
+	class, log = FailureOf(errors.New("cannot create directory"))
+	assert.Equal(t, FailureUnknown, class)
+	assert.Empty(t, log)
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := newTailBuffer(10)
+	b.Write([]byte("0123"))
+	b.Write([]byte("456789abc"))
+	assert.Equal(t, "3456789abc", string(b.Bytes()))
+	b.Write([]byte(strings.Repeat("x", 20)))
+	assert.Equal(t, strings.Repeat("x", 10), string(b.Bytes()))
+
+	fe := newFFmpegError(errors.New("exit status 1"), []byte(strings.Repeat("y", ffmpegLogTail*2)))
+	assert.Len(t, fe.Log, ffmpegLogTail)
+}
@@ -0,0 +1,119 @@
+package encoder
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	ffmpegt "github.com/floostack/transcoder"
+	"github.com/pkg/errors"
+)
+
+// ErrCancelled is returned by Result.Err when encoding was stopped by cancelling its context.
+var ErrCancelled = errors.New("encoding cancelled")
+
+// ffmpegProgress is a single progress report read from ffmpeg `-progress` output.
+type ffmpegProgress struct {
+	frames, time, bitrate, speed string
+	progress                     float64
+}
+
+func (p ffmpegProgress) GetFramesProcessed() string { return p.frames }
+func (p ffmpegProgress) GetCurrentTime() string     { return p.time }
+func (p ffmpegProgress) GetCurrentBitrate() string  { return p.bitrate }
+func (p ffmpegProgress) GetProgress() float64       { return p.progress }
+func (p ffmpegProgress) GetSpeed() string           { return p.speed }
+
+// ffmpegProcess is a running ffmpeg transcoding.
+type ffmpegProcess struct {
+	cmd      *exec.Cmd
+	progress chan ffmpegt.Progress
+	err      error
+}
+
+// startFFmpeg runs ffmpeg with `args` in `dir`, reporting progress of processing the input of `duration` seconds.
+// Cancelling `ctx` kills the whole ffmpeg process group. Progress channel is closed when ffmpeg exits,
+// the error it exited with is available through Err after that, as *FFmpegError.
+func (e encoder) startFFmpeg(ctx context.Context, dir string, args []string, duration float64) (*ffmpegProcess, error) {
+	args = append([]string{"-y", "-v", "error", "-nostats", "-progress", "pipe:1"}, args...)
+	cmd := exec.Command(e.ffmpegPath, args...)
+	cmd.Dir = dir
+	log := newTailBuffer(ffmpegLogTail)
+	cmd.Stderr = log
+	setProcessGroup(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "cannot start ffmpeg")
+	}
+
+	p := &ffmpegProcess{cmd: cmd, progress: make(chan ffmpegt.Progress)}
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := killProcessGroup(cmd); err != nil {
+				e.log.Warn("cannot kill ffmpeg", "pid", cmd.Process.Pid, "err", err)
+			}
+		case <-exited:
+		}
+	}()
+	go func() {
+		defer close(p.progress)
+		readProgress(stdout, duration, p.progress)
+		err := cmd.Wait()
+		close(exited)
+		if ctx.Err() != nil {
+			p.err = ErrCancelled
+		} else if err != nil {
+			p.err = newFFmpegError(err, log.Bytes())
+		}
+	}()
+	return p, nil
+}
+
+// Err returns the error ffmpeg has exited with. It should only be called after progress channel is closed.
+func (p *ffmpegProcess) Err() error {
+	return p.err
+}
+
+// readProgress parses blocks of key=value pairs ffmpeg writes with `-progress` option, each block ending with
+// `progress=continue` or `progress=end`.
+func readProgress(r io.Reader, duration float64, out chan<- ffmpegt.Progress) {
+	var p ffmpegProgress
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch k {
+		case "frame":
+			p.frames = v
+		case "bitrate":
+			p.bitrate = v
+		case "speed":
+			p.speed = v
+		case "out_time":
+			p.time = v
+		case "out_time_us":
+			us, err := strconv.ParseFloat(v, 64)
+			if err == nil && duration > 0 {
+				p.progress = us / 1e6 / duration * 100
+			}
+		case "progress":
+			if v == "end" {
+				p.progress = 100
+			}
+			out <- p
+		}
+	}
+	// Drain the pipe so ffmpeg doesn't get stuck writing into it.
+	io.Copy(io.Discard, r)
+}
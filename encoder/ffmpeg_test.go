@@ -0,0 +1,51 @@
+package encoder
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/lbryio/transcoder/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartFFmpegCancel(t *testing.T) {
+	// Fake ffmpeg reports some progress and leaves a child process holding its stdout.
+	ffmpeg := path.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\necho frame=25\necho out_time_us=1000000\necho progress=continue\nsleep 30\n"
+	require.NoError(t, os.WriteFile(ffmpeg, []byte(script), 0755))
+	e := encoder{&Configuration{ffmpegPath: ffmpeg, log: logging.NoopKVLogger{}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	proc, err := e.startFFmpeg(ctx, t.TempDir(), nil, 10)
+	require.NoError(t, err)
+
+	p := <-proc.progress
+	assert.EqualValues(t, 10, p.GetProgress())
+
+	started := time.Now()
+	cancel()
+	for range proc.progress {
+	}
+	assert.Less(t, time.Since(started).Seconds(), 5.0)
+	assert.Equal(t, ErrCancelled, proc.Err())
+}
+
+func TestStartFFmpegFailure(t *testing.T) {
+	ffmpeg := path.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\necho 'av_interleaved_write_frame(): No space left on device' >&2\nexit 1\n"
+	require.NoError(t, os.WriteFile(ffmpeg, []byte(script), 0755))
+	e := encoder{&Configuration{ffmpegPath: ffmpeg, log: logging.NoopKVLogger{}}}
+
+	proc, err := e.startFFmpeg(context.Background(), t.TempDir(), nil, 10)
+	require.NoError(t, err)
+	for range proc.progress {
+	}
+
+	class, log := FailureOf(proc.Err())
+	assert.Equal(t, FailureOutOfDisk, class)
+	assert.Equal(t, "av_interleaved_write_frame(): No space left on device", log)
+}
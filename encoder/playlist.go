@@ -0,0 +1,198 @@
+package encoder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/pkg/errors"
+)
+
+const streamInfTag = "#EXT-X-STREAM-INF:"
+
+var h264Profiles = map[string]string{
+	"Constrained Baseline":  "42e0",
+	"Baseline":              "4200",
+	"Main":                  "4d40",
+	"Extended":              "5800",
+	"High":                  "6400",
+	"High 10":               "6e00",
+	"High 4:2:2":            "7a00",
+	"High 4:4:4 Predictive": "f400",
+}
+
+type probedStream struct {
+	CodecType string `json:"codec_type"`
+	CodecName string `json:"codec_name"`
+	CodecTag  string `json:"codec_tag_string"`
+	Profile   string `json:"profile"`
+	Level     int    `json:"level"`
+	PixFmt    string `json:"pix_fmt"`
+	// ColorTransfer is used for detecting HDR video.
+	ColorTransfer string `json:"color_transfer"`
+}
+
+// rewriteMasterPlaylist calls `fn` for every variant stream listed in HLS master playlist
+// and replaces its #EXT-X-STREAM-INF line with the returned value.
+func rewriteMasterPlaylist(masterPath string, fn func(inf, uri string) (string, error)) error {
+	data, err := os.ReadFile(masterPath)
+	if err != nil {
+		return err
+	}
+
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for i, l := range lines {
+		if !strings.HasPrefix(l, streamInfTag) {
+			continue
+		}
+		var uri string
+		for _, next := range lines[i+1:] {
+			if next != "" && !strings.HasPrefix(next, "#") {
+				uri = next
+				break
+			}
+		}
+		if uri == "" {
+			return fmt.Errorf("no uri found for variant stream: %v", l)
+		}
+		lines[i], err = fn(l, uri)
+		if err != nil {
+			return errors.Wrapf(err, "cannot process variant %v", uri)
+		}
+	}
+
+	return os.WriteFile(masterPath, []byte(strings.Join(lines, "\n")+"\n"), os.ModePerm)
+}
+
+// setPlaylistAttr sets attribute value in playlist tag line, replacing the existing one if present.
+func setPlaylistAttr(line, name, value string) string {
+	re := regexp.MustCompile(`([:,])` + regexp.QuoteMeta(name) + `=("[^"]*"|[^,]*)`)
+	attr := name + "=" + value
+	if re.MatchString(line) {
+		return re.ReplaceAllStringFunc(line, func(m string) string { return m[:1] + attr })
+	}
+	if strings.HasSuffix(line, ":") {
+		return line + attr
+	}
+	return line + "," + attr
+}
+
+// fillVariantAttributes probes every variant stream of the HLS master playlist in `dir`
+// and sets their CODECS attributes, which ffmpeg only does for some of the codecs,
+// and VIDEO-RANGE for HDR variants.
+func (e encoder) fillVariantAttributes(dir string) error {
+	return rewriteMasterPlaylist(path.Join(dir, MasterPlaylist), func(inf, uri string) (string, error) {
+		streams, err := e.probeStreams(path.Join(dir, uri))
+		if err != nil {
+			return "", err
+		}
+		codecs := []string{}
+		for _, s := range streams {
+			if c := s.rfc6381(); c != "" {
+				codecs = append(codecs, c)
+			}
+			if r := s.videoRange(); r != "" {
+				inf = setPlaylistAttr(inf, "VIDEO-RANGE", r)
+			}
+		}
+		if len(codecs) == 0 {
+			return inf, nil
+		}
+		return setPlaylistAttr(inf, "CODECS", `"`+strings.Join(codecs, ",")+`"`), nil
+	})
+}
+
+func (e encoder) probeStreams(input string) ([]probedStream, error) {
+	var outb, errb bytes.Buffer
+	cmd := exec.Command(e.ffprobePath, "-v", "error", "-print_format", "json", "-show_streams", input)
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error probing %v: %w (%v)", input, err, errb.String())
+	}
+	out := struct {
+		Streams []probedStream `json:"streams"`
+	}{}
+	if err := json.Unmarshal(outb.Bytes(), &out); err != nil {
+		return nil, err
+	}
+	return out.Streams, nil
+}
+
+// rfc6381 returns codec string as used in CODECS attribute of HLS playlists.
+// Empty string is returned for codecs it cannot describe.
+func (s probedStream) rfc6381() string {
+	switch s.CodecName {
+	case "h264":
+		p, ok := h264Profiles[s.Profile]
+		if !ok {
+			p = h264Profiles["High"]
+		}
+		return fmt.Sprintf("avc1.%v%02x", p, s.Level)
+	case "hevc":
+		tag := "hvc1"
+		if s.CodecTag == "hev1" {
+			tag = "hev1"
+		}
+		if s.Profile == "Main 10" {
+			return fmt.Sprintf("%v.2.4.L%v.90", tag, s.Level)
+		}
+		return fmt.Sprintf("%v.1.6.L%v.90", tag, s.Level)
+	case "av1":
+		profile := 0
+		switch s.Profile {
+		case "High":
+			profile = 1
+		case "Professional":
+			profile = 2
+		}
+		depth := 8
+		if strings.Contains(s.PixFmt, "10le") {
+			depth = 10
+		}
+		return fmt.Sprintf("av01.%v.%02dM.%02d", profile, s.Level, depth)
+	case "aac":
+		if strings.HasPrefix(s.Profile, "HE") {
+			return "mp4a.40.5"
+		}
+		return "mp4a.40.2"
+	case "mp3":
+		return "mp4a.40.34"
+	case "ac3":
+		return "ac-3"
+	case "eac3":
+		return "ec-3"
+	case "opus":
+		return "Opus"
+	}
+	return ""
+}
+
+// videoRange returns VIDEO-RANGE attribute value for HDR video streams and empty string for everything else.
+func (s probedStream) videoRange() string {
+	if s.CodecType != "video" {
+		return ""
+	}
+	switch s.ColorTransfer {
+	case "smpte2084":
+		return ladder.VideoRangePQ
+	case "arib-std-b67":
+		return ladder.VideoRangeHLG
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package encoder
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPlaylistAttr(t *testing.T) {
+	testCases := []struct {
+		line, name, value, expected string
+	}{
+		{
+			`#EXT-X-STREAM-INF:BANDWIDTH=1000,RESOLUTION=640x360`, "CODECS", `"avc1.64001e,mp4a.40.2"`,
+			`#EXT-X-STREAM-INF:BANDWIDTH=1000,RESOLUTION=640x360,CODECS="avc1.64001e,mp4a.40.2"`,
+		},
+		{
+			`#EXT-X-STREAM-INF:BANDWIDTH=1000,CODECS="avc1.64001e",RESOLUTION=640x360`, "CODECS", `"hvc1.1.6.L93.90,mp4a.40.2"`,
+			`#EXT-X-STREAM-INF:BANDWIDTH=1000,CODECS="hvc1.1.6.L93.90,mp4a.40.2",RESOLUTION=640x360`,
+		},
+		{
+			`#EXT-X-STREAM-INF:BANDWIDTH=1000`, "BANDWIDTH", "2000",
+			`#EXT-X-STREAM-INF:BANDWIDTH=2000`,
+		},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, setPlaylistAttr(tc.line, tc.name, tc.value))
+	}
+}
+
+func TestRewriteMasterPlaylist(t *testing.T) {
+	masterPath := path.Join(t.TempDir(), MasterPlaylist)
+	require.NoError(t, os.WriteFile(masterPath, []byte(`#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-STREAM-INF:BANDWIDTH=3960000,RESOLUTION=1920x1080
+v0.m3u8
+
+#EXT-X-STREAM-INF:BANDWIDTH=2970000,RESOLUTION=1280x720
+v1.m3u8
+`), os.ModePerm))
+
+	seen := []string{}
+	err := rewriteMasterPlaylist(masterPath, func(inf, uri string) (string, error) {
+		seen = append(seen, uri)
+		return setPlaylistAttr(inf, "CODECS", `"avc1.640028"`), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v0.m3u8", "v1.m3u8"}, seen)
+
+	data, err := os.ReadFile(masterPath)
+	require.NoError(t, err)
+	assert.Equal(t, `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-STREAM-INF:BANDWIDTH=3960000,RESOLUTION=1920x1080,CODECS="avc1.640028"
+v0.m3u8
+
+#EXT-X-STREAM-INF:BANDWIDTH=2970000,RESOLUTION=1280x720,CODECS="avc1.640028"
+v1.m3u8
+`, string(data))
+}
+
+func TestRFC6381(t *testing.T) {
+	testCases := []struct {
+		stream   probedStream
+		expected string
+	}{
+		{probedStream{CodecName: "h264", Profile: "High", Level: 40}, "avc1.640028"},
+		{probedStream{CodecName: "h264", Profile: "Main", Level: 31}, "avc1.4d401f"},
+		{probedStream{CodecName: "h264", Profile: "Constrained Baseline", Level: 30}, "avc1.42e01e"},
+		{probedStream{CodecName: "hevc", Profile: "Main", Level: 120, CodecTag: "hvc1"}, "hvc1.1.6.L120.90"},
+		{probedStream{CodecName: "hevc", Profile: "Main 10", Level: 153, CodecTag: "hev1"}, "hev1.2.4.L153.90"},
+		{probedStream{CodecName: "av1", Profile: "Main", Level: 8, PixFmt: "yuv420p"}, "av01.0.08M.08"},
+		{probedStream{CodecName: "av1", Profile: "Main", Level: 9, PixFmt: "yuv420p10le"}, "av01.0.09M.10"},
+		{probedStream{CodecName: "aac", Profile: "LC"}, "mp4a.40.2"},
+		{probedStream{CodecName: "mjpeg"}, ""},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, tc.stream.rfc6381(), tc.stream.CodecName)
+	}
+}
+
+func TestVideoRange(t *testing.T) {
+	assert.Equal(t, "PQ", probedStream{CodecType: "video", ColorTransfer: "smpte2084"}.videoRange())
+	assert.Equal(t, "HLG", probedStream{CodecType: "video", ColorTransfer: "arib-std-b67"}.videoRange())
+	assert.Equal(t, "", probedStream{CodecType: "video", ColorTransfer: "bt709"}.videoRange())
+	assert.Equal(t, "", probedStream{CodecType: "audio"}.videoRange())
+}
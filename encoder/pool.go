@@ -1,8 +1,15 @@
 package encoder
 
-import "github.com/lbryio/transcoder/pkg/dispatcher"
+import (
+	"context"
 
-type encodeTask [2]string
+	"github.com/lbryio/transcoder/pkg/dispatcher"
+)
+
+type encodeTask struct {
+	ctx     context.Context
+	in, out string
+}
 
 type pool struct {
 	dispatcher.Dispatcher
@@ -14,7 +21,7 @@ type worker struct {
 
 func (w worker) Work(t dispatcher.Task) error {
 	et := t.Payload.(encodeTask)
-	res, err := w.encoder.Encode(et[0], et[1])
+	res, err := w.encoder.Encode(et.ctx, et.in, et.out)
 	t.SetResult(res)
 	return err
 }
@@ -28,6 +35,6 @@ func NewPool(encoder Encoder, parallel int) pool {
 // Encode throws encoding task into a pool of workers.
 // It works slightly different from encoder.Encode but the result should eventually be the same.
 // For how to obtain encoding progress, see poolSuite.TestEncode.
-func (p pool) Encode(in, out string) *dispatcher.Result {
-	return p.Dispatcher.Dispatch(encodeTask{in, out})
+func (p pool) Encode(ctx context.Context, in, out string) *dispatcher.Result {
+	return p.Dispatcher.Dispatch(encodeTask{ctx, in, out})
 }
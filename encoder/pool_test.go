@@ -1,6 +1,7 @@
 package encoder
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path"
@@ -48,7 +49,7 @@ func (s *poolSuite) TestEncode() {
 	s.Require().NoError(err)
 	p := NewPool(enc, 10)
 
-	res := (<-p.Encode(absPath, s.out).Value()).(*Result)
+	res := (<-p.Encode(context.Background(), absPath, s.out).Value()).(*Result)
 
 	vs := res.OrigMeta.VideoStream
 	s.Equal(1920, vs.GetWidth())
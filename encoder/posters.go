@@ -0,0 +1,234 @@
+package encoder
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/pkg/errors"
+)
+
+const (
+	PosterName = "poster.jpg"
+
+	PreviewFormatMP4  = "mp4"
+	PreviewFormatWebP = "webp"
+
+	posterMaxHeight       = 720
+	posterCandidateLength = 4.0 // seconds
+	// posterMinBrightness and posterMinContrast reject black and uniform (fades, title cards) frames,
+	// both are in 8-bit luma units.
+	posterMinBrightness = 32
+	posterMinContrast   = 24
+)
+
+// posterCandidates are positions in the video (as fractions of its duration) where poster frames are looked for.
+var posterCandidates = []float64{0.1, 0.3, 0.5, 0.7}
+
+// PreviewConfig defines how the animated preview clip is produced.
+type PreviewConfig struct {
+	// Duration of the preview clip, zero disables poster and preview extraction.
+	Duration time.Duration
+	// Height of the preview clip, width follows video display aspect ratio.
+	Height int
+	// Format is either PreviewFormatMP4 (H.264, muted) or PreviewFormatWebP (animated WebP).
+	Format string
+	// Framerate of the preview clip.
+	Framerate int
+}
+
+// DefaultPreviewConfig produces a 6 second muted 360p MP4 clip.
+var DefaultPreviewConfig = PreviewConfig{
+	Duration:  6 * time.Second,
+	Height:    360,
+	Format:    PreviewFormatMP4,
+	Framerate: 15,
+}
+
+// posterCandidate is a frame picked by ffmpeg `thumbnail` filter out of a short segment of the video.
+type posterCandidate struct {
+	start      float64
+	file       string
+	brightness float64
+	contrast   float64
+}
+
+// score is higher for better poster candidates. Black and uniform frames get negative score.
+func (c posterCandidate) score() float64 {
+	if c.brightness < posterMinBrightness || c.contrast < posterMinContrast {
+		return c.contrast - 256
+	}
+	return c.contrast
+}
+
+// PreviewName returns preview clip file name for the configured format.
+func (c PreviewConfig) PreviewName() string {
+	return "preview." + c.Format
+}
+
+// extractPosterAndPreview writes poster image and preview clip into the output directory, recording
+// their names in `res`. Failures are not fatal for transcoding and only get logged.
+func (e encoder) extractPosterAndPreview(ctx context.Context, input, output string, meta *ladder.Metadata, res *Result) {
+	start, err := e.extractPoster(ctx, input, output, meta)
+	if err != nil {
+		e.log.Warn("poster extraction failed", "input", input, "err", err)
+		return
+	}
+	res.Poster = PosterName
+	if err := e.extractPreview(ctx, input, output, start, meta); err != nil {
+		e.log.Warn("preview extraction failed", "input", input, "err", err)
+		return
+	}
+	res.Preview = e.preview.PreviewName()
+}
+
+// extractPoster picks a representative frame out of several segments of the video, skipping black
+// and uniform ones, and writes it into PosterName. Start of the segment the frame was taken from
+// is returned so the preview clip can be cut from the same place.
+func (e encoder) extractPoster(ctx context.Context, input, output string, meta *ladder.Metadata) (float64, error) {
+	dur, err := strconv.ParseFloat(meta.FMeta.GetFormat().GetDuration(), 64)
+	if err != nil || dur <= 0 {
+		return 0, fmt.Errorf("cannot determine media duration: %v", meta.FMeta.GetFormat().GetDuration())
+	}
+	tmpDir, err := os.MkdirTemp("", "poster")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	starts := []float64{0}
+	if dur > posterCandidateLength*float64(len(posterCandidates)) {
+		starts = []float64{}
+		for _, f := range posterCandidates {
+			starts = append(starts, math.Floor(dur*f))
+		}
+	}
+
+	batch := int(math.Max(1, posterCandidateLength*float64(meta.IntFPS)))
+	w, h := displaySize(meta, posterMaxHeight)
+	var best *posterCandidate
+	for i, start := range starts {
+		c := &posterCandidate{start: start, file: path.Join(tmpDir, fmt.Sprintf("candidate_%v.jpg", i))}
+		statsFile := path.Join(tmpDir, fmt.Sprintf("candidate_%v.txt", i))
+		cmd := exec.CommandContext(ctx, e.ffmpegPath,
+			"-y", "-v", "error",
+			"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+			"-t", strconv.FormatFloat(posterCandidateLength, 'f', 3, 64),
+			"-i", input,
+			"-map", "v:0",
+			"-vf", fmt.Sprintf("thumbnail=n=%v,signalstats,metadata=mode=print:file=%v,scale=%v:%v,setsar=1", batch, statsFile, w, h),
+			"-frames:v", "1",
+			"-q:v", "2",
+			c.file,
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return 0, fmt.Errorf("cannot extract poster candidate at %.2fs: %w: %s", start, err, out)
+		}
+		if err := c.readStats(statsFile, meta.BitDepth); err != nil {
+			return 0, err
+		}
+		e.log.Debug("poster candidate", "start", start, "brightness", c.brightness, "contrast", c.contrast)
+		if best == nil || c.score() > best.score() {
+			best = c
+		}
+	}
+	if best == nil {
+		return 0, errors.New("no poster candidates found")
+	}
+
+	data, err := os.ReadFile(best.file)
+	if err != nil {
+		return 0, err
+	}
+	return best.start, os.WriteFile(path.Join(output, PosterName), data, os.ModePerm)
+}
+
+// extractPreview cuts a muted clip of the configured duration starting at `start` seconds.
+func (e encoder) extractPreview(ctx context.Context, input, output string, start float64, meta *ladder.Metadata) error {
+	cfg := e.preview
+	w, h := displaySize(meta, cfg.Height)
+	args := []string{
+		"-y", "-v", "error",
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+		"-t", strconv.FormatFloat(cfg.Duration.Seconds(), 'f', 3, 64),
+		"-i", input,
+		"-map", "v:0", "-an", "-sn",
+		"-vf", fmt.Sprintf("fps=%v,scale=%v:%v,setsar=1", cfg.Framerate, w, h),
+	}
+	switch cfg.Format {
+	case PreviewFormatWebP:
+		args = append(args, "-c:v", "libwebp", "-loop", "0", "-q:v", "60")
+	case PreviewFormatMP4:
+		args = append(args,
+			"-c:v", ladder.CodecH264, "-preset", "veryfast", "-crf", "28",
+			"-pix_fmt", "yuv420p", "-movflags", "+faststart")
+	default:
+		return fmt.Errorf("unsupported preview format: %v", cfg.Format)
+	}
+	args = append(args, path.Join(output, cfg.PreviewName()))
+
+	if out, err := exec.CommandContext(ctx, e.ffmpegPath, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot extract preview: %w: %s", err, out)
+	}
+	return nil
+}
+
+// readStats reads frame statistics printed by ffmpeg `signalstats` and `metadata` filters.
+// Luma values are reported in the source bit depth and get normalized to 8 bits.
+func (c *posterCandidate) readStats(file string, bitDepth int) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Wrap(err, "cannot read poster candidate stats")
+	}
+	defer f.Close()
+
+	stats := map[string]float64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], "lavfi.signalstats.") {
+			continue
+		}
+		v, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			continue
+		}
+		stats[strings.TrimPrefix(kv[0], "lavfi.signalstats.")] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if _, ok := stats["YAVG"]; !ok {
+		return errors.New("no frame statistics found for poster candidate")
+	}
+
+	scale := 1.0
+	if bitDepth > 8 {
+		scale = math.Pow(2, float64(bitDepth-8))
+	}
+	c.brightness = stats["YAVG"] / scale
+	c.contrast = (stats["YHIGH"] - stats["YLOW"]) / scale
+	return nil
+}
+
+// displaySize returns even output dimensions for the video scaled down to `maxHeight`,
+// respecting its display aspect ratio.
+func displaySize(meta *ladder.Metadata, maxHeight int) (int, int) {
+	h := meta.DisplayHeight
+	if h > maxHeight || h == 0 {
+		h = maxHeight
+	}
+	w := h
+	if meta.DisplayHeight > 0 {
+		w = int(math.Round(float64(h) * float64(meta.DisplayWidth) / float64(meta.DisplayHeight)))
+	}
+	return w + w%2, h + h%2
+}
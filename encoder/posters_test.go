@@ -0,0 +1,61 @@
+package encoder
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPosterCandidateScore(t *testing.T) {
+	black := posterCandidate{brightness: 16, contrast: 200}
+	uniform := posterCandidate{brightness: 120, contrast: 10}
+	dull := posterCandidate{brightness: 120, contrast: 60}
+	vivid := posterCandidate{brightness: 90, contrast: 180}
+
+	assert.Greater(t, vivid.score(), dull.score())
+	assert.Greater(t, dull.score(), black.score())
+	assert.Greater(t, dull.score(), uniform.score())
+	assert.Less(t, black.score(), 0.0)
+	assert.Less(t, uniform.score(), 0.0)
+}
+
+func TestPosterCandidateReadStats(t *testing.T) {
+	statsFile := path.Join(t.TempDir(), "stats.txt")
+	stats := `frame:0    pts:48048   pts_time:2.002
+lavfi.signalstats.YMIN=64
+lavfi.signalstats.YLOW=128
+lavfi.signalstats.YAVG=480.5
+lavfi.signalstats.YHIGH=896
+lavfi.signalstats.YMAX=940
+`
+	require.NoError(t, os.WriteFile(statsFile, []byte(stats), os.ModePerm))
+
+	c := &posterCandidate{}
+	require.NoError(t, c.readStats(statsFile, 10))
+	assert.InDelta(t, 120.125, c.brightness, 0.001)
+	assert.InDelta(t, 192, c.contrast, 0.001)
+
+	require.NoError(t, c.readStats(statsFile, 8))
+	assert.InDelta(t, 480.5, c.brightness, 0.001)
+
+	require.NoError(t, os.WriteFile(statsFile, []byte("frame:0    pts:0   pts_time:0\n"), os.ModePerm))
+	assert.Error(t, c.readStats(statsFile, 8))
+}
+
+func TestDisplaySize(t *testing.T) {
+	w, h := displaySize(&ladder.Metadata{DisplayWidth: 1920, DisplayHeight: 1080}, 360)
+	assert.Equal(t, 640, w)
+	assert.Equal(t, 360, h)
+
+	w, h = displaySize(&ladder.Metadata{DisplayWidth: 1080, DisplayHeight: 1920}, 720)
+	assert.Equal(t, 406, w)
+	assert.Equal(t, 720, h)
+
+	w, h = displaySize(&ladder.Metadata{DisplayWidth: 320, DisplayHeight: 240}, 720)
+	assert.Equal(t, 320, w)
+	assert.Equal(t, 240, h)
+}
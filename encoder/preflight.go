@@ -0,0 +1,350 @@
+package encoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lbryio/transcoder/ladder"
+
+	"github.com/pkg/errors"
+)
+
+// PreflightDecision is the way an input is going to be processed, as decided by preflight checks.
+type PreflightDecision string
+
+const (
+	// PreflightTranscode inputs are encoded into all ladder tiers.
+	PreflightTranscode PreflightDecision = "transcode"
+	// PreflightRemux inputs have streams compatible with HLS which can be copied into the output as is.
+	PreflightRemux PreflightDecision = "remux"
+	// PreflightReject inputs are not processed at all.
+	PreflightReject PreflightDecision = "reject"
+)
+
+// Names of preflight checks, as reported in PreflightIssue.
+const (
+	CheckContainer  = "container"
+	CheckDuration   = "duration"
+	CheckCodec      = "codec"
+	CheckResolution = "resolution"
+	CheckFramerate  = "framerate"
+	CheckFastStart  = "faststart"
+)
+
+// Codecs (as named by ffprobe) of source streams which can be copied into HLS output without re-encoding.
+var (
+	remuxVideoCodecs = []string{"h264"}
+	remuxAudioCodecs = []string{"aac"}
+)
+
+// PreflightLimits defines which inputs are accepted for transcoding.
+type PreflightLimits struct {
+	// MinDuration and MaxDuration bound input duration, zero MaxDuration means no limit.
+	// Inputs reporting zero duration are always rejected.
+	MinDuration, MaxDuration time.Duration
+	// MaxWidth and MaxHeight bound video display size. They are compared to the longer and the shorter side
+	// of the video respectively, so portrait videos get the same treatment as landscape ones.
+	MaxWidth, MaxHeight int
+	// MaxFramerate is the highest accepted average video framerate.
+	MaxFramerate float64
+	// VideoCodecs and AudioCodecs list accepted codecs as named by ffprobe (`h264`, `vp9`, `aac`, ...).
+	// Empty lists accept any codec ffprobe is able to identify.
+	VideoCodecs, AudioCodecs []string
+}
+
+// DefaultPreflightLimits accept inputs up to 8K and 12 hours long.
+var DefaultPreflightLimits = PreflightLimits{
+	MaxDuration:  12 * time.Hour,
+	MaxWidth:     7680,
+	MaxHeight:    4320,
+	MaxFramerate: 120,
+}
+
+// PreflightReport describes the input and the result of preflight checks.
+type PreflightReport struct {
+	Decision PreflightDecision `json:"decision"`
+	Issues   []PreflightIssue  `json:"issues,omitempty"`
+
+	Container  string  `json:"container,omitempty"`
+	Duration   float64 `json:"duration,omitempty"`
+	VideoCodec string  `json:"video_codec,omitempty"`
+	AudioCodec string  `json:"audio_codec,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Framerate  float64 `json:"framerate,omitempty"`
+	VFR        bool    `json:"vfr,omitempty"`
+	FastStart  bool    `json:"faststart,omitempty"`
+}
+
+// PreflightIssue is a problem found by one of preflight checks.
+type PreflightIssue struct {
+	Check string `json:"check"`
+	// Class is only set for issues the input gets rejected for.
+	Class   FailureClass `json:"class,omitempty"`
+	Message string       `json:"message"`
+}
+
+// PreflightError is returned for inputs rejected by preflight checks.
+type PreflightError struct {
+	Report *PreflightReport
+	err    error
+}
+
+func (e *PreflightError) Error() string {
+	msgs := []string{}
+	for _, i := range e.Report.Issues {
+		if i.Class != "" {
+			msgs = append(msgs, i.Message)
+		}
+	}
+	return "input rejected: " + strings.Join(msgs, "; ")
+}
+
+func (e *PreflightError) Unwrap() error {
+	return e.err
+}
+
+// Class returns failure class of the first issue the input was rejected for, FailureUnknown if it was not rejected.
+func (r *PreflightReport) Class() FailureClass {
+	for _, i := range r.Issues {
+		if i.Class != "" {
+			return i.Class
+		}
+	}
+	return FailureUnknown
+}
+
+func (r *PreflightReport) reject(check string, class FailureClass, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, PreflightIssue{Check: check, Class: class, Message: fmt.Sprintf(format, args...)})
+	r.Decision = PreflightReject
+}
+
+func (r *PreflightReport) warn(check string, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, PreflightIssue{Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// Preflight probes the input and checks it against configured limits, deciding how it should be processed.
+// Inputs that fail the checks are reported with *PreflightError, in which case metadata is not returned.
+func (e encoder) Preflight(input string) (*ladder.Metadata, *PreflightReport, error) {
+	report := &PreflightReport{Decision: PreflightTranscode}
+	meta, err := e.probe(input)
+	if err != nil {
+		var fe *FFmpegError
+		if errors.As(err, &fe) {
+			class := fe.Class
+			if class == FailureUnknown {
+				class = FailureCorruptInput
+			}
+			report.reject(CheckContainer, class, "cannot probe input: %v", lastLine(fe.Log))
+		} else if errors.Is(err, errMalformedProbe) {
+			report.reject(CheckContainer, FailureCorruptInput, "%v", err)
+		} else {
+			return nil, nil, err
+		}
+		return nil, report, &PreflightError{Report: report, err: err}
+	}
+
+	meta.FastStart, err = checkFastStart(input)
+	if err != nil {
+		report.warn(CheckFastStart, "cannot check for faststart: %v", err)
+	}
+	e.limits.check(meta, report)
+	e.log.Debug("preflight checks done", "input", input, "decision", report.Decision, "issues", report.Issues)
+	if report.Decision == PreflightReject {
+		return nil, report, &PreflightError{Report: report}
+	}
+	return meta, report, nil
+}
+
+var errMalformedProbe = errors.New("malformed probe")
+
+// probe uses ffprobe to parse video file metadata.
+func (e encoder) probe(input string) (*ladder.Metadata, error) {
+	var outb, errb bytes.Buffer
+
+	args := []string{"-i", input, "-print_format", "json", "-show_format", "-show_streams", "-show_error"}
+
+	cmd := exec.Command(e.ffprobePath, args...)
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+
+	err := cmd.Run()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, errors.Wrapf(err, "error executing (%s) with args (%s)", e.ffprobePath, args)
+		}
+		return nil, errors.Wrapf(
+			newFFmpegError(err, append(outb.Bytes(), errb.Bytes()...)),
+			"error executing (%s) with args (%s)", e.ffprobePath, args)
+	}
+
+	lm, err := ladder.WrapProbe(outb.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedProbe, err)
+	}
+	return lm, nil
+}
+
+// check fills in the report with input properties, rejecting inputs beyond the limits.
+// Inputs that pass get either transcoded or remuxed.
+func (l PreflightLimits) check(meta *ladder.Metadata, r *PreflightReport) {
+	r.Container = meta.FMeta.GetFormat().GetFormatName()
+	r.FastStart = meta.FastStart
+
+	dur, err := strconv.ParseFloat(meta.FMeta.GetFormat().GetDuration(), 64)
+	switch {
+	case err != nil || dur <= 0 || math.IsInf(dur, 0):
+		r.reject(CheckDuration, FailureCorruptInput, "input reports no duration: %q", meta.FMeta.GetFormat().GetDuration())
+	case dur < l.MinDuration.Seconds():
+		r.reject(CheckDuration, FailureOutOfLimits, "input is too short: %.1fs < %v", dur, l.MinDuration)
+	case l.MaxDuration > 0 && dur > l.MaxDuration.Seconds():
+		r.reject(CheckDuration, FailureOutOfLimits, "input is too long: %.1fs > %v", dur, l.MaxDuration)
+	}
+	if err == nil {
+		r.Duration = dur
+	}
+
+	if meta.HasAudio() {
+		r.AudioCodec = streamCodec(meta, "audio")
+		if !acceptedCodec(r.AudioCodec, l.AudioCodecs) {
+			r.reject(CheckCodec, FailureUnsupportedCodec, "unsupported audio codec: %q", r.AudioCodec)
+		}
+	}
+	if !meta.HasVideo() {
+		return
+	}
+
+	r.VideoCodec = streamCodec(meta, "video")
+	if !acceptedCodec(r.VideoCodec, l.VideoCodecs) {
+		r.reject(CheckCodec, FailureUnsupportedCodec, "unsupported video codec: %q", r.VideoCodec)
+	}
+
+	r.Width, r.Height = meta.DisplayWidth, meta.DisplayHeight
+	long, short := r.Width, r.Height
+	if short > long {
+		long, short = short, long
+	}
+	switch {
+	case short <= 0:
+		r.reject(CheckResolution, FailureCorruptInput, "input reports no video dimensions")
+	case l.MaxWidth > 0 && long > l.MaxWidth, l.MaxHeight > 0 && short > l.MaxHeight:
+		r.reject(CheckResolution, FailureOutOfLimits, "video is too large: %vx%v > %vx%v", r.Width, r.Height, l.MaxWidth, l.MaxHeight)
+	}
+
+	r.Framerate, r.VFR = meta.FPS, meta.VFR
+	if l.MaxFramerate > 0 && r.Framerate > l.MaxFramerate {
+		r.reject(CheckFramerate, FailureOutOfLimits, "framerate is too high: %.2f > %v", r.Framerate, l.MaxFramerate)
+	}
+	if r.VFR {
+		r.warn(CheckFramerate, "variable framerate video")
+	}
+
+	if r.Decision == PreflightTranscode && remuxable(meta, r) {
+		r.Decision = PreflightRemux
+	}
+}
+
+// remuxable is true for video which can be segmented as is: constant framerate 8-bit SDR H.264 with square pixels
+// and no rotation, and AAC audio if there is any.
+func remuxable(meta *ladder.Metadata, r *PreflightReport) bool {
+	return acceptedCodec(r.VideoCodec, remuxVideoCodecs) &&
+		(r.AudioCodec == "" || acceptedCodec(r.AudioCodec, remuxAudioCodecs)) &&
+		!r.VFR &&
+		!meta.HDR() && meta.BitDepth == 8 &&
+		!meta.Anamorphic() && meta.Rotation == 0
+}
+
+// streamCodec returns codec name of the first stream of `codecType`.
+func streamCodec(meta *ladder.Metadata, codecType string) string {
+	if s := firstStream(meta, codecType); s != nil {
+		return s.CodecName
+	}
+	return ""
+}
+
+// firstStream returns details of the first stream of `codecType`, which is the one ladder.Metadata picks.
+func firstStream(meta *ladder.Metadata, codecType string) *ladder.StreamInfo {
+	for i := range meta.Streams {
+		if meta.Streams[i].CodecType == codecType {
+			return &meta.Streams[i]
+		}
+	}
+	return nil
+}
+
+// acceptedCodec is true for codecs present in `accepted`, or for any identified codec if `accepted` is empty.
+// ffprobe reports streams in formats it does not know with no codec name or `none`.
+func acceptedCodec(codec string, accepted []string) bool {
+	if codec == "" || codec == "none" {
+		return false
+	}
+	if len(accepted) == 0 {
+		return true
+	}
+	for _, c := range accepted {
+		if c == codec {
+			return true
+		}
+	}
+	return false
+}
+
+// mp4TopLevelBoxes are box types an ISO BMFF (MP4, MOV) file may start with.
+var mp4TopLevelBoxes = map[string]bool{
+	"ftyp": true, "moov": true, "mdat": true, "free": true, "skip": true, "wide": true, "pnot": true,
+}
+
+// checkFastStart walks top-level boxes of MP4/MOV files, they can be played before being fully downloaded
+// when `moov` box comes before `mdat`. Files in other containers are never considered fast start.
+func checkFastStart(input string) (bool, error) {
+	f, err := os.Open(input)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 16)
+	var offset int64
+	for n := 0; ; n++ {
+		if _, err := f.ReadAt(header[:8], offset); err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		box := string(header[4:8])
+		if n == 0 && !mp4TopLevelBoxes[box] {
+			return false, nil
+		}
+		switch box {
+		case "moov":
+			return true, nil
+		case "mdat":
+			return false, nil
+		}
+
+		switch size {
+		case 0:
+			// Box extends to the end of file.
+			return false, nil
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return false, errors.Wrapf(err, "cannot read size of %q box", box)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 {
+			return false, fmt.Errorf("malformed %q box at %v", box, offset)
+		}
+		offset += size
+	}
+}
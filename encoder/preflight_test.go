@@ -0,0 +1,138 @@
+package encoder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mp4Box(typ string, payload int) []byte {
+	b := make([]byte, 8+payload)
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+	copy(b[4:], typ)
+	return b
+}
+
+func TestCheckFastStartBoxes(t *testing.T) {
+	largeMdat := make([]byte, 16+32)
+	binary.BigEndian.PutUint32(largeMdat, 1)
+	copy(largeMdat[4:], "free")
+	binary.BigEndian.PutUint64(largeMdat[8:], uint64(len(largeMdat)))
+
+	testCases := []struct {
+		name      string
+		boxes     [][]byte
+		fastStart bool
+		err       bool
+	}{
+		{"moov-first", [][]byte{mp4Box("ftyp", 24), mp4Box("moov", 100), mp4Box("mdat", 1000)}, true, false},
+		{"mdat-first", [][]byte{mp4Box("ftyp", 24), mp4Box("free", 8), mp4Box("mdat", 1000), mp4Box("moov", 100)}, false, false},
+		{"largesize", [][]byte{mp4Box("ftyp", 24), largeMdat, mp4Box("moov", 100)}, true, false},
+		{"mov", [][]byte{mp4Box("wide", 0), mp4Box("moov", 100)}, true, false},
+		{"not-mp4", [][]byte{[]byte("\x1aE\xdf\xa3matroska")}, false, false},
+		{"truncated", [][]byte{mp4Box("ftyp", 24)}, false, false},
+		{"malformed", [][]byte{mp4Box("ftyp", 24), {0, 0, 0, 4, 'f', 'r', 'e', 'e'}}, false, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := []byte{}
+			for _, b := range tc.boxes {
+				data = append(data, b...)
+			}
+			f := path.Join(t.TempDir(), "input")
+			require.NoError(t, os.WriteFile(f, data, 0644))
+			fastStart, err := checkFastStart(f)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.fastStart, fastStart)
+		})
+	}
+}
+
+func preflightProbe(video, audio string, w, h int, rate, duration string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "%v", "width": %v, "height": %v,
+				"avg_frame_rate": "%v", "r_frame_rate": "%v", "pix_fmt": "yuv420p"},
+			{"index": 1, "codec_type": "audio", "codec_name": "%v"}
+		],
+		"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "%v", "bit_rate": "4000000"}
+	}`, video, w, h, rate, rate, audio, duration))
+}
+
+func TestPreflightLimitsCheck(t *testing.T) {
+	limits := DefaultPreflightLimits
+	limits.MinDuration = time.Second
+	limits.AudioCodecs = []string{"aac", "opus", "mp3"}
+
+	testCases := []struct {
+		name     string
+		probe    []byte
+		decision PreflightDecision
+		class    FailureClass
+	}{
+		{"h264-aac", preflightProbe("h264", "aac", 1920, 1080, "30/1", "60.0"), PreflightRemux, FailureUnknown},
+		{"vp9-opus", preflightProbe("vp9", "opus", 1920, 1080, "30/1", "60.0"), PreflightTranscode, FailureUnknown},
+		{"portrait-8k", preflightProbe("h264", "aac", 4320, 7680, "30/1", "60.0"), PreflightRemux, FailureUnknown},
+		{"zero-duration", preflightProbe("h264", "aac", 1920, 1080, "30/1", "0.000000"), PreflightReject, FailureCorruptInput},
+		{"no-duration", preflightProbe("h264", "aac", 1920, 1080, "30/1", "N/A"), PreflightReject, FailureCorruptInput},
+		{"too-short", preflightProbe("h264", "aac", 1920, 1080, "30/1", "0.5"), PreflightReject, FailureOutOfLimits},
+		{"too-long", preflightProbe("h264", "aac", 1920, 1080, "30/1", "86400.0"), PreflightReject, FailureOutOfLimits},
+		{"too-large", preflightProbe("h264", "aac", 15360, 8640, "30/1", "60.0"), PreflightReject, FailureOutOfLimits},
+		{"too-fast", preflightProbe("h264", "aac", 1920, 1080, "240/1", "60.0"), PreflightReject, FailureOutOfLimits},
+		{"unknown-video", preflightProbe("none", "aac", 1920, 1080, "30/1", "60.0"), PreflightReject, FailureUnsupportedCodec},
+		{"unaccepted-audio", preflightProbe("h264", "wmav2", 1920, 1080, "30/1", "60.0"), PreflightReject, FailureUnsupportedCodec},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			meta, err := ladder.WrapProbe(tc.probe)
+			require.NoError(t, err)
+			r := &PreflightReport{Decision: PreflightTranscode}
+			limits.check(meta, r)
+			assert.Equal(t, tc.decision, r.Decision, r.Issues)
+			assert.Equal(t, tc.class, r.Class())
+			assert.Equal(t, "mov,mp4,m4a,3gp,3g2,mj2", r.Container)
+		})
+	}
+}
+
+func TestPreflightVFR(t *testing.T) {
+	probe := []byte(`{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1280, "height": 720,
+				"avg_frame_rate": "2997/100", "r_frame_rate": "60/1"}
+		],
+		"format": {"duration": "60.0"}
+	}`)
+	meta, err := ladder.WrapProbe(probe)
+	require.NoError(t, err)
+	r := &PreflightReport{Decision: PreflightTranscode}
+	DefaultPreflightLimits.check(meta, r)
+	assert.Equal(t, PreflightTranscode, r.Decision)
+	assert.True(t, r.VFR)
+	assert.Equal(t, []PreflightIssue{{Check: CheckFramerate, Message: "variable framerate video"}}, r.Issues)
+}
+
+func TestPreflightError(t *testing.T) {
+	r := &PreflightReport{Decision: PreflightTranscode}
+	r.warn(CheckFramerate, "variable framerate video")
+	r.reject(CheckDuration, FailureOutOfLimits, "input is too long")
+	r.reject(CheckResolution, FailureOutOfLimits, "video is too large")
+	err := fmt.Errorf("encoder failed: %w", &PreflightError{Report: r})
+
+	assert.Equal(t, "encoder failed: input rejected: input is too long; video is too large", err.Error())
+	class, log := FailureOf(err)
+	assert.Equal(t, FailureOutOfLimits, class)
+	assert.Empty(t, log)
+	assert.False(t, class.Retriable())
+}
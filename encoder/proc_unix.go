@@ -0,0 +1,17 @@
+// +build !windows
+
+package encoder
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command run in its own process group so it can be killed along with its children.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,78 @@
+package encoder
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	ffmpegt "github.com/floostack/transcoder"
+)
+
+// Progress is a transcoding progress report.
+type Progress struct {
+	// Percent of the input processed, 0-100.
+	Percent float64
+	// Speed is the encoding speed as a multiple of realtime playback speed.
+	Speed float64
+	// Bitrate is the current output bitrate, in kbit/s.
+	Bitrate float64
+	// Frames is the number of video frames processed so far.
+	Frames int
+	// ETA is the estimated time remaining until the encoding is done, zero if not known yet.
+	ETA time.Duration
+}
+
+// GetProgress returns percent of the input processed.
+func (p Progress) GetProgress() float64 {
+	return p.Percent
+}
+
+// progressTracker turns raw ffmpeg progress reports into Progress estimates
+// for the input of `duration` seconds.
+type progressTracker struct {
+	duration float64
+	started  time.Time
+}
+
+func newProgressTracker(duration float64) *progressTracker {
+	return &progressTracker{duration: duration, started: time.Now()}
+}
+
+func (t *progressTracker) track(fp ffmpegt.Progress) Progress {
+	p := Progress{
+		Percent: math.Min(math.Max(fp.GetProgress(), 0), 100),
+		Speed:   parseSpeed(fp.GetSpeed()),
+		Bitrate: parseBitrate(fp.GetCurrentBitrate()),
+	}
+	p.Frames, _ = strconv.Atoi(strings.TrimSpace(fp.GetFramesProcessed()))
+
+	if p.Speed > 0 && t.duration > 0 {
+		remaining := t.duration * (100 - p.Percent) / 100
+		p.ETA = time.Duration(remaining / p.Speed * float64(time.Second))
+	} else if p.Percent > 0 {
+		// ffmpeg does not report speed for some outputs, extrapolate from the time spent instead.
+		elapsed := time.Since(t.started)
+		p.ETA = time.Duration(float64(elapsed) * (100 - p.Percent) / p.Percent)
+	}
+	p.ETA = p.ETA.Round(time.Second)
+	return p
+}
+
+// parseSpeed parses ffmpeg speed value like `1.52x`, returning 0 for unknown values (`N/A`).
+func parseSpeed(s string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "x"), 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
+
+// parseBitrate parses ffmpeg bitrate value like `2150.3kbits/s` into kbit/s, returning 0 for unknown values.
+func parseBitrate(s string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "kbits/s"), 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
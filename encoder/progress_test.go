@@ -0,0 +1,68 @@
+package encoder
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ffmpegt "github.com/floostack/transcoder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressTracker(t *testing.T) {
+	tr := newProgressTracker(600)
+
+	p := tr.track(ffmpegProgress{frames: "4500", time: "00:02:30.00", bitrate: "2150.3kbits/s", speed: "1.5x", progress: 25})
+	assert.EqualValues(t, 25, p.Percent)
+	assert.EqualValues(t, 1.5, p.Speed)
+	assert.EqualValues(t, 2150.3, p.Bitrate)
+	assert.Equal(t, 4500, p.Frames)
+	assert.Equal(t, 5*time.Minute, p.ETA)
+
+	tr.started = time.Now().Add(-time.Minute)
+	p = tr.track(ffmpegProgress{frames: "N/A", bitrate: "N/A", speed: "N/A", progress: 50})
+	assert.EqualValues(t, 0, p.Speed)
+	assert.EqualValues(t, 0, p.Bitrate)
+	assert.Equal(t, 0, p.Frames)
+	assert.Equal(t, time.Minute, p.ETA)
+
+	p = tr.track(ffmpegProgress{speed: "2x", progress: 104})
+	assert.EqualValues(t, 100, p.Percent)
+	assert.Equal(t, time.Duration(0), p.ETA)
+}
+
+func TestReadProgress(t *testing.T) {
+	out := `frame=240
+fps=48.00
+bitrate=1843.2kbits/s
+total_size=2304000
+out_time_us=10000000
+out_time=00:00:10.000000
+speed=1.92x
+progress=continue
+frame=480
+bitrate=N/A
+out_time_us=20000000
+out_time=00:00:20.000000
+speed=2x
+progress=end
+`
+	progress := make(chan ffmpegt.Progress)
+	go func() {
+		defer close(progress)
+		readProgress(strings.NewReader(out), 40, progress)
+	}()
+	reports := []ffmpegt.Progress{}
+	for p := range progress {
+		reports = append(reports, p)
+	}
+
+	assert.Len(t, reports, 2)
+	assert.Equal(t, "240", reports[0].GetFramesProcessed())
+	assert.Equal(t, "1843.2kbits/s", reports[0].GetCurrentBitrate())
+	assert.Equal(t, "1.92x", reports[0].GetSpeed())
+	assert.Equal(t, "00:00:10.000000", reports[0].GetCurrentTime())
+	assert.EqualValues(t, 25, reports[0].GetProgress())
+	assert.Equal(t, "480", reports[1].GetFramesProcessed())
+	assert.EqualValues(t, 100, reports[1].GetProgress())
+}
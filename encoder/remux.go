@@ -0,0 +1,156 @@
+package encoder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/lbryio/transcoder/ladder"
+)
+
+// RemuxConfig defines when the top ladder tier gets source video copied into it instead of being encoded.
+type RemuxConfig struct {
+	// MaxBitrateRatio is how far source video bitrate may go over top tier bitrate, zero disables remuxing.
+	MaxBitrateRatio float64
+	// Profiles are accepted H.264 profiles, as named by ffprobe.
+	Profiles []string
+}
+
+// DefaultRemuxConfig passes through H.264 video in 8-bit 4:2:0 profiles up to 1.5 times top tier bitrate.
+var DefaultRemuxConfig = RemuxConfig{
+	MaxBitrateRatio: 1.5,
+	Profiles:        []string{"Constrained Baseline", "Baseline", "Main", "High"},
+}
+
+// keyframeTolerance is how far source keyframes may be off encoded tier ones when frame rate is unknown, in seconds.
+// Otherwise it is one frame, as encoded keyframes are forced on the first frame past each GOP boundary.
+const keyframeTolerance = 0.04
+
+// remuxPixFmts are pixel formats of source video that can be copied into HLS output.
+var remuxPixFmts = map[string]bool{"yuv420p": true, "yuvj420p": true}
+
+// passthrough marks the top tier of `l` for copying source video into it if the source matches its constraints:
+// codec, profile, resolution, bitrate ceiling and keyframes placed every ladder.GOPDuration like in encoded tiers.
+// Only sources that passed preflight as remuxable are considered. The reason for not passing the tier through
+// is returned along with the ladder.
+func (e encoder) passthrough(ctx context.Context, input string, meta *ladder.Metadata, l ladder.Ladder) (ladder.Ladder, string) {
+	cfg := e.remux
+	if len(l.Tiers) == 0 || l.StreamType() != ladder.TypeHLS || l.AudioOnly() {
+		return l, "only hls video ladders are supported"
+	}
+	top := l.Tiers[0]
+	vs := firstStream(meta, "video")
+	switch {
+	case vs == nil:
+		return l, "no video stream"
+	case l.TierCodec(top) != ladder.CodecH264:
+		return l, fmt.Sprintf("top tier codec is %v", l.TierCodec(top))
+	case top.HDR:
+		return l, "top tier is hdr"
+	case !acceptedCodec(vs.Profile, cfg.Profiles):
+		return l, fmt.Sprintf("source profile %q is not accepted", vs.Profile)
+	case !remuxPixFmts[vs.PixFmt]:
+		return l, fmt.Sprintf("source pixel format %q is not accepted", vs.PixFmt)
+	case top.Height != meta.DisplayHeight || (top.Width != 0 && top.Width != meta.DisplayWidth):
+		return l, fmt.Sprintf("top tier is %vx%v, source is %vx%v", top.Width, top.Height, meta.DisplayWidth, meta.DisplayHeight)
+	case top.Framerate != 0 && top.Framerate != meta.IntFPS:
+		return l, fmt.Sprintf("top tier framerate is %v, source is %v", top.Framerate, meta.IntFPS)
+	}
+
+	vrate, _ := strconv.Atoi(meta.VideoStream.GetBitRate())
+	ceiling := int(float64(top.VideoBitrate) * cfg.MaxBitrateRatio)
+	if vrate <= 0 || vrate > ceiling {
+		return l, fmt.Sprintf("source bitrate %v is over %v", vrate, ceiling)
+	}
+
+	segment, _ := strconv.ParseFloat(l.SegmentDuration(), 64)
+	keyframes, err := e.probeKeyframes(ctx, input)
+	if err != nil {
+		return l, fmt.Sprintf("cannot probe keyframes: %v", err)
+	}
+	if len(keyframes) == 0 {
+		return l, "no keyframes found"
+	}
+	if gop := maxKeyframeInterval(keyframes); gop > segment {
+		return l, fmt.Sprintf("keyframe interval %.2fs is over segment duration %.2fs", gop, segment)
+	}
+	// Segments of all tiers are only cut at the same times if copied keyframes fall where encoded tiers place theirs.
+	tolerance := keyframeTolerance
+	if meta.FPS > 0 {
+		tolerance = 1 / meta.FPS
+	}
+	if !keyframesAligned(keyframes, ladder.GOPDuration, tolerance) {
+		return l, fmt.Sprintf("keyframes are not placed every %vs as in encoded tiers", ladder.GOPDuration)
+	}
+
+	tiers := make([]ladder.Tier, len(l.Tiers))
+	copy(tiers, l.Tiers)
+	tiers[0].Passthrough = true
+	tiers[0].VideoBitrate = vrate
+	l.Tiers = tiers
+	return l, ""
+}
+
+// probeKeyframes returns timestamps of source video keyframes, in seconds. Only packets are read so
+// this is much faster than decoding.
+func (e encoder) probeKeyframes(ctx context.Context, input string) ([]float64, error) {
+	cmd := exec.CommandContext(ctx, e.ffprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,flags",
+		"-of", "csv=p=0",
+		input,
+	)
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, newFFmpegError(err, errb.Bytes())
+	}
+	return parseKeyframes(out), nil
+}
+
+// parseKeyframes reads `pts_time,flags` lines of ffprobe packet listing, keeping keyframe (`K` flag) timestamps.
+func parseKeyframes(out []byte) []float64 {
+	keyframes := []float64{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ",")
+		if len(fields) < 2 || !strings.HasPrefix(fields[1], "K") {
+			continue
+		}
+		t, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		keyframes = append(keyframes, t)
+	}
+	return keyframes
+}
+
+// maxKeyframeInterval returns the longest distance between adjacent keyframes.
+func maxKeyframeInterval(keyframes []float64) float64 {
+	var gop float64
+	for i := 1; i < len(keyframes); i++ {
+		if d := keyframes[i] - keyframes[i-1]; d > gop {
+			gop = d
+		}
+	}
+	return gop
+}
+
+// keyframesAligned is true if keyframes are placed every `gop` seconds counting from the first one,
+// within `tolerance` seconds.
+func keyframesAligned(keyframes []float64, gop, tolerance float64) bool {
+	for i, t := range keyframes {
+		if math.Abs(t-keyframes[0]-float64(i)*gop) > tolerance {
+			return false
+		}
+	}
+	return true
+}
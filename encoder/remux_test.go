@@ -0,0 +1,93 @@
+package encoder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/lbryio/transcoder/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyframes(t *testing.T) {
+	out := []byte("0.000000,K__\n0.033367,___\n2.002000,K_\nN/A,K__\n\n4.004000,K__\n5.005000,__D\n")
+	keyframes := parseKeyframes(out)
+	assert.Equal(t, []float64{0, 2.002, 4.004}, keyframes)
+	assert.InDelta(t, 2.002, maxKeyframeInterval(keyframes), 0.0001)
+	assert.Equal(t, 0.0, maxKeyframeInterval([]float64{1}))
+}
+
+func TestKeyframesAligned(t *testing.T) {
+	assert.True(t, keyframesAligned([]float64{0, 2, 4, 6}, 2, 0.04))
+	assert.True(t, keyframesAligned([]float64{1.4, 3.433, 5.4}, 2, 0.04))
+	assert.False(t, keyframesAligned([]float64{0, 2.5, 5, 7.5}, 2, 0.04))
+	assert.False(t, keyframesAligned([]float64{0, 2, 3, 4}, 2, 0.04))
+	// 60 frame GOP of 29.97 fps source drifts away from 2 second boundaries.
+	drifting := []float64{}
+	for i := 0; i < 30; i++ {
+		drifting = append(drifting, float64(i)*2.002)
+	}
+	assert.False(t, keyframesAligned(drifting, 2, 1/29.97))
+}
+
+func remuxProbe(w, h, bitrate int, profile, pixFmt string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "profile": "%v", "pix_fmt": "%v",
+				"width": %v, "height": %v, "avg_frame_rate": "30/1", "r_frame_rate": "30/1", "bit_rate": "%v"},
+			{"index": 1, "codec_type": "audio", "codec_name": "aac"}
+		],
+		"format": {"duration": "60.0"}
+	}`, profile, pixFmt, w, h, bitrate))
+}
+
+func TestPassthrough(t *testing.T) {
+	// Fake ffprobe lists keyframes 2 seconds apart.
+	ffprobe := path.Join(t.TempDir(), "ffprobe")
+	script := "#!/bin/sh\nfor t in 0 2 4 6; do echo \"$t.000000,K__\"; echo \"$t.500000,___\"; done\n"
+	require.NoError(t, os.WriteFile(ffprobe, []byte(script), 0755))
+	e := encoder{&Configuration{ffprobePath: ffprobe, remux: DefaultRemuxConfig, log: logging.NoopKVLogger{}}}
+
+	testCases := []struct {
+		name    string
+		probe   []byte
+		reason  string
+		bitrate int
+	}{
+		{"compatible", remuxProbe(1920, 1080, 4000_000, "High", "yuv420p"), "", 4000_000},
+		{"bitrate", remuxProbe(1920, 1080, 8000_000, "High", "yuv420p"), "source bitrate 8000000 is over 5250000", 3500_000},
+		{"profile", remuxProbe(1920, 1080, 4000_000, "High 10", "yuv420p10le"), `source profile "High 10" is not accepted`, 3500_000},
+		{"pixfmt", remuxProbe(1920, 1080, 4000_000, "High", "yuv444p"), `source pixel format "yuv444p" is not accepted`, 3500_000},
+		{"resolution", remuxProbe(1280, 720, 2000_000, "Main", "yuv420p"), "top tier is 1920x1080, source is 1280x720", 3500_000},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			meta, err := ladder.WrapProbe(tc.probe)
+			require.NoError(t, err)
+			l, reason := e.passthrough(context.Background(), "input.mp4", meta, ladder.Default)
+			assert.Equal(t, tc.reason, reason)
+			assert.Equal(t, tc.reason == "", l.Tiers[0].Passthrough)
+			assert.Equal(t, tc.bitrate, l.Tiers[0].VideoBitrate)
+			assert.False(t, ladder.Default.Tiers[0].Passthrough)
+		})
+	}
+
+	// Keyframes are further apart than ladder segment duration.
+	l := ladder.Default
+	l.Args = map[string]string{"hls_time": "1"}
+	meta, err := ladder.WrapProbe(remuxProbe(1920, 1080, 4000_000, "High", "yuv420p"))
+	require.NoError(t, err)
+	_, reason := e.passthrough(context.Background(), "input.mp4", meta, l)
+	assert.Equal(t, "keyframe interval 2.00s is over segment duration 1.00s", reason)
+
+	// Keyframes are within segment duration but do not match encoded tiers GOP.
+	script = "#!/bin/sh\nfor t in 0 2.5 5 7.5; do echo \"$t,K__\"; done\n"
+	require.NoError(t, os.WriteFile(ffprobe, []byte(script), 0755))
+	l, reason = e.passthrough(context.Background(), "input.mp4", meta, ladder.Default)
+	assert.Equal(t, "keyframes are not placed every 2s as in encoded tiers", reason)
+	assert.False(t, l.Tiers[0].Passthrough)
+}
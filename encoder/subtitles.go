@@ -0,0 +1,155 @@
+package encoder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/pkg/errors"
+)
+
+const (
+	subtitlesGroupID      = "subs"
+	subtitlePlaylistName  = "sub_%v.m3u8"
+	subtitleSegmentName   = "sub_%v_%%05d.vtt"
+	subtitleMediaTemplate = `#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="%v",NAME="%v",%vDEFAULT=%v,AUTOSELECT=%v,FORCED=%v,URI="%v"`
+)
+
+// sidecarSubtitleExts are extensions of subtitle files that are picked up from the input file directory.
+var sidecarSubtitleExts = map[string]bool{
+	".srt": true,
+	".vtt": true,
+	".ass": true,
+	".ssa": true,
+}
+
+// findSidecarSubtitles looks up subtitle files named after the input file, with an optional language code
+// before the extension: `video.srt`, `video.en.srt`, `video.spa.vtt`.
+func findSidecarSubtitles(input string) ([]ladder.SubtitleTrack, error) {
+	base := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	entries, err := os.ReadDir(filepath.Dir(input))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		if e.IsDir() || !sidecarSubtitleExts[strings.ToLower(filepath.Ext(e.Name()))] {
+			continue
+		}
+		if !strings.HasPrefix(e.Name(), base+".") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	tracks := []ladder.SubtitleTrack{}
+	for i, n := range names {
+		lang := strings.TrimPrefix(strings.TrimSuffix(n, filepath.Ext(n)), base)
+		lang = strings.TrimPrefix(lang, ".")
+		t := ladder.SubtitleTrack{File: filepath.Join(filepath.Dir(input), n), Language: lang, Name: lang}
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("Subtitles %v", i+1)
+		}
+		tracks = append(tracks, t)
+	}
+	return tracks, nil
+}
+
+// extractSubtitles converts subtitle tracks into segmented WebVTT, each track getting its own media playlist.
+// Tracks are expected to come from subtitleTracks.
+func (e encoder) extractSubtitles(ctx context.Context, input, output, segmentDuration string, tracks []ladder.SubtitleTrack) error {
+	for n, t := range tracks {
+		src, stream := input, "0:s:"+strconv.Itoa(t.Index)
+		if t.File != "" {
+			src, stream = t.File, "0:s:0"
+		}
+		cmd := exec.CommandContext(ctx, e.ffmpegPath,
+			"-y", "-v", "error",
+			"-i", src,
+			"-map", stream,
+			"-c:s", "webvtt",
+			"-f", "segment",
+			"-segment_format", "webvtt",
+			"-segment_time", segmentDuration,
+			"-segment_list", path.Join(output, t.URI),
+			"-segment_list_type", "m3u8",
+			path.Join(output, fmt.Sprintf(subtitleSegmentName, n)),
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("cannot extract subtitles from %v (%v): %w: %s", src, stream, err, out)
+		}
+	}
+	return nil
+}
+
+// addSubtitleRenditions lists subtitle tracks in HLS master playlist as EXT-X-MEDIA renditions
+// and references them from every variant stream.
+func addSubtitleRenditions(masterPath string, tracks []ladder.SubtitleTrack) error {
+	err := rewriteMasterPlaylist(masterPath, func(inf, uri string) (string, error) {
+		return setPlaylistAttr(inf, "SUBTITLES", `"`+subtitlesGroupID+`"`), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(masterPath)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+
+	media := []string{}
+	for _, t := range tracks {
+		var lang string
+		if t.Language != "" {
+			lang = fmt.Sprintf(`LANGUAGE="%v",`, t.Language)
+		}
+		media = append(media, fmt.Sprintf(subtitleMediaTemplate,
+			subtitlesGroupID, strings.ReplaceAll(t.Name, `"`, `'`), lang,
+			yesNo(t.Default), yesNo(t.Default || !t.Forced), yesNo(t.Forced), t.URI))
+	}
+
+	out := []string{}
+	inserted := false
+	for _, l := range lines {
+		if !inserted && strings.HasPrefix(l, streamInfTag) {
+			out = append(out, media...)
+			inserted = true
+		}
+		out = append(out, l)
+	}
+	if !inserted {
+		return errors.New("no variant streams found in master playlist")
+	}
+	return os.WriteFile(masterPath, []byte(strings.Join(out, "\n")+"\n"), os.ModePerm)
+}
+
+// subtitleTracks collects embedded and sidecar subtitles for the input and assigns them output playlist names.
+func (e encoder) subtitleTracks(input string, meta *ladder.Metadata) []ladder.SubtitleTrack {
+	tracks := meta.SubtitleTracks()
+	sidecars, err := findSidecarSubtitles(input)
+	if err != nil {
+		e.log.Warn("cannot look up sidecar subtitles", "input", input, "err", err)
+	}
+	tracks = append(tracks, sidecars...)
+	for i := range tracks {
+		tracks[i].URI = fmt.Sprintf(subtitlePlaylistName, i)
+	}
+	return tracks
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "YES"
+	}
+	return "NO"
+}
@@ -0,0 +1,57 @@
+package encoder
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindSidecarSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{"video.mp4", "video.srt", "video.spa.vtt", "video.en.ASS", "video.txt", "other.en.srt"} {
+		require.NoError(t, os.WriteFile(path.Join(dir, n), []byte{}, os.ModePerm))
+	}
+
+	tracks, err := findSidecarSubtitles(path.Join(dir, "video.mp4"))
+	require.NoError(t, err)
+	assert.Equal(t, []ladder.SubtitleTrack{
+		{File: path.Join(dir, "video.en.ASS"), Language: "en", Name: "en"},
+		{File: path.Join(dir, "video.spa.vtt"), Language: "spa", Name: "spa"},
+		{File: path.Join(dir, "video.srt"), Name: "Subtitles 3"},
+	}, tracks)
+}
+
+func TestAddSubtitleRenditions(t *testing.T) {
+	masterPath := path.Join(t.TempDir(), MasterPlaylist)
+	require.NoError(t, os.WriteFile(masterPath, []byte(`#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=3960000,RESOLUTION=1920x1080
+v0.m3u8
+
+#EXT-X-STREAM-INF:BANDWIDTH=2970000,RESOLUTION=1280x720
+v1.m3u8
+`), os.ModePerm))
+
+	err := addSubtitleRenditions(masterPath, []ladder.SubtitleTrack{
+		{Language: "eng", Name: `English "SDH"`, Default: true, URI: "sub_0.m3u8"},
+		{Name: "Subtitles 2", Forced: true, URI: "sub_1.m3u8"},
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(masterPath)
+	require.NoError(t, err)
+	assert.Equal(t, `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English 'SDH'",LANGUAGE="eng",DEFAULT=YES,AUTOSELECT=YES,FORCED=NO,URI="sub_0.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Subtitles 2",DEFAULT=NO,AUTOSELECT=NO,FORCED=YES,URI="sub_1.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=3960000,RESOLUTION=1920x1080,SUBTITLES="subs"
+v0.m3u8
+
+#EXT-X-STREAM-INF:BANDWIDTH=2970000,RESOLUTION=1280x720,SUBTITLES="subs"
+v1.m3u8
+`, string(data))
+}
@@ -1,37 +1,144 @@
 package encoder
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"os"
 	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ThumbnailsVTT is the name of seek preview thumbnails index. Result.Thumbnails lists it first,
+	// followed by sprite sheets it references.
+	ThumbnailsVTT = "thumbnails.vtt"
+
+	thumbnailSpriteName    = "thumbnails_%03d.jpg"
+	thumbnailSpritePrefix  = "thumbnails_"
+	thumbnailSpriteQuality = "4" // mjpeg qscale, lower is better
 )
 
-const interval = "2" // seconds
-const width = "300"
-const height = "200"
-const columns = "10"
+// ThumbnailsConfig defines how seek preview thumbnails are produced.
+type ThumbnailsConfig struct {
+	// Interval is the time between thumbnails.
+	Interval time.Duration
+	// Width of a single thumbnail, height follows video display aspect ratio.
+	Width int
+	// Columns and Rows define how many thumbnails a single sprite sheet holds.
+	Columns, Rows int
+}
+
+// DefaultThumbnailsConfig produces a 300px wide thumbnail every 2 seconds, 100 thumbnails per sprite sheet.
+var DefaultThumbnailsConfig = ThumbnailsConfig{
+	Interval: 2 * time.Second,
+	Width:    300,
+	Columns:  10,
+	Rows:     10,
+}
+
+// thumbnailSheet describes sprite sheet layout for a particular video.
+type thumbnailSheet struct {
+	ThumbnailsConfig
+	height int
+}
+
+// generateThumbnails makes sprite sheets of thumbnails taken every config.Interval seconds of the input
+// and a WebVTT index referencing them with media fragment coordinates (`#xywh=`), as used by players
+// for seek previews. Names of the created files are returned, WebVTT index being the first.
+func (e encoder) generateThumbnails(ctx context.Context, input, output string, meta *ladder.Metadata) ([]string, error) {
+	cfg := e.thumbnails
+	dur, err := strconv.ParseFloat(meta.FMeta.GetFormat().GetDuration(), 64)
+	if err != nil || dur <= 0 {
+		return nil, fmt.Errorf("cannot determine media duration: %v", meta.FMeta.GetFormat().GetDuration())
+	}
+	if meta.DisplayWidth == 0 || meta.DisplayHeight == 0 {
+		return nil, errors.New("cannot determine video dimensions")
+	}
+	sheet := thumbnailSheet{
+		ThumbnailsConfig: cfg,
+		height:           2 * int(math.Round(float64(cfg.Width)*float64(meta.DisplayHeight)/float64(meta.DisplayWidth)/2)),
+	}
+
+	cmd := exec.CommandContext(ctx, e.ffmpegPath,
+		"-y", "-v", "error",
+		"-i", input,
+		"-map", "v:0",
+		"-an", "-sn",
+		"-vf", sheet.filter(),
+		"-q:v", thumbnailSpriteQuality,
+		path.Join(output, thumbnailSpriteName),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("cannot generate thumbnails: %w: %s", err, out)
+	}
 
-type ThumbnailGenerator struct {
-	cmdPath string
-	args    []string
+	sprites, err := findSprites(output)
+	if err != nil {
+		return nil, err
+	}
+	if len(sprites) == 0 {
+		return nil, errors.New("no thumbnail sprites generated")
+	}
+	vtt := sheet.vtt(dur, sprites)
+	if err := os.WriteFile(path.Join(output, ThumbnailsVTT), []byte(vtt), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return append([]string{ThumbnailsVTT}, sprites...), nil
 }
 
-type ThumbnailGeneratorProgress struct {
+// filter returns ffmpeg filter chain that samples, scales and tiles thumbnails into sprite sheets.
+func (s thumbnailSheet) filter() string {
+	return fmt.Sprintf("fps=1/%v,scale=%v:%v,setsar=1,tile=%vx%v",
+		s.Interval.Seconds(), s.Width, s.height, s.Columns, s.Rows)
 }
 
-func NewThumbnailGenerator(cmdPath string) (*ThumbnailGenerator, error) {
-	cmd := exec.Command(cmdPath, "-h")
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("unable to execute generator: %w", err)
+// vtt returns WebVTT index of thumbnails for the video of `duration` seconds.
+// Cues pointing past the last sprite sheet are omitted.
+func (s thumbnailSheet) vtt(duration float64, sprites []string) string {
+	perSheet := s.Columns * s.Rows
+	interval := s.Interval.Seconds()
+	b := &strings.Builder{}
+	b.WriteString("WEBVTT\n")
+	for i := 0; float64(i)*interval < duration; i++ {
+		n := i / perSheet
+		if n >= len(sprites) {
+			break
+		}
+		start := float64(i) * interval
+		end := math.Min(start+interval, duration)
+		pos := i % perSheet
+		fmt.Fprintf(b, "\n%v --> %v\n%v#xywh=%v,%v,%v,%v\n",
+			vttTimestamp(start), vttTimestamp(end), sprites[n],
+			(pos%s.Columns)*s.Width, (pos/s.Columns)*s.height, s.Width, s.height)
 	}
-	return &ThumbnailGenerator{cmdPath, []string{interval, width, height, columns}}, nil
+	return b.String()
 }
 
-func (g ThumbnailGenerator) Generate(input, output string) error {
-	args := append([]string{input}, g.args...)
-	args = append(args, output)
-	_, err := exec.Command(g.cmdPath, args...).Output()
+func findSprites(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	sprites := []string{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), thumbnailSpritePrefix) && path.Ext(e.Name()) == ".jpg" {
+			sprites = append(sprites, e.Name())
+		}
 	}
-	return nil
+	sort.Strings(sprites)
+	return sprites, nil
+}
+
+// vttTimestamp formats seconds as WebVTT timestamp (hh:mm:ss.ttt).
+func vttTimestamp(sec float64) string {
+	ms := int64(math.Round(sec * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600_000, ms/60_000%60, ms/1000%60, ms%1000)
 }
@@ -0,0 +1,56 @@
+package encoder
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThumbnailSheet(t *testing.T) {
+	s := thumbnailSheet{
+		ThumbnailsConfig: ThumbnailsConfig{Interval: 2 * time.Second, Width: 160, Columns: 2, Rows: 2},
+		height:           90,
+	}
+	assert.Equal(t, "fps=1/2,scale=160:90,setsar=1,tile=2x2", s.filter())
+
+	assert.Equal(t, `WEBVTT
+
+00:00:00.000 --> 00:00:02.000
+thumbnails_001.jpg#xywh=0,0,160,90
+
+00:00:02.000 --> 00:00:04.000
+thumbnails_001.jpg#xywh=160,0,160,90
+
+00:00:04.000 --> 00:00:06.000
+thumbnails_001.jpg#xywh=0,90,160,90
+
+00:00:06.000 --> 00:00:08.000
+thumbnails_001.jpg#xywh=160,90,160,90
+
+00:00:08.000 --> 00:00:09.500
+thumbnails_002.jpg#xywh=0,0,160,90
+`, s.vtt(9.5, []string{"thumbnails_001.jpg", "thumbnails_002.jpg"}))
+
+	// Cues beyond generated sprite sheets are dropped.
+	assert.NotContains(t, s.vtt(9.5, []string{"thumbnails_001.jpg"}), "00:00:08.000 -->")
+}
+
+func TestVTTTimestamp(t *testing.T) {
+	assert.Equal(t, "00:00:00.000", vttTimestamp(0))
+	assert.Equal(t, "00:01:05.250", vttTimestamp(65.25))
+	assert.Equal(t, "01:02:03.004", vttTimestamp(3723.004))
+}
+
+func TestFindSprites(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{"thumbnails_002.jpg", "thumbnails_001.jpg", "thumbnails.vtt", "v0.m3u8"} {
+		require.NoError(t, os.WriteFile(path.Join(dir, n), []byte{}, os.ModePerm))
+	}
+	sprites, err := findSprites(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"thumbnails_001.jpg", "thumbnails_002.jpg"}, sprites)
+}
@@ -0,0 +1,22 @@
+package encoder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/lbryio/transcoder/ladder"
+)
+
+// runFirstPass runs the first encoding pass for two-pass ladder tiers. It produces no output
+// except for pass log files in args.PassLogDir, which the main transcoding picks up.
+func (e encoder) runFirstPass(ctx context.Context, input string, args *ladder.ArgumentSet) error {
+	cmdArgs := append([]string{"-y", "-v", "error", "-i", input}, args.FirstPassArguments()...)
+	cmdArgs = append(cmdArgs, os.DevNull)
+	cmd := exec.CommandContext(ctx, e.ffmpegPath, cmdArgs...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("first pass failed: %w", newFFmpegError(err, out))
+	}
+	return nil
+}
@@ -2,19 +2,41 @@ package ladder
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 const (
 	MasterPlaylist     = "master.m3u8"
+	DASHManifest       = "manifest.mpd"
 	preset             = "veryfast"
 	videoCodec         = "libx264"
 	constantRateFactor = "26"
 	hlsTime            = "10"
+
+	defaultAudioBitrate = "128k"
+	audioGroupName      = "audio"
+
+	// GOPDuration is the keyframe interval of encoded video tiers, in seconds.
+	GOPDuration = 2
 )
 
 const (
-	argVarStreamMap = "var_stream_map"
+	argVarStreamMap   = "var_stream_map"
+	argHLSTime        = "hls_time"
+	argSegDuration    = "seg_duration"
+	argHLSPlaylist    = "hls_playlist"
+	argHLSSegmentType = "hls_segment_type"
+	argHLSSegmentName = "hls_segment_filename"
+	argHLSInitName    = "hls_fmp4_init_filename"
+	argAdaptationSets = "adaptation_sets"
+	hlsArgumentPrefix = "hls_"
+
+	hlsOutputName      = "v%v.m3u8"
+	hlsFMP4SegmentName = "v%v_s%06d.m4s"
+	hlsFMP4InitName    = "init_%v.mp4"
 )
 
 type ArgumentSet struct {
@@ -22,8 +44,21 @@ type ArgumentSet struct {
 	Ladder    Ladder
 	Arguments map[string]string
 	Meta      *Metadata
+	// PassLogDir is where two-pass tiers keep their first pass statistics, output directory by default.
+	PassLogDir string
+	// PreencodedAudio is set when output audio streams have been encoded beforehand with AudioArguments.
+	// Input audio streams are then copied into output ones in the same order.
+	PreencodedAudio bool
+}
+
+// audioOutput is an output audio stream along with its source stream.
+type audioOutput struct {
+	source, bitrate string
 }
 
+// audioEncodingArguments are output-wide options which only apply to encoded audio.
+var audioEncodingArguments = []string{"c:a", "ac", "ar"}
+
 var hlsDefaultArguments = map[string]string{
 	"preset":               preset,
 	"sc_threshold":         "0",
@@ -42,41 +77,260 @@ var hlsDefaultArguments = map[string]string{
 	"hls_segment_filename": "v%v_s%06d.ts",
 }
 
+var dashDefaultArguments = map[string]string{
+	"preset":          preset,
+	"sc_threshold":    "0",
+	"c:v":             "libx264",
+	"pix_fmt":         "yuv420p",
+	"crf":             constantRateFactor,
+	"c:a":             "aac",
+	"ac":              "2",
+	"ar":              "44100",
+	"f":               "dash",
+	"seg_duration":    hlsTime,
+	"use_template":    "1",
+	"use_timeline":    "1",
+	"init_seg_name":   "init_$RepresentationID$.mp4",
+	"media_seg_name":  "chunk_$RepresentationID$_$Number%05d$.m4s",
+	"adaptation_sets": "id=0,streams=v id=1,streams=a",
+}
+
+// cmafDefaultArguments make dash muxer write HLS playlists in addition to DASH manifest,
+// both referencing the same set of fMP4 segments.
+var cmafDefaultArguments = func() map[string]string {
+	args := map[string]string{}
+	for k, v := range dashDefaultArguments {
+		args[k] = v
+	}
+	args[argHLSPlaylist] = "1"
+	return args
+}()
+
 // GetStrArguments serializes ffmpeg arguments in a format sutable for ffmpeg.Transcoder.Start.
 func (a *ArgumentSet) GetStrArguments() []string {
-	strArgs := []string{}
+	args, _ := a.outputArguments(false)
+	return args
+}
+
+// AudioArguments returns ffmpeg arguments for encoding every output audio stream of the ladder in one go,
+// without video. The caller should append an output file, which is to be used as audio input with PreencodedAudio.
+func (a *ArgumentSet) AudioArguments() []string {
+	base := a.baseArguments()
+	args := []string{"-vn", "-sn", "-dn"}
+	for _, k := range audioEncodingArguments {
+		if v, ok := base[k]; ok {
+			args = append(args, "-"+k, v)
+		}
+	}
+	_, outputs := a.outputArguments(false)
+	for n, o := range outputs {
+		args = append(args, "-map", o.source, "-b:a:"+strconv.Itoa(n), o.bitrate)
+	}
+	return args
+}
 
-	args := a.Arguments
+// outputArguments lays out output streams for the main transcoding or, if `firstPass` is set, for the first pass
+// of two-pass tiers. Both passes map the same streams in the same order, as ffmpeg names pass log files
+// after output stream indexes. Streams which are not needed in the first pass are copied.
+// Output audio streams are returned in their order as well.
+func (a *ArgumentSet) outputArguments(firstPass bool) ([]string, []audioOutput) {
+	args := a.baseArguments()
 	ladArgs := []string{}
-	args[argVarStreamMap] = ""
+	outputs := []audioOutput{}
+	mapAudio := func(source, s, bitrate string) {
+		outputs = append(outputs, audioOutput{source: source, bitrate: bitrate})
+		switch {
+		case firstPass:
+			ladArgs = append(ladArgs, "-map", source, "-c:a:"+s, "copy")
+		case a.PreencodedAudio:
+			ladArgs = append(ladArgs, "-map", "a:"+s, "-c:a:"+s, "copy")
+		default:
+			ladArgs = append(ladArgs, "-map", source, "-b:a:"+s, bitrate)
+		}
+	}
+	dash := a.Ladder.dashMuxed()
 
-	for k, v := range a.Ladder.Args {
-		args[k] = v
+	hasAudio := a.Meta.HasAudio()
+	audioOnly := a.Ladder.AudioOnly()
+	tracks := a.Meta.AudioTracks()
+	// Multiple source audio tracks can only be represented as alternative renditions.
+	audioGroup := hasAudio && !audioOnly && (a.Ladder.AudioGroup || len(tracks) > 1)
+	defaultTrack := "a:" + strconv.Itoa(a.Meta.defaultAudioTrack())
+	streamMap := []string{}
+
+	if dash {
+		switch {
+		case audioOnly:
+			args[argAdaptationSets] = "id=0,streams=a"
+		case !hasAudio:
+			args[argAdaptationSets] = "id=0,streams=v"
+		}
 	}
 
 	for n, tier := range a.Ladder.Tiers {
 		s := strconv.Itoa(n)
-		args[argVarStreamMap] += fmt.Sprintf("v:%s,a:%s ", s, s)
 
-		ladArgs = append(ladArgs,
-			"-map", "v:0",
-			"-filter:v:"+s, "scale=-2:"+strconv.Itoa(tier.Height),
-			"-maxrate:"+s, strconv.Itoa(tier.VideoBitrate),
-			"-bufsize:"+s, strconv.Itoa(tier.VideoBitrate),
-		)
+		if audioOnly {
+			streamMap = append(streamMap, "a:"+s)
+			mapAudio(defaultTrack, s, tier.AudioBitrate)
+			continue
+		}
 
-		if tier.Framerate != 0 {
-			ladArgs = append(ladArgs, "-r:"+s, strconv.Itoa(tier.Framerate), "-g:"+s, strconv.Itoa(tier.Framerate*2))
+		ladArgs = append(ladArgs, "-map", "v:0")
+		if firstPass && !tierTwoPass(tier) {
+			ladArgs = append(ladArgs, "-c:v:"+s, "copy")
 		} else {
-			ladArgs = append(ladArgs, "-g:"+s, strconv.Itoa(a.Meta.IntFPS*2))
+			ladArgs = append(ladArgs, a.videoArguments(tier, s)...)
+			ladArgs = append(ladArgs, a.rateControlArguments(tier, n, s, firstPass)...)
+		}
+
+		switch {
+		case audioGroup:
+			streamMap = append(streamMap, fmt.Sprintf("v:%s,agroup:%s", s, audioGroupName))
+		case hasAudio:
+			streamMap = append(streamMap, fmt.Sprintf("v:%s,a:%s", s, s))
+			mapAudio(defaultTrack, s, tier.AudioBitrate)
+		default:
+			streamMap = append(streamMap, "v:"+s)
+		}
+	}
+
+	if audioGroup && len(a.Ladder.Tiers) > 0 {
+		for n, t := range tracks {
+			s := strconv.Itoa(n)
+			rendition := []string{"a:" + s, "agroup:" + audioGroupName}
+			if t.Language != "" {
+				rendition = append(rendition, "language:"+varStreamMapValue(t.Language))
+				ladArgs = append(ladArgs, "-metadata:s:a:"+s, "language="+t.Language)
+			}
+			rendition = append(rendition, "name:"+varStreamMapValue(t.Name))
+			if t.Default {
+				rendition = append(rendition, "default:yes")
+			}
+			streamMap = append(streamMap, strings.Join(rendition, ","))
+			mapAudio("a:"+strconv.Itoa(t.Index), s, a.Ladder.Tiers[0].AudioBitrate)
+		}
+	}
+
+	if firstPass {
+		for k := range args {
+			if muxerArguments[k] || strings.HasPrefix(k, hlsArgumentPrefix) {
+				delete(args, k)
+			}
+		}
+		return append(append(argumentList(args), ladArgs...), "-f", "null"), outputs
+	}
+	if a.PreencodedAudio {
+		for _, k := range audioEncodingArguments {
+			delete(args, k)
 		}
+	}
 
-		ladArgs = append(ladArgs, "-map", "a:0", "-b:"+s, tier.AudioBitrate)
+	if !dash {
+		args[argVarStreamMap] = strings.Join(streamMap, " ")
+	} else if audioGroup && len(tracks) > 1 {
+		// Each language goes into its own adaptation set, audio output streams follow video ones.
+		sets := []string{"id=0,streams=v"}
+		for n := range tracks {
+			sets = append(sets, fmt.Sprintf("id=%v,streams=%v", n+1, len(a.Ladder.Tiers)+n))
+		}
+		args[argAdaptationSets] = strings.Join(sets, " ")
 	}
 
-	for k, v := range args {
-		strArgs = append(strArgs, fmt.Sprintf("-%v", k), v)
+	return append(argumentList(args), ladArgs...), outputs
+}
+
+// baseArguments returns output-wide ffmpeg options: format defaults overridden by ladder arguments.
+func (a *ArgumentSet) baseArguments() map[string]string {
+	// Copying so per-ladder tweaks don't leak into the shared defaults.
+	args := make(map[string]string, len(a.Arguments))
+	for k, v := range a.Arguments {
+		args[k] = v
+	}
+	dash := a.Ladder.dashMuxed()
+
+	if !dash && a.Ladder.FragmentedMP4() {
+		args[argHLSSegmentType] = "fmp4"
+		args[argHLSSegmentName] = hlsFMP4SegmentName
+		args[argHLSInitName] = hlsFMP4InitName
+	}
+
+	for k, v := range a.Ladder.Args {
+		if dash {
+			if k == argHLSTime {
+				k = argSegDuration
+			} else if strings.HasPrefix(k, hlsArgumentPrefix) && k != argHLSPlaylist {
+				continue
+			}
+		}
+		args[k] = v
+	}
+	return args
+}
+
+// videoArguments returns encoding and filtering options for output video stream with the index of `s`,
+// except for rate control ones.
+func (a *ArgumentSet) videoArguments(tier Tier, s string) []string {
+	if tier.Passthrough {
+		return []string{"-c:v:" + s, "copy"}
+	}
+	args := codecArguments(a.Ladder.TierCodec(tier), s, TierRateControl(tier) == RateControlCRF)
+	filter, colorArgs := colorArguments(a.Meta, tier, s, a.scaleFilter(tier))
+	args = append(args, colorArgs...)
+	args = append(args, "-filter:v:"+s, filter)
+
+	if tier.Framerate != 0 {
+		args = append(args, "-r:"+s, strconv.Itoa(tier.Framerate), "-g:"+s, strconv.Itoa(tier.Framerate*GOPDuration))
+	} else {
+		args = append(args, "-g:"+s, strconv.Itoa(a.Meta.IntFPS*GOPDuration))
+	}
+	return args
+}
+
+// argumentList serializes options map into a list of ffmpeg arguments,
+// sorted for the command line to be reproducible.
+func argumentList(args map[string]string) []string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := []string{}
+	for _, k := range keys {
+		list = append(list, fmt.Sprintf("-%v", k), args[k])
+	}
+	return list
+}
+
+// OutputName returns the name of the file ffmpeg should be writing its output to,
+// relative to the output directory.
+func (a *ArgumentSet) OutputName() string {
+	if a.Ladder.dashMuxed() {
+		return DASHManifest
+	}
+	return hlsOutputName
+}
+
+// AudioTracks returns source audio tracks that are going to be included into the output.
+func (a *ArgumentSet) AudioTracks() []AudioTrack {
+	tracks := a.Meta.AudioTracks()
+	if len(tracks) > 1 && !a.Ladder.AudioOnly() {
+		return tracks
+	}
+	for _, t := range tracks {
+		if t.Default {
+			return []AudioTrack{t}
+		}
+	}
+	return nil
+}
+
+// scaleFilter returns scaling filter for the tier. Anamorphic video is scaled to its display aspect ratio
+// with square pixels, as not all players respect sample aspect ratio.
+func (a *ArgumentSet) scaleFilter(tier Tier) string {
+	if !a.Meta.Anamorphic() || a.Meta.DisplayHeight == 0 {
+		return "scale=-2:" + strconv.Itoa(tier.Height)
 	}
-	strArgs = append(strArgs, ladArgs...)
-	return strArgs
+	w := even(int(math.Round(float64(tier.Height) * float64(a.Meta.DisplayWidth) / float64(a.Meta.DisplayHeight))))
+	return fmt.Sprintf("scale=%v:%v,setsar=1", w, tier.Height)
 }
@@ -0,0 +1,58 @@
+package ladder
+
+import "sort"
+
+// Video encoders that ladder tiers can be transcoded with.
+const (
+	CodecH264   = "libx264"
+	CodecHEVC   = "libx265"
+	CodecAV1    = "libsvtav1"
+	CodecAV1AOM = "libaom-av1"
+)
+
+// codecDefaults are encoder options applied to each video stream transcoded with a particular codec.
+// They take precedence over ladder-wide arguments, which are mostly tuned for libx264.
+var codecDefaults = map[string]map[string]string{
+	CodecH264: {},
+	CodecHEVC: {
+		"preset":      "fast",
+		"crf":         "28",
+		"tag":         "hvc1", // Apple players refuse to play hev1-tagged streams
+		"x265-params": "log-level=error",
+	},
+	CodecAV1: {
+		"preset": "8",
+		"crf":    "35",
+	},
+	CodecAV1AOM: {
+		"cpu-used": "6",
+		"row-mt":   "1",
+		"crf":      "34",
+	},
+}
+
+// IsSupportedCodec checks if video codec can be used in ladder tiers.
+func IsSupportedCodec(codec string) bool {
+	_, ok := codecDefaults[codec]
+	return ok
+}
+
+// codecArguments returns codec-specific encoder options for output video stream with the index of `s`.
+// Default constant rate factor is omitted unless `crf` is set.
+func codecArguments(codec, s string, crf bool) []string {
+	opts := codecDefaults[codec]
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		if k == "crf" && !crf {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := []string{"-c:v:" + s, codec}
+	for _, k := range keys {
+		args = append(args, "-"+k+":v:"+s, opts[k])
+	}
+	return args
+}
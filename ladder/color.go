@@ -0,0 +1,78 @@
+package ladder
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dynamic range of video streams, named after VIDEO-RANGE values of HLS master playlist.
+const (
+	VideoRangeSDR = "SDR"
+	VideoRangePQ  = "PQ"  // HDR10, SMPTE ST 2084
+	VideoRangeHLG = "HLG" // ARIB STD-B67
+)
+
+// toneMapFilter converts HDR video into SDR BT.709, needs ffmpeg built with zimg.
+const toneMapFilter = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709," +
+	"tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+
+var colorTransfers = map[string]string{
+	"smpte2084":    VideoRangePQ,
+	"arib-std-b67": VideoRangeHLG,
+}
+
+// detectColor fills in dynamic range and bit depth of the video stream.
+func (m *Metadata) detectColor() {
+	m.VideoRange = VideoRangeSDR
+	m.BitDepth = 8
+	for _, s := range m.Streams {
+		if s.CodecType != "video" {
+			continue
+		}
+		if r, ok := colorTransfers[s.ColorTransfer]; ok {
+			m.VideoRange = r
+		}
+		if d, err := strconv.Atoi(s.BitsPerRawSample); err == nil && d > 0 {
+			m.BitDepth = d
+		} else if strings.Contains(s.PixFmt, "10") {
+			m.BitDepth = 10
+		} else if strings.Contains(s.PixFmt, "12") {
+			m.BitDepth = 12
+		}
+		return
+	}
+}
+
+// HDR is true for video with high dynamic range (HDR10 or HLG).
+func (m *Metadata) HDR() bool {
+	return m.VideoRange == VideoRangePQ || m.VideoRange == VideoRangeHLG
+}
+
+// colorArguments returns arguments for output video stream with the index of `s` that either preserve
+// source HDR (for tiers that opted in) or tone-map it to SDR. Scaling filter is passed in as `scale`
+// and the resulting filter chain is returned in place of it.
+func colorArguments(meta *Metadata, tier Tier, s, scale string) (string, []string) {
+	if !meta.HDR() {
+		return scale, nil
+	}
+	if !tier.HDR {
+		return toneMapFilter + "," + scale, []string{
+			"-color_primaries:v:" + s, "bt709",
+			"-color_trc:v:" + s, "bt709",
+			"-colorspace:v:" + s, "bt709",
+		}
+	}
+
+	transfer := "smpte2084"
+	if meta.VideoRange == VideoRangeHLG {
+		transfer = "arib-std-b67"
+	}
+	return scale, []string{
+		"-pix_fmt:v:" + s, "yuv420p10le",
+		"-profile:v:" + s, "main10",
+		"-x265-params:v:" + s, "log-level=error:hdr-opt=1:repeat-headers=1:colorprim=bt2020:transfer=" + transfer + ":colormatrix=bt2020nc",
+		"-color_primaries:v:" + s, "bt2020",
+		"-color_trc:v:" + s, transfer,
+		"-colorspace:v:" + s, "bt2020nc",
+	}
+}
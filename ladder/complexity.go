@@ -0,0 +1,41 @@
+package ladder
+
+import "math"
+
+const (
+	// MinComplexity and MaxComplexity limit how far content complexity can move tier bitrates
+	// away from the ones defined in the ladder.
+	MinComplexity = 0.3
+	MaxComplexity = 1.6
+
+	minTierBitrate     = 64_000
+	minTierBitrateStep = 400_000
+)
+
+// Adapt returns a ladder with tier bitrates scaled according to content complexity,
+// which is a ratio of bitrate the content needs for a given visual quality to that of an average video.
+// Intermediate tiers which end up too close in bitrate to the tier above are dropped as they don't offer
+// any meaningful bandwidth savings, so easy to compress content gets fewer tiers.
+func (l Ladder) Adapt(complexity float64) Ladder {
+	complexity = math.Max(MinComplexity, math.Min(MaxComplexity, complexity))
+
+	adaptedTiers := []Tier{}
+	for i, t := range l.Tiers {
+		t.VideoBitrate = int(math.Round(float64(t.VideoBitrate) * complexity))
+		if t.VideoBitrate < minTierBitrate {
+			t.VideoBitrate = minTierBitrate
+		}
+		if i > 0 && i < len(l.Tiers)-1 {
+			prev := adaptedTiers[len(adaptedTiers)-1]
+			if prev.VideoBitrate-t.VideoBitrate < minTierBitrateStep {
+				logger.Debugw("dropping tier too close to the previous one", "tier", t.Height, "bitrate", t.VideoBitrate, "previous", prev.VideoBitrate)
+				continue
+			}
+		}
+		adaptedTiers = append(adaptedTiers, t)
+	}
+
+	l.Tiers = adaptedTiers
+	logger.Debugw("ladder adapted", "complexity", complexity, "tiers", l.Tiers)
+	return l
+}
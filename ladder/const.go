@@ -4,6 +4,8 @@ const (
 	D1080p Definition = "1080p"
 	D720p  Definition = "720p"
 	D144p  Definition = "144p"
+	// DAudio is the definition of audio-only tiers.
+	DAudio Definition = "audio"
 
 	nsRateFactor = 0.37
 )
@@ -35,4 +35,11 @@ tiers:
     framerate: 15
 `)
 
+// DefaultName is the name Default ladder is known by in Registry.
+const DefaultName = "default"
+
 var Default, _ = Load(defaultLadderYaml)
+
+func init() {
+	Default.Name = DefaultName
+}
@@ -0,0 +1,83 @@
+package ladder
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SideData is an entry of ffprobe side_data_list, only display matrix rotation is of interest.
+type SideData struct {
+	SideDataType string  `json:"side_data_type"`
+	Rotation     float64 `json:"rotation"`
+}
+
+// detectDisplaySize calculates dimensions the video is supposed to be displayed at,
+// taking into account rotation (`rotate` tag or display matrix) and sample aspect ratio.
+func (m *Metadata) detectDisplaySize() {
+	for _, s := range m.Streams {
+		if s.CodecType != "video" {
+			continue
+		}
+		w, h := float64(m.VideoStream.GetWidth()), float64(m.VideoStream.GetHeight())
+
+		if sar := parseRatio(s.SampleAspectRatio); sar > 0 && sar != 1 {
+			m.SampleAspectRatio = sar
+			w = w * sar
+		}
+
+		m.Rotation = s.rotation()
+		if m.Rotation == 90 || m.Rotation == 270 {
+			w, h = h, w
+		}
+		m.DisplayWidth, m.DisplayHeight = even(int(math.Round(w))), even(int(math.Round(h)))
+		return
+	}
+}
+
+// Anamorphic is true for videos with non-square pixels.
+func (m *Metadata) Anamorphic() bool {
+	return m.SampleAspectRatio != 0 && m.SampleAspectRatio != 1
+}
+
+// rotation returns clockwise rotation in degrees normalized to 0, 90, 180 or 270.
+func (s StreamInfo) rotation() int {
+	var deg float64
+	if r, err := strconv.ParseFloat(s.Tags["rotate"], 64); err == nil {
+		deg = r
+	} else {
+		for _, sd := range s.SideDataList {
+			if sd.SideDataType == "Display Matrix" {
+				// Display matrix rotation is counter-clockwise.
+				deg = -sd.Rotation
+				break
+			}
+		}
+	}
+	r := int(math.Round(deg/90)) * 90 % 360
+	if r < 0 {
+		r += 360
+	}
+	return r
+}
+
+func parseRatio(r string) float64 {
+	parts := strings.Split(r, ":")
+	if len(parts) != 2 {
+		return 0
+	}
+	n, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.Atoi(parts[1])
+	if err != nil || d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// even rounds dimension down to an even number as required by yuv420p encoding.
+func even(n int) int {
+	return n - n%2
+}
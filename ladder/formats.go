@@ -3,6 +3,7 @@ package ladder
 const (
 	TypeHLS   = "hls"
 	TypeDASH  = "dash"
+	TypeCMAF  = "cmaf"
 	TypeRange = "range"
 
 	FPS30 = 30
@@ -1,17 +1,55 @@
 package ladder
 
 import (
+	"fmt"
 	"math"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 )
 
 type Definition string
 
+// reservedArguments are ffmpeg options set by ArgumentSet which the output layout depends on,
+// ladders are not allowed to override them.
+var reservedArguments = map[string]bool{
+	"f":               true,
+	"c:v":             true,
+	"c:a":             true,
+	"map":             true,
+	"master_pl_name":  true,
+	"strftime_mkdir":  true,
+	argVarStreamMap:   true,
+	argHLSSegmentType: true,
+	argHLSSegmentName: true,
+	argHLSInitName:    true,
+	argAdaptationSets: true,
+	"init_seg_name":   true,
+	"media_seg_name":  true,
+	"pass":            true,
+	"passlogfile":     true,
+	"stats":           true,
+}
+
+var reBitrate = regexp.MustCompile(`^\d+[kKM]?$`)
+
 type Ladder struct {
+	// Name is set for ladders obtained from Registry, it is recorded in stream manifest.
+	Name  string `yaml:"-"`
 	Args  map[string]string
 	Tiers []Tier `yaml:",flow"`
+	// Format is the streaming format ladder is packaged into: TypeHLS (default), TypeDASH
+	// or TypeCMAF (fragmented MP4 segments referenced by both HLS playlists and DASH manifest).
+	Format string `yaml:",omitempty"`
+	// Codec is the video encoder used for tiers that don't specify one, CodecH264 by default.
+	Codec string `yaml:",omitempty"`
+	// AudioGroup makes audio encoded once into a separate rendition (EXT-X-MEDIA TYPE=AUDIO)
+	// shared by all video tiers instead of being muxed into each of them.
+	AudioGroup bool `yaml:"audio_group,omitempty"`
 }
 
 type Tier struct {
@@ -22,25 +60,128 @@ type Tier struct {
 	AudioBitrate  string `yaml:"audio_bitrate"`
 	Framerate     int    `yaml:",omitempty"`
 	BitrateCutoff int    `yaml:"bitrate_cutoff"`
+	Codec         string `yaml:",omitempty"`
+	// RateControl is the bitrate control mode: RateControlCRF (default), RateControlCVBR or RateControl2Pass.
+	RateControl string `yaml:"rate_control,omitempty"`
+	// BufsizeFactor is VBV buffer size relative to the bitrate for cvbr and 2pass tiers, 2 by default.
+	BufsizeFactor float64 `yaml:"bufsize_factor,omitempty"`
+	// HDR tiers keep high dynamic range of HDR sources (10-bit HEVC only) and are skipped for SDR sources.
+	// All other tiers get HDR sources tone-mapped to SDR.
+	HDR bool `yaml:",omitempty"`
+	// Passthrough tiers get source video copied into them without re-encoding. It is never set in ladder
+	// definitions, only by the encoder for sources already matching the tier.
+	Passthrough bool `yaml:"-" json:"-"`
 }
 
 func Load(yamlLadder []byte) (Ladder, error) {
 	l := Ladder{}
 	err := yaml.Unmarshal(yamlLadder, &l)
-	return l, err
+	if err != nil {
+		return l, err
+	}
+	return l, l.Validate()
+}
+
+// Validate checks that ladder can be transcoded with: tiers have sane dimensions and bitrates,
+// are sorted by height in descending order, and ladder arguments don't override the ones
+// ffmpeg output layout depends on.
+func (l Ladder) Validate() error {
+	switch l.Format {
+	case "", TypeHLS, TypeDASH, TypeCMAF:
+	default:
+		return fmt.Errorf("unsupported ladder format: %v", l.Format)
+	}
+	if l.Codec != "" && !IsSupportedCodec(l.Codec) {
+		return fmt.Errorf("unsupported ladder codec: %v", l.Codec)
+	}
+	if len(l.Tiers) == 0 {
+		return errors.New("ladder has no tiers")
+	}
+
+	keys := make([]string, 0, len(l.Args))
+	for k := range l.Args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.HasPrefix(k, "-") {
+			return fmt.Errorf("ladder argument %v must be specified without leading dash", k)
+		}
+		if reservedArguments[k] {
+			return fmt.Errorf("ladder argument %v cannot be overridden", k)
+		}
+	}
+
+	// HDR tiers are only used for HDR sources, so they are ordered separately from the rest.
+	prevHeight := map[bool]int{}
+	for n, t := range l.Tiers {
+		if t.Codec != "" && !IsSupportedCodec(t.Codec) {
+			return fmt.Errorf("unsupported codec for tier %v: %v", t.Definition, t.Codec)
+		}
+		if t.HDR && l.TierCodec(t) != CodecHEVC {
+			return fmt.Errorf("hdr tier %v must use %v codec", t.Definition, CodecHEVC)
+		}
+		switch TierRateControl(t) {
+		case RateControlCRF, RateControlCVBR:
+		case RateControl2Pass:
+			if l.TierCodec(t) != CodecH264 {
+				return fmt.Errorf("tier #%v (%v): two-pass rate control requires %v codec", n, t.Definition, CodecH264)
+			}
+		default:
+			return fmt.Errorf("tier #%v (%v): unsupported rate control: %v", n, t.Definition, t.RateControl)
+		}
+		if t.BufsizeFactor < 0 {
+			return fmt.Errorf("tier #%v (%v): bufsize_factor must not be negative, got %v", n, t.Definition, t.BufsizeFactor)
+		}
+		if t.AudioBitrate != "" && !reBitrate.MatchString(t.AudioBitrate) {
+			return fmt.Errorf("tier #%v (%v): invalid audio bitrate: %v", n, t.Definition, t.AudioBitrate)
+		}
+		if t.Definition == DAudio {
+			continue
+		}
+		switch {
+		case t.Height <= 0:
+			return fmt.Errorf("tier #%v (%v): height must be positive, got %v", n, t.Definition, t.Height)
+		case t.Width < 0:
+			return fmt.Errorf("tier #%v (%v): width must not be negative, got %v", n, t.Definition, t.Width)
+		case t.VideoBitrate <= 0:
+			return fmt.Errorf("tier #%v (%v): bitrate must be positive, got %v", n, t.Definition, t.VideoBitrate)
+		case t.Framerate < 0:
+			return fmt.Errorf("tier #%v (%v): framerate must not be negative, got %v", n, t.Definition, t.Framerate)
+		case t.BitrateCutoff < 0:
+			return fmt.Errorf("tier #%v (%v): bitrate_cutoff must not be negative, got %v", n, t.Definition, t.BitrateCutoff)
+		}
+		if prev, ok := prevHeight[t.HDR]; ok && t.Height > prev {
+			return fmt.Errorf(
+				"tier #%v (%v): height %v is greater than %v of the preceding tier, tiers must be sorted by height in descending order",
+				n, t.Definition, t.Height, prev)
+		}
+		prevHeight[t.HDR] = t.Height
+	}
+	return nil
 }
 
 // Tweak modifies existing ladder according to supplied video metadata
 func (l Ladder) Tweak(meta *Metadata) (Ladder, error) {
+	if !meta.HasVideo() {
+		l.Tiers = l.audioTiers()
+		logger.Debugw("audio-only ladder built", "tiers", l.Tiers)
+		return l, nil
+	}
+
 	vrate, _ := strconv.Atoi(meta.VideoStream.GetBitRate())
 	var vert, origResSeen bool
-	w := meta.VideoStream.GetWidth()
-	h := meta.VideoStream.GetHeight()
+	w := meta.DisplayWidth
+	h := meta.DisplayHeight
 	if h > w {
 		vert = true
 	}
 	tweakedTiers := []Tier{}
 	for _, t := range l.Tiers {
+		if t.HDR && !meta.HDR() {
+			logger.Debugw("skipping hdr tier for sdr video", "tier", t.Height)
+			continue
+		}
 		if t.BitrateCutoff >= vrate {
 			logger.Debugw("video bitrate lower than the cut-off", "bitrate", vrate, "cutoff", t.BitrateCutoff)
 			if t.Height == h {
@@ -66,7 +207,7 @@ func (l Ladder) Tweak(meta *Metadata) (Ladder, error) {
 			Height:       h,
 			Width:        w,
 			VideoBitrate: nsRate(w, h),
-			AudioBitrate: "128k",
+			AudioBitrate: defaultAudioBitrate,
 		}}, tweakedTiers...)
 	}
 
@@ -76,14 +217,107 @@ func (l Ladder) Tweak(meta *Metadata) (Ladder, error) {
 }
 
 func (l Ladder) ArgumentSet(out string, meta *Metadata) *ArgumentSet {
+	args := hlsDefaultArguments
+	switch l.StreamType() {
+	case TypeDASH:
+		args = dashDefaultArguments
+	case TypeCMAF:
+		args = cmafDefaultArguments
+	}
 	return &ArgumentSet{
 		Output:    out,
-		Arguments: hlsDefaultArguments,
+		Arguments: args,
 		Ladder:    l,
 		Meta:      meta,
 	}
 }
 
+// StreamType returns the streaming format ladder output is going to be packaged into.
+func (l Ladder) StreamType() string {
+	switch l.Format {
+	case TypeDASH, TypeCMAF:
+		return l.Format
+	}
+	return TypeHLS
+}
+
+// SegmentDuration returns target duration of stream segments in seconds.
+func (l Ladder) SegmentDuration() string {
+	if d, ok := l.Args[argHLSTime]; ok && d != "" {
+		return d
+	}
+	return hlsTime
+}
+
+// PassthroughTiers returns numbers of tiers that get source video copied into them.
+func (l Ladder) PassthroughTiers() []int {
+	tiers := []int{}
+	for n, t := range l.Tiers {
+		if t.Passthrough {
+			tiers = append(tiers, n)
+		}
+	}
+	return tiers
+}
+
+// AudioOnly is true for ladders consisting of audio-only tiers.
+func (l Ladder) AudioOnly() bool {
+	for _, t := range l.Tiers {
+		if t.Definition != DAudio {
+			return false
+		}
+	}
+	return len(l.Tiers) > 0
+}
+
+// audioTiers returns audio-only tiers, one for each distinct audio bitrate found in the ladder.
+func (l Ladder) audioTiers() []Tier {
+	tiers := []Tier{}
+	seen := map[string]bool{}
+	for _, t := range l.Tiers {
+		if t.AudioBitrate == "" || seen[t.AudioBitrate] {
+			continue
+		}
+		seen[t.AudioBitrate] = true
+		tiers = append(tiers, Tier{Definition: DAudio, AudioBitrate: t.AudioBitrate})
+	}
+	if len(tiers) == 0 {
+		tiers = append(tiers, Tier{Definition: DAudio, AudioBitrate: defaultAudioBitrate})
+	}
+	return tiers
+}
+
+// TierCodec returns video codec the tier is going to be encoded with.
+func (l Ladder) TierCodec(t Tier) string {
+	if t.Codec != "" {
+		return t.Codec
+	}
+	if l.Codec != "" {
+		return l.Codec
+	}
+	return CodecH264
+}
+
+// FragmentedMP4 is true when ladder output needs to be segmented into fMP4 instead of MPEG-TS,
+// which is the case for every codec except H.264 and all DASH/CMAF ladders.
+func (l Ladder) FragmentedMP4() bool {
+	if l.dashMuxed() {
+		return true
+	}
+	for _, t := range l.Tiers {
+		if t.Definition != DAudio && l.TierCodec(t) != CodecH264 {
+			return true
+		}
+	}
+	return false
+}
+
+// dashMuxed is true for ladders that are packaged by ffmpeg dash muxer into fragmented MP4 segments.
+func (l Ladder) dashMuxed() bool {
+	t := l.StreamType()
+	return t == TypeDASH || t == TypeCMAF
+}
+
 func nsRate(w, h int) int {
-	return int(math.Ceil(float64(800*600) / nsRateFactor))
+	return int(math.Ceil(float64(w*h) / nsRateFactor))
 }
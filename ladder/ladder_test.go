@@ -2,12 +2,16 @@ package ladder
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/floostack/transcoder/ffmpeg"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoadLadderConfig(t *testing.T) {
@@ -136,3 +140,647 @@ func generateMeta(w, h, br, fr int) ffmpeg.Metadata {
 	}
 	return meta
 }
+
+// parseArgs turns ffmpeg argument list into a map of options to their values.
+func parseArgs(t *testing.T, args []string) map[string]string {
+	t.Helper()
+	parsed := map[string]string{}
+	for i := 0; i < len(args)-1; i += 2 {
+		parsed[args[i]] = args[i+1]
+	}
+	return parsed
+}
+
+func TestArgumentSetDASH(t *testing.T) {
+	ladder, err := Load(append(defaultLadderYaml, []byte("format: dash\n")...))
+	require.NoError(t, err)
+	require.Equal(t, TypeDASH, ladder.StreamType())
+
+	meta := generateMeta(1920, 1080, 8000, FPS30)
+	m, err := WrapMeta(&meta)
+	require.NoError(t, err)
+	l, err := ladder.Tweak(m)
+	require.NoError(t, err)
+
+	args := l.ArgumentSet("out", m)
+	assert.Equal(t, DASHManifest, args.OutputName())
+
+	strArgs := args.GetStrArguments()
+	parsed := parseArgs(t, strArgs)
+	assert.Equal(t, "dash", parsed["-f"])
+	assert.Equal(t, "6", parsed["-seg_duration"])
+	assert.NotContains(t, parsed, "-hls_time")
+	assert.NotContains(t, parsed, "-var_stream_map")
+}
+
+func TestLoadUnsupportedFormat(t *testing.T) {
+	_, err := Load(append(defaultLadderYaml, []byte("format: smooth\n")...))
+	assert.EqualError(t, err, "unsupported ladder format: smooth")
+}
+
+func TestArgumentSetCMAF(t *testing.T) {
+	ladder, err := Load(append(defaultLadderYaml, []byte("format: cmaf\n")...))
+	require.NoError(t, err)
+	require.Equal(t, TypeCMAF, ladder.StreamType())
+
+	meta := generateMeta(1920, 1080, 8000, FPS30)
+	m, err := WrapMeta(&meta)
+	require.NoError(t, err)
+
+	args := ladder.ArgumentSet("out", m)
+	assert.Equal(t, DASHManifest, args.OutputName())
+
+	strArgs := args.GetStrArguments()
+	parsed := parseArgs(t, strArgs)
+	assert.Equal(t, "dash", parsed["-f"])
+	assert.Equal(t, "1", parsed["-hls_playlist"])
+	assert.Equal(t, "init_$RepresentationID$.mp4", parsed["-init_seg_name"])
+	assert.NotContains(t, parsed, "-hls_segment_filename")
+}
+
+func TestArgumentSetCodecs(t *testing.T) {
+	ladder, err := Load(append(defaultLadderYaml, []byte("codec: libx265\n")...))
+	require.NoError(t, err)
+	ladder.Tiers[len(ladder.Tiers)-1].Codec = CodecH264
+	assert.Equal(t, CodecHEVC, ladder.TierCodec(ladder.Tiers[0]))
+	assert.Equal(t, CodecH264, ladder.TierCodec(ladder.Tiers[len(ladder.Tiers)-1]))
+
+	meta := generateMeta(1920, 1080, 8000, FPS30)
+	m, err := WrapMeta(&meta)
+	require.NoError(t, err)
+
+	strArgs := ladder.ArgumentSet("out", m).GetStrArguments()
+	parsed := parseArgs(t, strArgs)
+	assert.Equal(t, CodecHEVC, parsed["-c:v:0"])
+	assert.Equal(t, "hvc1", parsed["-tag:v:0"])
+	assert.Equal(t, CodecH264, parsed["-c:v:3"])
+	assert.NotContains(t, parsed, "-tag:v:3")
+	assert.Equal(t, "fmp4", parsed["-hls_segment_type"])
+	assert.Equal(t, hlsFMP4SegmentName, parsed["-hls_segment_filename"])
+
+	// Default H.264 ladder must not inherit fMP4 settings from the previous one.
+	strArgs = Default.ArgumentSet("out", m).GetStrArguments()
+	assert.NotContains(t, strArgs, "-hls_segment_type")
+}
+
+func TestArgumentSetRateControl(t *testing.T) {
+	ladder, err := Load(defaultLadderYaml)
+	require.NoError(t, err)
+	ladder.Tiers[1].RateControl = RateControlCVBR
+	ladder.Tiers[1].BufsizeFactor = 1.5
+	ladder.Tiers[2].RateControl = RateControl2Pass
+	ladder.Tiers[3].RateControl = RateControl2Pass
+	require.NoError(t, ladder.Validate())
+	assert.True(t, ladder.TwoPass())
+	assert.False(t, Default.TwoPass())
+
+	meta := generateMeta(1920, 1080, 8000, FPS30)
+	m, err := WrapMeta(&meta)
+	require.NoError(t, err)
+
+	args := ladder.ArgumentSet("out", m)
+	args.PassLogDir = "/tmp/passlog"
+	strArgs := args.GetStrArguments()
+	parsed := parseArgs(t, strArgs)
+	assert.Equal(t, "3500000", parsed["-maxrate:v:0"])
+	assert.Equal(t, "3500000", parsed["-bufsize:v:0"])
+	assert.NotContains(t, parsed, "-crf:v:0")
+	assert.NotContains(t, parsed, "-b:v:0")
+
+	assert.Equal(t, "-1", parsed["-crf:v:1"])
+	assert.Equal(t, "2500000", parsed["-b:v:1"])
+	assert.Equal(t, "2500000", parsed["-maxrate:v:1"])
+	assert.Equal(t, "3750000", parsed["-bufsize:v:1"])
+	assert.NotContains(t, parsed, "-pass:v:1")
+
+	assert.Equal(t, "500000", parsed["-b:v:2"])
+	assert.Equal(t, "1000000", parsed["-bufsize:v:2"])
+	assert.Equal(t, "2", parsed["-pass:v:2"])
+	assert.Equal(t, "/tmp/passlog/passlog_2", parsed["-passlogfile:v:2"])
+	assert.Equal(t, "/tmp/passlog/passlog_3", parsed["-passlogfile:v:3"])
+	assert.NotContains(t, strArgs, "-stats")
+
+	fpArgs := args.FirstPassArguments()
+	parsed = parseArgs(t, fpArgs)
+	assert.Equal(t, "null", parsed["-f"])
+	// Output streams are laid out the same as in the main pass, only two-pass tiers are encoded.
+	assert.Equal(t, "copy", parsed["-c:v:0"])
+	assert.Equal(t, "copy", parsed["-c:v:1"])
+	assert.Equal(t, "copy", parsed["-c:a:0"])
+	assert.NotContains(t, parsed, "-pass:v:1")
+	assert.Equal(t, "1", parsed["-pass:v:2"])
+	assert.Equal(t, "/tmp/passlog/passlog_2", parsed["-passlogfile:v:2"])
+	assert.Equal(t, "scale=-2:360", parsed["-filter:v:2"])
+	assert.Equal(t, "-1", parsed["-crf:v:2"])
+	assert.Equal(t, "500000", parsed["-b:v:2"])
+	assert.Equal(t, "500000", parsed["-maxrate:v:2"])
+	assert.Equal(t, "1000000", parsed["-bufsize:v:2"])
+	assert.Equal(t, "1", parsed["-pass:v:3"])
+	assert.Equal(t, "/tmp/passlog/passlog_3", parsed["-passlogfile:v:3"])
+	assert.NotContains(t, fpArgs, "-an")
+	assert.NotContains(t, parsed, "-var_stream_map")
+	assert.NotContains(t, parsed, "-hls_time")
+	assert.Equal(t, "veryfast", parsed["-preset"])
+
+	ladder.Tiers[2].Codec = CodecHEVC
+	assert.EqualError(t, ladder.Validate(), "tier #2 (360p): two-pass rate control requires libx264 codec")
+	ladder.Tiers[2].Codec = ""
+	ladder.Tiers[2].RateControl = "vbr"
+	assert.EqualError(t, ladder.Validate(), "tier #2 (360p): unsupported rate control: vbr")
+}
+
+func TestArgumentSetPassthrough(t *testing.T) {
+	ladder, err := Load(defaultLadderYaml)
+	require.NoError(t, err)
+	ladder.Tiers[0].Passthrough = true
+	ladder.Tiers[0].RateControl = RateControl2Pass
+	assert.False(t, ladder.TwoPass())
+	assert.Equal(t, []int{0}, ladder.PassthroughTiers())
+
+	meta := generateMeta(1920, 1080, 8000, FPS30)
+	m, err := WrapMeta(&meta)
+	require.NoError(t, err)
+
+	strArgs := ladder.ArgumentSet("out", m).GetStrArguments()
+	parsed := parseArgs(t, strArgs)
+	assert.Equal(t, "copy", parsed["-c:v:0"])
+	assert.NotContains(t, parsed, "-filter:v:0")
+	assert.NotContains(t, parsed, "-g:0")
+	assert.NotContains(t, parsed, "-maxrate:v:0")
+	assert.NotContains(t, parsed, "-pass:v:0")
+	assert.Equal(t, "160k", parsed["-b:a:0"])
+	assert.Equal(t, "scale=-2:720", parsed["-filter:v:1"])
+	assert.Equal(t, "2500000", parsed["-maxrate:v:1"])
+
+	out, err := yaml.Marshal(ladder)
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "passthrough")
+}
+
+func TestLoadUnsupportedCodec(t *testing.T) {
+	_, err := Load(append(defaultLadderYaml, []byte("codec: vp9\n")...))
+	assert.EqualError(t, err, "unsupported ladder codec: vp9")
+}
+
+func TestAdapt(t *testing.T) {
+	ladder, err := Load(defaultLadderYaml)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		complexity float64
+		bitrates   []int
+	}{
+		{1, []int{3500_000, 2500_000, 500_000, 100_000}},
+		{1.2, []int{4200_000, 3000_000, 600_000, 120_000}},
+		{5, []int{5600_000, 4000_000, 800_000, 160_000}},
+		{0.5, []int{1750_000, 1250_000, 250_000, 64_000}},
+		{0.3, []int{1050_000, 150_000, 64_000}},
+		{0, []int{1050_000, 150_000, 64_000}},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%v", tc.complexity), func(t *testing.T) {
+			l := ladder.Adapt(tc.complexity)
+			bitrates := []int{}
+			for _, tier := range l.Tiers {
+				bitrates = append(bitrates, tier.VideoBitrate)
+			}
+			assert.Equal(t, tc.bitrates, bitrates)
+		})
+	}
+	assert.Equal(t, 3500_000, ladder.Tiers[0].VideoBitrate)
+}
+
+func TestWrapMetaStreams(t *testing.T) {
+	meta := generateMeta(1920, 1080, 8000, FPS30)
+	m, err := WrapMeta(&meta)
+	require.NoError(t, err)
+	assert.Equal(t, "video", m.VideoStream.GetCodecType())
+	assert.Equal(t, "audio", m.AudioStream.GetCodecType())
+
+	meta.Streams = meta.Streams[:1]
+	m, err = WrapMeta(&meta)
+	require.NoError(t, err)
+	assert.False(t, m.HasVideo())
+	assert.True(t, m.HasAudio())
+
+	meta.Streams = []ffmpeg.Streams{}
+	_, err = WrapMeta(&meta)
+	assert.EqualError(t, err, "no video or audio stream found")
+}
+
+func TestArgumentSetAudio(t *testing.T) {
+	ladder, err := Load(defaultLadderYaml)
+	require.NoError(t, err)
+
+	tweakedArgs := func(l Ladder, meta ffmpeg.Metadata) map[string]string {
+		m, err := WrapMeta(&meta)
+		require.NoError(t, err)
+		l, err = l.Tweak(m)
+		require.NoError(t, err)
+		return parseArgs(t, l.ArgumentSet("out", m).GetStrArguments())
+	}
+
+	t.Run("AudioOnly", func(t *testing.T) {
+		meta := generateMeta(1920, 1080, 8000, FPS30)
+		meta.Streams = meta.Streams[:1]
+		m, err := WrapMeta(&meta)
+		require.NoError(t, err)
+		l, err := ladder.Tweak(m)
+		require.NoError(t, err)
+		assert.True(t, l.AudioOnly())
+		assert.Equal(t, []Tier{
+			{Definition: DAudio, AudioBitrate: "160k"},
+			{Definition: DAudio, AudioBitrate: "128k"},
+			{Definition: DAudio, AudioBitrate: "96k"},
+			{Definition: DAudio, AudioBitrate: "64k"},
+		}, l.Tiers)
+
+		args := tweakedArgs(ladder, meta)
+		assert.Equal(t, "a:0 a:1 a:2 a:3", args["-var_stream_map"])
+		assert.Equal(t, "64k", args["-b:a:3"])
+		assert.NotContains(t, args, "-filter:v:0")
+	})
+
+	t.Run("NoAudio", func(t *testing.T) {
+		meta := generateMeta(1920, 1080, 8000, FPS30)
+		meta.Streams = meta.Streams[1:]
+		args := tweakedArgs(ladder, meta)
+		assert.Equal(t, "v:0 v:1 v:2 v:3", args["-var_stream_map"])
+		assert.NotContains(t, args, "-b:a:0")
+	})
+
+	t.Run("AudioGroup", func(t *testing.T) {
+		l := ladder
+		l.AudioGroup = true
+		args := tweakedArgs(l, generateMeta(1920, 1080, 8000, FPS30))
+		assert.Equal(t,
+			"v:0,agroup:audio v:1,agroup:audio v:2,agroup:audio v:3,agroup:audio a:0,agroup:audio,name:Track_1,default:yes",
+			args["-var_stream_map"])
+		assert.Equal(t, "160k", args["-b:a:0"])
+		assert.NotContains(t, args, "-b:a:1")
+	})
+}
+
+var multiTrackProbe = []byte(`{
+	"streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "avg_frame_rate": "30/1", "bit_rate": "8000000", "disposition": {"default": 1}},
+		{"index": 1, "codec_type": "audio", "codec_name": "aac", "disposition": {"default": 0}, "tags": {"language": "eng", "title": "English, stereo"}},
+		{"index": 2, "codec_type": "audio", "codec_name": "aac", "disposition": {"default": 1}, "tags": {"language": "spa"}},
+		{"index": 3, "codec_type": "audio", "codec_name": "ac3", "disposition": {"default": 0}, "tags": {"language": "und"}}
+	],
+	"format": {"duration": "60.000000", "bit_rate": "8000000"}
+}`)
+
+func TestWrapProbeAudioTracks(t *testing.T) {
+	m, err := WrapProbe(multiTrackProbe)
+	require.NoError(t, err)
+	assert.Equal(t, []AudioTrack{
+		{Index: 0, Language: "eng", Name: "English, stereo"},
+		{Index: 1, Language: "spa", Name: "spa", Default: true},
+		{Index: 2, Name: "Track 3"},
+	}, m.AudioTracks())
+	assert.Equal(t, "spa", m.Streams[2].Tags["language"])
+	assert.Equal(t, 1, m.defaultAudioTrack())
+}
+
+func TestArgumentSetAudioTracks(t *testing.T) {
+	m, err := WrapProbe(multiTrackProbe)
+	require.NoError(t, err)
+	l, err := Default.Tweak(m)
+	require.NoError(t, err)
+
+	args := l.ArgumentSet("out", m)
+	assert.Len(t, args.AudioTracks(), 3)
+
+	strArgs := args.GetStrArguments()
+	parsed := parseArgs(t, strArgs)
+	assert.Equal(t,
+		"v:0,agroup:audio v:1,agroup:audio v:2,agroup:audio v:3,agroup:audio "+
+			"a:0,agroup:audio,language:eng,name:English__stereo "+
+			"a:1,agroup:audio,language:spa,name:spa,default:yes "+
+			"a:2,agroup:audio,name:Track_3",
+		parsed["-var_stream_map"])
+	assert.Equal(t, "language=spa", parsed["-metadata:s:a:1"])
+	assert.Equal(t, "160k", parsed["-b:a:2"])
+}
+
+func TestArgumentSetPreencodedAudio(t *testing.T) {
+	meta := generateMeta(1920, 1080, 8000, FPS30)
+	m, err := WrapMeta(&meta)
+	require.NoError(t, err)
+	l, err := Default.Tweak(m)
+	require.NoError(t, err)
+
+	args := l.ArgumentSet("out", m)
+	assert.Equal(t,
+		"-vn -sn -dn -c:a aac -ac 2 -ar 44100 -map a:0 -b:a:0 160k -map a:0 -b:a:1 128k -map a:0 -b:a:2 96k -map a:0 -b:a:3 64k",
+		strings.Join(args.AudioArguments(), " "))
+
+	args.PreencodedAudio = true
+	strArgs := strings.Join(args.GetStrArguments(), " ")
+	assert.Contains(t, strArgs, "-map v:0 -c:v:0 libx264")
+	for n := 0; n < 4; n++ {
+		assert.Contains(t, strArgs, fmt.Sprintf("-map a:%v -c:a:%v copy", n, n))
+	}
+	assert.NotContains(t, strArgs, "-b:a:")
+	assert.NotContains(t, strArgs, "-ar ")
+	assert.NotContains(t, strArgs, "-c:a aac")
+
+	m, err = WrapProbe(multiTrackProbe)
+	require.NoError(t, err)
+	l, err = Default.Tweak(m)
+	require.NoError(t, err)
+	assert.Equal(t,
+		"-vn -sn -dn -c:a aac -ac 2 -ar 44100 -map a:0 -b:a:0 160k -map a:1 -b:a:1 160k -map a:2 -b:a:2 160k",
+		strings.Join(l.ArgumentSet("out", m).AudioArguments(), " "))
+}
+
+func TestSubtitleTracks(t *testing.T) {
+	m, err := WrapProbe([]byte(`{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "avg_frame_rate": "30/1"},
+			{"index": 1, "codec_type": "audio", "codec_name": "aac"},
+			{"index": 2, "codec_type": "subtitle", "codec_name": "subrip", "tags": {"language": "eng"}, "disposition": {"default": 1}},
+			{"index": 3, "codec_type": "subtitle", "codec_name": "hdmv_pgs_subtitle", "tags": {"language": "fre"}},
+			{"index": 4, "codec_type": "subtitle", "codec_name": "ass", "tags": {"language": "ger", "title": "Signs"}, "disposition": {"forced": 1}}
+		],
+		"format": {"duration": "60.000000"}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, []SubtitleTrack{
+		{Index: 0, Language: "eng", Name: "eng", Default: true},
+		{Index: 2, Language: "ger", Name: "Signs", Forced: true},
+	}, m.SubtitleTracks())
+}
+
+var hdrProbe = []byte(`{
+	"streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "hevc", "width": 3840, "height": 2160, "avg_frame_rate": "24/1", "bit_rate": "20000000",
+		 "pix_fmt": "yuv420p10le", "color_transfer": "smpte2084", "color_primaries": "bt2020", "color_space": "bt2020nc"},
+		{"index": 1, "codec_type": "audio", "codec_name": "aac"}
+	],
+	"format": {"duration": "60.000000", "bit_rate": "20000000"}
+}`)
+
+func TestHDR(t *testing.T) {
+	m, err := WrapProbe(hdrProbe)
+	require.NoError(t, err)
+	assert.True(t, m.HDR())
+	assert.Equal(t, VideoRangePQ, m.VideoRange)
+	assert.Equal(t, 10, m.BitDepth)
+
+	sdrMeta := generateMeta(1920, 1080, 8000, FPS30)
+	sm, err := WrapMeta(&sdrMeta)
+	require.NoError(t, err)
+	assert.False(t, sm.HDR())
+
+	ladder, err := Load(append(defaultLadderYaml, []byte(`  - definition: 1080p
+    bitrate: 5000_000
+    audio_bitrate: 160k
+    width: 1920
+    height: 1080
+    codec: libx265
+    hdr: true
+`)...))
+	require.NoError(t, err)
+
+	sl, err := ladder.Tweak(sm)
+	require.NoError(t, err)
+	assert.Len(t, sl.Tiers, 4)
+
+	l, err := ladder.Tweak(m)
+	require.NoError(t, err)
+	require.Len(t, l.Tiers, 5)
+	assert.True(t, l.Tiers[4].HDR)
+
+	strArgs := l.ArgumentSet("out", m).GetStrArguments()
+	parsed := parseArgs(t, strArgs)
+	assert.Equal(t, toneMapFilter+",scale=-2:1080", parsed["-filter:v:0"])
+	assert.Equal(t, "bt709", parsed["-color_trc:v:0"])
+	assert.Equal(t, "scale=-2:1080", parsed["-filter:v:4"])
+	assert.Equal(t, "yuv420p10le", parsed["-pix_fmt:v:4"])
+	assert.Equal(t, "smpte2084", parsed["-color_trc:v:4"])
+	assert.Contains(t, parsed["-x265-params:v:4"], "transfer=smpte2084")
+}
+
+func TestLoadHDRCodec(t *testing.T) {
+	_, err := Load(append(defaultLadderYaml, []byte(`  - definition: 1080p
+    height: 1080
+    hdr: true
+`)...))
+	assert.EqualError(t, err, "hdr tier 1080p must use libx265 codec")
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Default.Validate())
+
+	tier := func(h, br int) Tier {
+		return Tier{Definition: Definition(fmt.Sprintf("%vp", h)), Height: h, Width: h * 16 / 9, VideoBitrate: br, AudioBitrate: "128k"}
+	}
+	testCases := []struct {
+		name   string
+		ladder Ladder
+		err    string
+	}{
+		{"no tiers", Ladder{}, "ladder has no tiers"},
+		{"zero height", Ladder{Tiers: []Tier{tier(720, 2000_000), tier(0, 500_000)}},
+			"tier #1 (0p): height must be positive, got 0"},
+		{"zero bitrate", Ladder{Tiers: []Tier{tier(720, 0)}},
+			"tier #0 (720p): bitrate must be positive, got 0"},
+		{"unsorted", Ladder{Tiers: []Tier{tier(360, 500_000), tier(720, 2000_000)}},
+			"tier #1 (720p): height 720 is greater than 360 of the preceding tier, tiers must be sorted by height in descending order"},
+		{"bad audio bitrate", Ladder{Tiers: []Tier{{Definition: "720p", Height: 720, VideoBitrate: 1, AudioBitrate: "128kbit"}}},
+			"tier #0 (720p): invalid audio bitrate: 128kbit"},
+		{"reserved argument", Ladder{Args: map[string]string{"var_stream_map": "v:0"}, Tiers: []Tier{tier(720, 2000_000)}},
+			"ladder argument var_stream_map cannot be overridden"},
+		{"dashed argument", Ladder{Args: map[string]string{"-crf": "20"}, Tiers: []Tier{tier(720, 2000_000)}},
+			"ladder argument -crf must be specified without leading dash"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.EqualError(t, tc.ladder.Validate(), tc.err)
+		})
+	}
+
+	_, err := Load([]byte(`
+tiers:
+  - definition: 360p
+    height: 360
+    bitrate: 500_000
+  - definition: 1080p
+    height: 1080
+    bitrate: 3500_000
+`))
+	assert.EqualError(t, err, "tier #1 (1080p): height 1080 is greater than 360 of the preceding tier, tiers must be sorted by height in descending order")
+}
+
+func TestTweakDisplaySize(t *testing.T) {
+	ladder, err := Load(defaultLadderYaml)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		probe         []byte
+		expectedTiers []Tier
+	}{
+		{
+			"rotate90",
+			generateProbe(1920, 1080, 8000, `"tags": {"rotate": "90"}`),
+			[]Tier{
+				{Width: 1080, Height: 1920, VideoBitrate: 3500_000},
+				{Width: 720, Height: 1280, VideoBitrate: 2500_000},
+				{Width: 360, Height: 640, VideoBitrate: 500_000},
+				{Width: 144, Height: 256, VideoBitrate: 100_000},
+			},
+		},
+		{
+			"displaymatrix-90",
+			generateProbe(1920, 1080, 8000, `"side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]`),
+			[]Tier{
+				{Width: 1080, Height: 1920, VideoBitrate: 3500_000},
+				{Width: 720, Height: 1280, VideoBitrate: 2500_000},
+				{Width: 360, Height: 640, VideoBitrate: 500_000},
+				{Width: 144, Height: 256, VideoBitrate: 100_000},
+			},
+		},
+		{
+			"rotate180",
+			generateProbe(1920, 1080, 8000, `"tags": {"rotate": "180"}`),
+			[]Tier{
+				{Width: 1920, Height: 1080, VideoBitrate: 3500_000},
+				{Width: 1280, Height: 720, VideoBitrate: 2500_000},
+				{Width: 640, Height: 360, VideoBitrate: 500_000},
+				{Width: 256, Height: 144, VideoBitrate: 100_000},
+			},
+		},
+		{
+			"anamorphic1440",
+			generateProbe(1440, 1080, 8000, `"sample_aspect_ratio": "4:3"`),
+			[]Tier{
+				{Width: 1920, Height: 1080, VideoBitrate: 3500_000},
+				{Width: 1280, Height: 720, VideoBitrate: 2500_000},
+				{Width: 640, Height: 360, VideoBitrate: 500_000},
+				{Width: 256, Height: 144, VideoBitrate: 100_000},
+			},
+		},
+		{
+			"anamorphicPAL",
+			generateProbe(720, 576, 5000, `"sample_aspect_ratio": "16:15"`),
+			[]Tier{
+				{Width: 768, Height: 576, VideoBitrate: nsRate(768, 576)},
+				{Width: 640, Height: 360, VideoBitrate: 500_000},
+				{Width: 256, Height: 144, VideoBitrate: 100_000},
+			},
+		},
+		{
+			"oddSize",
+			generateProbe(853, 481, 5000, `"sample_aspect_ratio": "1:1"`),
+			[]Tier{
+				{Width: 852, Height: 480, VideoBitrate: nsRate(852, 480)},
+				{Width: 640, Height: 360, VideoBitrate: 500_000},
+				{Width: 256, Height: 144, VideoBitrate: 100_000},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := WrapProbe(tc.probe)
+			require.NoError(t, err)
+			l, err := ladder.Tweak(m)
+			require.NoError(t, err)
+			require.Equal(t, len(tc.expectedTiers), len(l.Tiers), l.Tiers)
+			for i, tier := range l.Tiers {
+				assert.Equal(t, tc.expectedTiers[i].Width, tier.Width, tier)
+				assert.Equal(t, tc.expectedTiers[i].Height, tier.Height, tier)
+				assert.Equal(t, tc.expectedTiers[i].VideoBitrate, tier.VideoBitrate, tier)
+			}
+		})
+	}
+}
+
+func TestScaleFilterAnamorphic(t *testing.T) {
+	m, err := WrapProbe(generateProbe(1440, 1080, 8000, `"sample_aspect_ratio": "4:3"`))
+	require.NoError(t, err)
+	assert.True(t, m.Anamorphic())
+	args := Default.ArgumentSet("out", m)
+	assert.Equal(t, "scale=1280:720,setsar=1", args.scaleFilter(Tier{Height: 720}))
+
+	m, err = WrapProbe(generateProbe(1920, 1080, 8000, `"sample_aspect_ratio": "1:1"`))
+	require.NoError(t, err)
+	assert.False(t, m.Anamorphic())
+	args = Default.ArgumentSet("out", m)
+	assert.Equal(t, "scale=-2:720", args.scaleFilter(Tier{Height: 720}))
+}
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	premium := filepath.Join(dir, "premium.yml")
+	require.NoError(t, os.WriteFile(premium, []byte(`
+tiers:
+  - definition: 2160p
+    bitrate: 12000_000
+    audio_bitrate: 192k
+    width: 3840
+    height: 2160
+`), 0644))
+
+	r, err := LoadRegistry(map[string]Config{
+		"premium": {File: premium, Channels: []string{"@Premium#7"}, Queues: []string{"priority"}},
+	})
+	require.NoError(t, err)
+
+	l := r.Select("lbry://@premium:7", "common")
+	assert.Equal(t, "premium", l.Name)
+	assert.Equal(t, 2160, l.Tiers[0].Height)
+	assert.Equal(t, "premium", r.Select("lbry://@other:1", "priority").Name)
+	assert.Equal(t, DefaultName, r.Select("lbry://@other:1", "common").Name)
+	assert.Equal(t, Default.Tiers, r.Select("", "").Tiers)
+
+	assert.EqualError(t, r.MapQueue("level5", "missing"), "unknown ladder: missing")
+
+	_, err = LoadRegistry(map[string]Config{"broken": {File: filepath.Join(dir, "missing.yml")}})
+	assert.Error(t, err)
+
+	_, err = LoadRegistry(map[string]Config{
+		"premium": {File: premium, Channels: []string{"@Premium#7"}},
+		"vip":     {File: premium, Channels: []string{"lbry://@premium:7"}},
+	})
+	assert.EqualError(t, err, "channel lbry://@premium:7 is mapped to both premium and vip ladders")
+	_, err = LoadRegistry(map[string]Config{
+		"premium": {File: premium, Queues: []string{"priority"}},
+		"vip":     {File: premium, Queues: []string{"priority"}},
+	})
+	assert.EqualError(t, err, "queue priority is mapped to both premium and vip ladders")
+}
+
+// generateProbe returns ffprobe output for a video with a single audio track,
+// `extra` is added to video stream properties.
+func TestDetectVFR(t *testing.T) {
+	testCases := []struct {
+		rate string
+		vfr  bool
+	}{
+		{"30/1", false},
+		{"30000/1001", false},
+		{"120/1", true},
+		{"0/0", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.rate, func(t *testing.T) {
+			m, err := WrapProbe(generateProbe(1920, 1080, 8000, fmt.Sprintf(`"r_frame_rate": "%v"`, tc.rate)))
+			require.NoError(t, err)
+			assert.Equal(t, tc.vfr, m.VFR)
+		})
+	}
+}
+
+func generateProbe(w, h, br int, extra string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "width": %v, "height": %v, "avg_frame_rate": "30/1", "bit_rate": "%v", %v},
+			{"index": 1, "codec_type": "audio", "codec_name": "aac"}
+		],
+		"format": {"duration": "60.000000", "bit_rate": "%v"}
+	}`, w, h, br*1000, extra, br*1000))
+}
@@ -19,24 +19,41 @@ type Metadata struct {
 	FastStart   bool
 	VideoStream transcoder.Streams
 	AudioStream transcoder.Streams
+	// VideoRange and BitDepth are only detected when created with WrapProbe, SDR/8 bit are assumed otherwise.
+	VideoRange string
+	BitDepth   int
+	// DisplayWidth and DisplayHeight are video dimensions after applying rotation and sample aspect ratio,
+	// which are only detected when created with WrapProbe.
+	DisplayWidth, DisplayHeight int
+	Rotation                    int
+	SampleAspectRatio           float64
+	// Streams contains additional details for all media streams, only available when created with WrapProbe.
+	Streams []StreamInfo
+	// VFR is true for video with variable framerate, only detected when created with WrapProbe.
+	VFR bool
 }
 
 var fpsPattern = regexp.MustCompile(`^(\d+)/(\d+)$`)
 
+// vfrTolerance is the relative difference between base and average framerate
+// above which video framerate is considered variable.
+const vfrTolerance = 0.01
+
 func WrapMeta(fmeta *ffmpeg.Metadata) (*Metadata, error) {
 	m := &Metadata{
 		FMeta: fmeta,
 	}
-	vs := m.videoStream()
-	if vs == nil {
-		return nil, errors.New("no video stream found")
+	m.VideoStream = m.videoStream()
+	m.AudioStream = m.audioStream()
+	if m.VideoStream == nil && m.AudioStream == nil {
+		return nil, errors.New("no video or audio stream found")
 	}
-	m.VideoStream = vs
-	as := m.videoStream()
-	if as == nil {
-		return nil, errors.New("no audio stream found")
+	if m.VideoStream == nil {
+		return m, nil
 	}
-	m.AudioStream = as
+	m.VideoRange = VideoRangeSDR
+	m.BitDepth = 8
+	m.DisplayWidth, m.DisplayHeight = even(m.VideoStream.GetWidth()), even(m.VideoStream.GetHeight())
 
 	f, err := m.detectFPS()
 	if err != nil {
@@ -48,6 +65,16 @@ func WrapMeta(fmeta *ffmpeg.Metadata) (*Metadata, error) {
 	return m, nil
 }
 
+// HasVideo is false for audio-only media (podcasts, music).
+func (m *Metadata) HasVideo() bool {
+	return m.VideoStream != nil
+}
+
+// HasAudio is false for media with no sound track.
+func (m *Metadata) HasAudio() bool {
+	return m.AudioStream != nil
+}
+
 func (m *Metadata) videoStream() transcoder.Streams {
 	return GetVideoStream(m.FMeta)
 }
@@ -80,6 +107,33 @@ func (m *Metadata) detectFPS() (float64, error) {
 	return float64(fpsdd) / float64(fpsds), nil
 }
 
+// detectVFR compares base framerate of the video stream (the lowest framerate all timestamps can be
+// represented in) with its average framerate, which only match for constant framerate video.
+func (m *Metadata) detectVFR() {
+	for _, s := range m.Streams {
+		if s.CodecType != "video" {
+			continue
+		}
+		r, avg := parseRate(s.RFrameRate), parseRate(s.AvgFrameRate)
+		m.VFR = r > 0 && avg > 0 && math.Abs(r-avg)/r > vfrTolerance
+		return
+	}
+}
+
+// parseRate parses ffprobe rational like `30000/1001`, returning 0 for malformed values.
+func parseRate(r string) float64 {
+	m := fpsPattern.FindStringSubmatch(r)
+	if len(m) < 3 {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	d, _ := strconv.Atoi(m[2])
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
 func GetVideoStream(meta *ffmpeg.Metadata) transcoder.Streams {
 	for _, s := range meta.GetStreams() {
 		if s.GetCodecType() == "video" {
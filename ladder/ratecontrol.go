@@ -0,0 +1,131 @@
+package ladder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// Rate control modes for ladder tiers.
+const (
+	// RateControlCRF is constant rate factor capped at tier bitrate, the default mode.
+	RateControlCRF = "crf"
+	// RateControlCVBR is constrained VBR targeting tier bitrate with VBV buffer of `bufsize_factor` times the bitrate.
+	RateControlCVBR = "cvbr"
+	// RateControl2Pass is two-pass ABR targeting tier bitrate, the first pass is run by the encoder
+	// before the main transcoding.
+	RateControl2Pass = "2pass"
+
+	defaultBufsizeFactor = 2.0
+
+	// passLogPrefix is completed by ffmpeg with output stream index and `.log` extension.
+	passLogPrefix = "passlog_%v"
+)
+
+// crfUnset are values which disable constant rate factor mode for codecs, making them follow target bitrate.
+var crfUnset = map[string]string{
+	CodecH264:   "-1",
+	CodecHEVC:   "-1",
+	CodecAV1:    "0",
+	CodecAV1AOM: "-1",
+}
+
+// muxerArguments are options that only make sense for the main output and are dropped from the first pass.
+var muxerArguments = map[string]bool{
+	"f":                 true,
+	"c:a":               true,
+	"ac":                true,
+	"ar":                true,
+	"master_pl_name":    true,
+	"strftime_mkdir":    true,
+	"use_template":      true,
+	"use_timeline":      true,
+	"init_seg_name":     true,
+	"media_seg_name":    true,
+	argVarStreamMap:     true,
+	argSegDuration:      true,
+	argAdaptationSets:   true,
+	"hls_playlist_type": true,
+}
+
+// TierRateControl returns rate control mode the tier is going to be encoded with.
+func TierRateControl(t Tier) string {
+	if t.RateControl == "" {
+		return RateControlCRF
+	}
+	return t.RateControl
+}
+
+// tierTwoPass is true if the tier is encoded in two passes.
+func tierTwoPass(t Tier) bool {
+	return t.Definition != DAudio && !t.Passthrough && TierRateControl(t) == RateControl2Pass
+}
+
+// TwoPass is true if any of ladder tiers needs a first encoding pass.
+func (l Ladder) TwoPass() bool {
+	for _, t := range l.Tiers {
+		if tierTwoPass(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// FirstPassArguments returns ffmpeg arguments for the first pass of two-pass tiers.
+// The output goes nowhere, only pass log files are produced, so the caller should append
+// a null output (os.DevNull) to the returned arguments.
+func (a *ArgumentSet) FirstPassArguments() []string {
+	args, _ := a.outputArguments(true)
+	return args
+}
+
+// rateControlArguments returns bitrate control options for output video stream with the index of `s`,
+// `n` is the number of the tier in the ladder. Two-pass tiers get the same options in both passes
+// so the first one analyses the video at the target bitrate.
+func (a *ArgumentSet) rateControlArguments(tier Tier, n int, s string, firstPass bool) []string {
+	if tier.Passthrough {
+		return nil
+	}
+	br := strconv.Itoa(tier.VideoBitrate)
+	codec := a.Ladder.TierCodec(tier)
+	switch TierRateControl(tier) {
+	case RateControlCVBR:
+		return []string{
+			"-crf:v:" + s, crfUnset[codec],
+			"-b:v:" + s, br,
+			"-maxrate:v:" + s, br,
+			"-bufsize:v:" + s, bufsize(tier),
+		}
+	case RateControl2Pass:
+		pass := "2"
+		if firstPass {
+			pass = "1"
+		}
+		return []string{
+			"-crf:v:" + s, crfUnset[codec],
+			"-b:v:" + s, br,
+			"-maxrate:v:" + s, br,
+			"-bufsize:v:" + s, bufsize(tier),
+			"-pass:v:" + s, pass,
+			"-passlogfile:v:" + s, a.passLogPrefix(n),
+		}
+	}
+	return []string{"-maxrate:v:" + s, br, "-bufsize:v:" + s, br}
+}
+
+// passLogPrefix returns path prefix of first pass statistics files for the tier number `n`.
+func (a *ArgumentSet) passLogPrefix(n int) string {
+	dir := a.PassLogDir
+	if dir == "" {
+		dir = a.Output
+	}
+	return filepath.Join(dir, fmt.Sprintf(passLogPrefix, n))
+}
+
+func bufsize(t Tier) string {
+	f := t.BufsizeFactor
+	if f == 0 {
+		f = defaultBufsizeFactor
+	}
+	return strconv.Itoa(int(float64(t.VideoBitrate) * f))
+}
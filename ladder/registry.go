@@ -0,0 +1,131 @@
+package ladder
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Config describes a named ladder as listed under `Ladders` in transcoder and tower configuration files.
+type Config struct {
+	// File is a path to ladder YAML definition.
+	File string
+	// Channels are LBRY channel URLs whose videos should be transcoded with the ladder.
+	Channels []string
+	// Queues are names of manager pool queues whose requests should be transcoded with the ladder.
+	Queues []string
+}
+
+// Registry holds named ladders and picks one for a video based on its channel or the queue it came from.
+// Videos not matching any configured channel or queue get Default ladder.
+type Registry struct {
+	ladders  map[string]Ladder
+	channels map[string]string
+	queues   map[string]string
+}
+
+// NewRegistry creates a registry containing only Default ladder.
+func NewRegistry() *Registry {
+	r := &Registry{
+		ladders:  map[string]Ladder{},
+		channels: map[string]string{},
+		queues:   map[string]string{},
+	}
+	r.Add(DefaultName, Default)
+	return r
+}
+
+// LoadRegistry creates a registry with ladders loaded from files listed in `configs`.
+// A channel or queue may only be mapped to one ladder.
+func LoadRegistry(configs map[string]Config) (*Registry, error) {
+	r := NewRegistry()
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := configs[name]
+		l, err := LoadFile(c.File)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load ladder %v", name)
+		}
+		r.Add(name, l)
+		for _, ch := range c.Channels {
+			if other, ok := r.channels[normalizeChannel(ch)]; ok && other != name {
+				return nil, fmt.Errorf("channel %v is mapped to both %v and %v ladders", ch, other, name)
+			}
+			if err := r.MapChannel(ch, name); err != nil {
+				return nil, err
+			}
+		}
+		for _, q := range c.Queues {
+			if other, ok := r.queues[q]; ok && other != name {
+				return nil, fmt.Errorf("queue %v is mapped to both %v and %v ladders", q, other, name)
+			}
+			if err := r.MapQueue(q, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// LoadFile reads ladder definition from YAML file.
+func LoadFile(path string) (Ladder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Ladder{}, err
+	}
+	return Load(data)
+}
+
+// Add registers ladder under `name`, replacing the one already registered.
+func (r *Registry) Add(name string, l Ladder) {
+	l.Name = name
+	r.ladders[name] = l
+}
+
+// Get returns ladder registered under `name`.
+func (r *Registry) Get(name string) (Ladder, bool) {
+	l, ok := r.ladders[name]
+	return l, ok
+}
+
+// MapChannel makes videos from `channel` transcoded with ladder `name`.
+func (r *Registry) MapChannel(channel, name string) error {
+	if _, ok := r.ladders[name]; !ok {
+		return fmt.Errorf("unknown ladder: %v", name)
+	}
+	r.channels[normalizeChannel(channel)] = name
+	return nil
+}
+
+// MapQueue makes videos admitted to the manager pool queue `queue` transcoded with ladder `name`.
+func (r *Registry) MapQueue(queue, name string) error {
+	if _, ok := r.ladders[name]; !ok {
+		return fmt.Errorf("unknown ladder: %v", name)
+	}
+	r.queues[queue] = name
+	return nil
+}
+
+// Select returns ladder for a video from `channel` admitted to `queue`.
+// Channel mapping takes precedence over queue mapping, Default ladder is returned when neither matches.
+func (r *Registry) Select(channel, queue string) Ladder {
+	if name, ok := r.channels[normalizeChannel(channel)]; ok {
+		return r.ladders[name]
+	}
+	if name, ok := r.queues[queue]; ok {
+		return r.ladders[name]
+	}
+	return r.ladders[DefaultName]
+}
+
+// normalizeChannel brings channel URLs like `@channel#7` and `lbry://@channel:7` to the same form.
+func normalizeChannel(channel string) string {
+	return strings.Replace(strings.ToLower(strings.TrimPrefix(channel, "lbry://")), "#", ":", 1)
+}
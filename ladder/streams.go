@@ -0,0 +1,203 @@
+package ladder
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/floostack/transcoder"
+	"github.com/floostack/transcoder/ffmpeg"
+	"github.com/pkg/errors"
+)
+
+// StreamInfo contains stream properties reported by ffprobe which are not exposed by ffmpeg.Metadata.
+type StreamInfo struct {
+	Index       int               `json:"index"`
+	CodecType   string            `json:"codec_type"`
+	CodecName   string            `json:"codec_name"`
+	Tags        map[string]string `json:"tags"`
+	Disposition map[string]int    `json:"disposition"`
+
+	Profile          string `json:"profile"`
+	PixFmt           string `json:"pix_fmt"`
+	ColorTransfer    string `json:"color_transfer"`
+	ColorPrimaries   string `json:"color_primaries"`
+	ColorSpace       string `json:"color_space"`
+	BitsPerRawSample string `json:"bits_per_raw_sample"`
+
+	SampleAspectRatio string     `json:"sample_aspect_ratio"`
+	SideDataList      []SideData `json:"side_data_list"`
+
+	RFrameRate   string `json:"r_frame_rate"`
+	AvgFrameRate string `json:"avg_frame_rate"`
+}
+
+// AudioTrack describes an audio stream of the source that ends up in the transcoded stream.
+type AudioTrack struct {
+	// Index is the number of the stream among source audio streams (as in `-map a:N`).
+	Index    int
+	Language string `yaml:",omitempty"`
+	Name     string `yaml:",omitempty"`
+	Default  bool   `yaml:",omitempty"`
+}
+
+// SubtitleTrack describes a text subtitle track, either embedded into the source or supplied as a separate file.
+type SubtitleTrack struct {
+	// Index is the number of the stream among source subtitle streams (as in `-map s:N`).
+	Index int `yaml:"-"`
+	// File is set for subtitles supplied in a separate (sidecar) file.
+	File     string `yaml:"-"`
+	Language string `yaml:",omitempty"`
+	Name     string `yaml:",omitempty"`
+	Default  bool   `yaml:",omitempty"`
+	Forced   bool   `yaml:",omitempty"`
+	// URI is the name of subtitle media playlist in the transcoded stream.
+	URI string `yaml:",omitempty"`
+}
+
+// textSubtitleCodecs are subtitle formats that can be converted to WebVTT.
+// Bitmap-based subtitles (PGS, DVD, DVB) are not supported.
+var textSubtitleCodecs = map[string]bool{
+	"subrip":   true,
+	"srt":      true,
+	"ass":      true,
+	"ssa":      true,
+	"mov_text": true,
+	"webvtt":   true,
+	"text":     true,
+}
+
+// WrapProbe parses ffprobe JSON output (-show_format -show_streams) into Metadata.
+func WrapProbe(raw []byte) (*Metadata, error) {
+	fmeta := &ffmpeg.Metadata{}
+	if err := json.Unmarshal(raw, fmeta); err != nil {
+		return nil, errors.Wrap(err, "cannot parse ffprobe output")
+	}
+	m, err := WrapMeta(fmeta)
+	if err != nil {
+		return nil, err
+	}
+
+	probe := struct {
+		Streams []StreamInfo `json:"streams"`
+	}{}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, errors.Wrap(err, "cannot parse ffprobe streams")
+	}
+	m.Streams = probe.Streams
+	if m.HasVideo() {
+		m.detectColor()
+		m.detectDisplaySize()
+		m.detectVFR()
+	}
+
+	if tracks := m.AudioTracks(); len(tracks) > 1 {
+		for _, t := range tracks {
+			if t.Default {
+				if s := m.nthStream("audio", t.Index); s != nil {
+					m.AudioStream = s
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// AudioTracks returns all audio streams of the source, exactly one of them is marked as default.
+func (m *Metadata) AudioTracks() []AudioTrack {
+	tracks := []AudioTrack{}
+	var defaultSeen bool
+	for _, s := range m.Streams {
+		if s.CodecType != "audio" {
+			continue
+		}
+		t := AudioTrack{Index: len(tracks)}
+		if lang := s.Tags["language"]; lang != "" && lang != "und" {
+			t.Language = lang
+		}
+		t.Name = s.Tags["title"]
+		if t.Name == "" {
+			if t.Language != "" {
+				t.Name = t.Language
+			} else {
+				t.Name = fmt.Sprintf("Track %v", t.Index+1)
+			}
+		}
+		if s.Disposition["default"] == 1 && !defaultSeen {
+			t.Default = true
+			defaultSeen = true
+		}
+		tracks = append(tracks, t)
+	}
+	if len(tracks) == 0 && m.HasAudio() {
+		// Stream details were not supplied, falling back to the first audio stream.
+		tracks = append(tracks, AudioTrack{Index: 0, Name: "Track 1"})
+	}
+	if len(tracks) > 0 && !defaultSeen {
+		tracks[0].Default = true
+	}
+	return tracks
+}
+
+// SubtitleTracks returns embedded subtitle streams of the source which can be converted to WebVTT.
+func (m *Metadata) SubtitleTracks() []SubtitleTrack {
+	tracks := []SubtitleTrack{}
+	var n int
+	for _, s := range m.Streams {
+		if s.CodecType != "subtitle" {
+			continue
+		}
+		index := n
+		n++
+		if !textSubtitleCodecs[s.CodecName] {
+			continue
+		}
+		t := SubtitleTrack{
+			Index:   index,
+			Name:    s.Tags["title"],
+			Default: s.Disposition["default"] == 1,
+			Forced:  s.Disposition["forced"] == 1,
+		}
+		if lang := s.Tags["language"]; lang != "" && lang != "und" {
+			t.Language = lang
+		}
+		if t.Name == "" {
+			if t.Language != "" {
+				t.Name = t.Language
+			} else {
+				t.Name = fmt.Sprintf("Subtitles %v", index+1)
+			}
+		}
+		tracks = append(tracks, t)
+	}
+	return tracks
+}
+
+// defaultAudioTrack returns index of the audio stream that should be used when only one can be included.
+func (m *Metadata) defaultAudioTrack() int {
+	for _, t := range m.AudioTracks() {
+		if t.Default {
+			return t.Index
+		}
+	}
+	return 0
+}
+
+func (m *Metadata) nthStream(codecType string, n int) transcoder.Streams {
+	var i int
+	for _, s := range m.FMeta.GetStreams() {
+		if s.GetCodecType() != codecType {
+			continue
+		}
+		if i == n {
+			return s
+		}
+		i++
+	}
+	return nil
+}
+
+// varStreamMapValue makes value safe for use in ffmpeg -var_stream_map, which uses spaces and commas as separators.
+func varStreamMapValue(v string) string {
+	return strings.NewReplacer(" ", "_", ",", "_", ":", "_").Replace(v)
+}
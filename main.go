@@ -130,13 +130,22 @@ func main() {
 			cfg.GetStringSlice("disabledchannels"),
 		)
 
+		ladderCfg := map[string]ladder.Config{}
+		if err := cfg.UnmarshalKey("ladders", &ladderCfg); err != nil {
+			logger.Fatalw("unable to read ladders config", "err", err)
+		}
+		ladders, err := ladder.LoadRegistry(ladderCfg)
+		if err != nil {
+			logger.Fatalw("unable to load ladders", "err", err)
+		}
+
 		cleanStopChan := video.SpawnLibraryCleaning(lib)
 
 		adQueue := cfg.GetStringMapString("adaptivequeue")
 		minHits, _ := strconv.Atoi(adQueue["minhits"])
 		mgr := manager.NewManager(lib, minHits)
 
-		encStopChan := workers.SpawnEncoderWorkers(CLI.Serve.Workers, mgr)
+		encStopChan := workers.SpawnEncoderWorkers(CLI.Serve.Workers, mgr, ladders)
 
 		httpAPI := manager.NewHttpAPI(
 			manager.ConfigureHttpAPI().
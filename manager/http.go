@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -74,7 +75,7 @@ func AttachVideoHandler(r *router.Router, prefix, videoPath string, manager *Vid
 	g := r.Group(prefix)
 
 	// r.GET("/api/v1/video/{kind:hls}/{url}/{sdHash:[a-z0-9]{96}}", h.handleVideo)
-	g.GET("/api/v1/video/{kind:hls}/{url}", h.handleVideo)
+	g.GET("/api/v1/video/{kind:hls|dash}/{url}", h.handleVideo)
 	g.GET("/api/v2/video/{url}", h.handleVideo)
 	g.GET("/api/v3/video", h.handleVideo) // accepts URL as a query param
 	g.GET(httpVideoPath+"/{filepath:*}", func(ctx *fasthttp.RequestCtx) {
@@ -171,10 +172,10 @@ func (h httpVideoHandler) handleVideo(ctx *fasthttp.RequestCtx) {
 			statusCode = http.StatusForbidden
 		case ErrNoSigningChannel:
 			statusCode = http.StatusForbidden
-		case ErrTranscodingQueued:
-			statusCode = http.StatusAccepted
-		case ErrTranscodingUnderway:
-			statusCode = http.StatusAccepted
+		case ErrTranscodingQueued, ErrTranscodingUnderway:
+			ll.Debug(err.Error())
+			h.writeProgress(ctx, videoURL)
+			return
 		case ErrStreamNotFound:
 			statusCode = http.StatusNotFound
 		default:
@@ -219,8 +220,17 @@ func (h httpVideoHandler) handleVideo(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	ctx.Response.StatusCode()
 	location, remote := v.GetLocation()
+	if kind, _ := ctx.UserValue("kind").(string); kind != "" {
+		var ok bool
+		location, remote, ok = v.GetTypeLocation(kind)
+		if !ok {
+			ll.Debugw("stream type not available", "kind", kind, "type", v.Type)
+			ctx.SetStatusCode(http.StatusNotFound)
+			fmt.Fprintf(ctx, "stream is not available as %v", kind)
+			return
+		}
+	}
 	if !remote {
 		metrics.StreamsRequestedCount.WithLabelValues(metrics.StorageLocal).Inc()
 		location = fmt.Sprintf("%v/%v", httpVideoPath, location)
@@ -231,6 +241,15 @@ func (h httpVideoHandler) handleVideo(ctx *fasthttp.RequestCtx) {
 	ctx.Redirect(location, http.StatusSeeOther)
 }
 
+// writeProgress responds with 202 and transcoding progress of the stream.
+func (h httpVideoHandler) writeProgress(ctx *fasthttp.RequestCtx, videoURL string) {
+	ctx.SetStatusCode(http.StatusAccepted)
+	ctx.SetContentType("application/json")
+	if err := json.NewEncoder(ctx).Encode(h.manager.Progress(videoURL)); err != nil {
+		h.log.Error("failure encoding transcoding progress", "url", videoURL, "err", err)
+	}
+}
+
 func handlePanic(ctx *fasthttp.RequestCtx, p interface{}) {
 	ctx.SetStatusCode(http.StatusInternalServerError)
 	logger.Errorw("panicked", "url", ctx.Request.URI(), "panic", p)
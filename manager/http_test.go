@@ -1,12 +1,22 @@
 package manager
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/lbryio/transcoder/pkg/logging"
+	"github.com/lbryio/transcoder/video"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stretchr/testify/suite"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
 )
 
 type httpSuite struct {
@@ -29,3 +39,28 @@ func (s *httpSuite) TestPromHttp() {
 	s.HTTPBodyContains(promhttp.Handler().ServeHTTP, http.MethodGet, "/metrics", nil, "transcoding_queue_length")
 	s.HTTPBodyContains(promhttp.Handler().ServeHTTP, http.MethodGet, "/metrics", nil, "transcoding_queue_hits")
 }
+
+func (s *httpSuite) TestVideoKind() {
+	uri := "@specialoperationstest#3/fear-of-death-inspirational#a"
+	mgr := NewManager(&vlib{ret: &video.Video{SDHash: "abc", RemotePath: "abc", Type: ladder.TypeDASH}}, 0)
+	mgr.cache.Set("claim:"+uri, &TranscodingRequest{URI: uri, SDHash: "abc"}, time.Minute)
+	r := router.New()
+	AttachVideoHandler(r, "", "", mgr, logging.NoopKVLogger{})
+
+	get := func(kind string) *fasthttp.Response {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(fmt.Sprintf("/api/v1/video/%v/%v", kind, url.PathEscape("lbry://"+uri)))
+		r.Handler(ctx)
+		return &ctx.Response
+	}
+
+	resp := get("dash")
+	s.Equal(http.StatusSeeOther, resp.StatusCode())
+	s.Equal("remote://abc/manifest.mpd", string(resp.Header.Peek("Location")))
+
+	resp = get("hls")
+	s.Equal(http.StatusNotFound, resp.StatusCode())
+	s.Equal("stream is not available as hls", string(resp.Body()))
+
+	s.Equal(http.StatusNotFound, get("smooth").StatusCode())
+}
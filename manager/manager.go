@@ -51,11 +51,23 @@ func LoadConfiguredChannels(priority, enabled, disabled []string) {
 }
 
 type VideoManager struct {
-	library VideoLibrary
-	pool    *Pool
-	cache   *ccache.Cache
+	library  VideoLibrary
+	pool     *Pool
+	cache    *ccache.Cache
+	progress ProgressSource
 }
 
+// TranscodingProgress is returned to clients requesting a stream which is not transcoded yet.
+type TranscodingProgress struct {
+	Progress int        `json:"progress"`
+	Speed    float64    `json:"speed,omitempty"`
+	ETA      int        `json:"eta,omitempty"`
+	Started  *time.Time `json:"started,omitempty"`
+}
+
+// ProgressSource looks up transcoding progress of a stream, ok is false if the stream is not being transcoded.
+type ProgressSource func(sdHash string) (p TranscodingProgress, ok bool)
+
 // NewManager creates a video library manager with a pool for future transcoding requests.
 func NewManager(l VideoLibrary, minHits int) *VideoManager {
 	m := &VideoManager{
@@ -72,6 +84,7 @@ func NewManager(l VideoLibrary, minHits int) *VideoManager {
 			if e == r.ChannelURI {
 				logger.Infow("accepted for 'priority' queue", "uri", r.URI)
 				r.queue = queue
+				r.Queue = "priority"
 				queue.Hit(key, r)
 				return true
 			}
@@ -85,6 +98,7 @@ func NewManager(l VideoLibrary, minHits int) *VideoManager {
 			if e == r.ChannelURI {
 				logger.Debugw("accepted for 'enabled' queue", "uri", r.URI)
 				r.queue = queue
+				r.Queue = "enabled"
 				queue.Hit(key, r)
 				return true
 			}
@@ -99,6 +113,7 @@ func NewManager(l VideoLibrary, minHits int) *VideoManager {
 		if s >= level5SupportThreshold {
 			logger.Debugw("accepted for 'level5' queue", "uri", r.URI, "support_amount", r.ChannelSupportAmount)
 			r.queue = queue
+			r.Queue = "level5"
 			queue.Hit(key, r)
 			return true
 		}
@@ -108,6 +123,7 @@ func NewManager(l VideoLibrary, minHits int) *VideoManager {
 	m.pool.AddQueue("common", uint(minHits), func(key string, value interface{}, queue *mfr.Queue) bool {
 		r := value.(*TranscodingRequest)
 		r.queue = queue
+		r.Queue = "common"
 		queue.Hit(key, r)
 		return true
 	})
@@ -117,6 +133,12 @@ func NewManager(l VideoLibrary, minHits int) *VideoManager {
 	return m
 }
 
+// SetProgressSource configures where transcoding progress of streams is looked up.
+// Should be called before the manager starts serving requests.
+func (m *VideoManager) SetProgressSource(s ProgressSource) {
+	m.progress = s
+}
+
 func (m *VideoManager) Pool() *Pool {
 	return m.pool
 }
@@ -157,6 +179,26 @@ func (m *VideoManager) Video(uri string) (*video.Video, error) {
 	return v, nil
 }
 
+// Progress returns transcoding progress of the stream at `uri`.
+// Progress of streams waiting in the queue or without a progress source configured is zero.
+func (m *VideoManager) Progress(uri string) TranscodingProgress {
+	if m.progress == nil {
+		return TranscodingProgress{}
+	}
+	tr, err := m.resolveRequest(strings.TrimPrefix(uri, "lbry://"))
+	if err != nil {
+		return TranscodingProgress{}
+	}
+	item, err := m.cache.Fetch(fmt.Sprintf("progress:%v", tr.SDHash), 5*time.Second, func() (interface{}, error) {
+		p, _ := m.progress(tr.SDHash)
+		return p, nil
+	})
+	if err != nil {
+		return TranscodingProgress{}
+	}
+	return item.Value().(TranscodingProgress)
+}
+
 // Requests returns next transcoding request to be processed. It polls all queues in the pool evenly.
 func (m *VideoManager) Requests() <-chan *TranscodingRequest {
 	out := make(chan *TranscodingRequest)
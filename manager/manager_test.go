@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/lbryio/transcoder/pkg/logging"
 	"github.com/lbryio/transcoder/pkg/mfr"
@@ -184,6 +185,22 @@ func (s *managerSuite) TestRequests() {
 	s.NotNil(r1)
 }
 
+func (s *managerSuite) TestProgress() {
+	mgr := NewManager(&vlib{ret: nil}, 0)
+	uri := "@specialoperationstest#3/fear-of-death-inspirational#a"
+	mgr.cache.Set("claim:"+uri, &TranscodingRequest{URI: uri, SDHash: "abc"}, time.Minute)
+	s.Equal(TranscodingProgress{}, mgr.Progress("lbry://"+uri))
+
+	started := time.Now()
+	mgr.SetProgressSource(func(sdHash string) (TranscodingProgress, bool) {
+		if sdHash != "abc" {
+			return TranscodingProgress{}, false
+		}
+		return TranscodingProgress{Progress: 42, Speed: 1.5, ETA: 30, Started: &started}, true
+	})
+	s.Equal(TranscodingProgress{Progress: 42, Speed: 1.5, ETA: 30, Started: &started}, mgr.Progress("lbry://"+uri))
+}
+
 func TestValidateIncomingVideo(t *testing.T) {
 }
 
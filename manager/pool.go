@@ -41,6 +41,17 @@ func (p *Pool) AddQueue(name string, minHits uint, k Gatekeeper) {
 	p.levels = append(p.levels, &level{name: name, queue: mfr.NewQueue(), keeper: k, minHits: minHits})
 }
 
+// Priority returns numeric priority of the named queue. Queues added earlier have higher priority,
+// unknown queues get 0.
+func (p *Pool) Priority(name string) int32 {
+	for i, l := range p.levels {
+		if l.name == name {
+			return int32(len(p.levels) - i)
+		}
+	}
+	return 0
+}
+
 // Admit retries to put item into the first queue that would accept it.
 // Queues are traversed in the same order they are added.
 // If gatekeeper returns an error, admission stops and the error is returned to the caller.
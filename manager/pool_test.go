@@ -112,3 +112,14 @@ func (s *poolSuite) TestPoolMinHits() {
 	pool.Admit(c.url, c)
 	s.Nil(pool.Next())
 }
+
+func (s *poolSuite) TestPoolPriority() {
+	pool := NewPool()
+	for _, name := range []string{"priority", "enabled", "common"} {
+		pool.AddQueue(name, 0, func(k string, v interface{}, q *mfr.Queue) bool { return false })
+	}
+	s.EqualValues(3, pool.Priority("priority"))
+	s.EqualValues(2, pool.Priority("enabled"))
+	s.EqualValues(1, pool.Priority("common"))
+	s.EqualValues(0, pool.Priority("unknown"))
+}
@@ -35,6 +35,8 @@ type WriteCounter struct {
 
 type TranscodingRequest struct {
 	queue *mfr.Queue
+	// Queue is the name of the pool queue the request was admitted to.
+	Queue string
 
 	URI, Name, ClaimID, SDHash, ChannelURI, NormalizedName string
 	ChannelSupportAmount                                   int64
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	mpdTemplateRe = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth)(%0(\d+)d)?\$`)
+	mpdDurationRe = regexp.MustCompile(`^PT(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?$`)
+)
+
+type mpdManifest struct {
+	XMLName  xml.Name    `xml:"MPD"`
+	Duration string      `xml:"mediaPresentationDuration,attr"`
+	Periods  []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+	Representations []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID              string              `xml:"id,attr"`
+	Bandwidth       string              `xml:"bandwidth,attr"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type mpdSegmentTemplate struct {
+	Initialization string           `xml:"initialization,attr"`
+	Media          string           `xml:"media,attr"`
+	StartNumber    *int             `xml:"startNumber,attr"`
+	Timescale      int              `xml:"timescale,attr"`
+	Duration       int64            `xml:"duration,attr"`
+	Timeline       []mpdTimelineSeg `xml:"SegmentTimeline>S"`
+}
+
+type mpdTimelineSeg struct {
+	T *int64 `xml:"t,attr"`
+	D int64  `xml:"d,attr"`
+	R int    `xml:"r,attr"`
+}
+
+// mpdFiles parses a DASH manifest and returns names of all initialization and media segments it references,
+// in the order they are listed in the manifest.
+func mpdFiles(data []byte) ([]string, error) {
+	m := mpdManifest{}
+	if err := xml.Unmarshal(data, &m); err != nil {
+		return nil, errors.Wrap(err, "cannot parse dash manifest")
+	}
+
+	files := []string{}
+	for _, p := range m.Periods {
+		for _, as := range p.AdaptationSets {
+			for _, r := range as.Representations {
+				tpl := r.SegmentTemplate
+				if tpl == nil {
+					tpl = as.SegmentTemplate
+				}
+				if tpl == nil {
+					return nil, fmt.Errorf("representation %v has no segment template", r.ID)
+				}
+				rf, err := tpl.files(r, m.Duration)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, rf...)
+			}
+		}
+	}
+	return files, nil
+}
+
+func (t mpdSegmentTemplate) files(r mpdRepresentation, mpdDuration string) ([]string, error) {
+	files := []string{}
+	number := 1
+	if t.StartNumber != nil {
+		number = *t.StartNumber
+	}
+
+	if t.Initialization != "" {
+		files = append(files, expandMPDTemplate(t.Initialization, r, 0, 0))
+	}
+
+	if len(t.Timeline) > 0 {
+		var ts int64
+		for _, s := range t.Timeline {
+			if s.T != nil {
+				ts = *s.T
+			}
+			for i := 0; i <= s.R; i++ {
+				files = append(files, expandMPDTemplate(t.Media, r, number, ts))
+				number++
+				ts += s.D
+			}
+		}
+		return files, nil
+	}
+
+	if t.Duration == 0 {
+		return nil, fmt.Errorf("representation %v has neither segment timeline nor segment duration", r.ID)
+	}
+	total, err := parseMPDDuration(mpdDuration)
+	if err != nil {
+		return nil, err
+	}
+	timescale := t.Timescale
+	if timescale == 0 {
+		timescale = 1
+	}
+	count := int(math.Ceil(total * float64(timescale) / float64(t.Duration)))
+	for i := 0; i < count; i++ {
+		files = append(files, expandMPDTemplate(t.Media, r, number+i, int64(i)*t.Duration))
+	}
+	return files, nil
+}
+
+func expandMPDTemplate(tpl string, r mpdRepresentation, number int, ts int64) string {
+	return mpdTemplateRe.ReplaceAllStringFunc(tpl, func(m string) string {
+		sm := mpdTemplateRe.FindStringSubmatch(m)
+		var v string
+		switch sm[1] {
+		case "RepresentationID":
+			return r.ID
+		case "Bandwidth":
+			v = r.Bandwidth
+		case "Number":
+			v = strconv.Itoa(number)
+		case "Time":
+			v = strconv.FormatInt(ts, 10)
+		}
+		if sm[3] != "" {
+			width, _ := strconv.Atoi(sm[3])
+			for len(v) < width {
+				v = "0" + v
+			}
+		}
+		return v
+	})
+}
+
+func parseMPDDuration(d string) (float64, error) {
+	m := mpdDurationRe.FindStringSubmatch(d)
+	if m == nil {
+		return 0, fmt.Errorf("cannot parse dash manifest duration: %q", d)
+	}
+	var total float64
+	for i, mult := range []float64{3600, 60, 1} {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, err
+		}
+		total += v * mult
+	}
+	return total, nil
+}
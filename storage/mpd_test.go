@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Pallinder/go-randomdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMPDFiles(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/dummy-dash/manifest.mpd")
+	require.NoError(t, err)
+
+	files, err := mpdFiles(data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"init_0.mp4", "chunk_0_00001.m4s", "chunk_0_00002.m4s", "chunk_0_00003.m4s",
+		"init_1.mp4", "chunk_1_00001.m4s", "chunk_1_00002.m4s", "chunk_1_00003.m4s",
+		"init_2.mp4", "chunk_2_00001.m4s", "chunk_2_00002.m4s", "chunk_2_00003.m4s",
+	}, files)
+}
+
+func TestMPDFilesNoTimeline(t *testing.T) {
+	data := []byte(`<MPD mediaPresentationDuration="PT1M0.5S"><Period><AdaptationSet>
+		<SegmentTemplate timescale="1000" duration="6000" initialization="i-$RepresentationID$.mp4" media="s-$RepresentationID$-$Number$.m4s" startNumber="0"/>
+		<Representation id="v0"/>
+	</AdaptationSet></Period></MPD>`)
+
+	files, err := mpdFiles(data)
+	require.NoError(t, err)
+	require.Len(t, files, 12)
+	assert.Equal(t, "i-v0.mp4", files[0])
+	assert.Equal(t, "s-v0-0.m4s", files[1])
+	assert.Equal(t, "s-v0-10.m4s", files[11])
+}
+
+func TestWalkPlaylistsDASH(t *testing.T) {
+	dir := path.Join(t.TempDir(), randomdata.Alphanumeric(96))
+	require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+
+	mpd, err := ioutil.ReadFile("./testdata/dummy-dash/manifest.mpd")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, DASHManifestName), mpd, os.ModePerm))
+	files, err := mpdFiles(mpd)
+	require.NoError(t, err)
+	for _, f := range files {
+		require.NoError(t, ioutil.WriteFile(path.Join(dir, f), make([]byte, 1000), os.ModePerm))
+	}
+
+	ls, err := OpenLocalStream(dir, &Manifest{})
+	require.NoError(t, err)
+	assert.Equal(t, DASHManifestName, ls.EntryPoint())
+
+	seen := []string{}
+	err = ls.WalkPlaylists(readFile, func(data []byte, name string) error {
+		seen = append(seen, name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, append([]string{DASHManifestName}, files...), seen)
+
+	require.NoError(t, ls.FillManifest())
+	assert.NotEmpty(t, ls.Manifest.Checksum)
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
-	"path"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -109,7 +108,7 @@ func (s *S3Driver) PutWithContext(ctx context.Context, ls *LocalStream, overwrit
 		dl := s3manager.NewDownloader(s.session)
 		_, err := dl.Download(discardAt{}, &s3.GetObjectInput{
 			Bucket: aws.String(s.bucket),
-			Key:    aws.String(s3Key(ls.SDHash(), MasterPlaylistName)),
+			Key:    aws.String(s3Key(ls.SDHash(), ls.EntryPoint())),
 		})
 		if err == nil {
 			return &RemoteStream{URL: ls.SDHash(), Manifest: ls.Manifest}, ErrStreamExists
@@ -120,19 +119,14 @@ func (s *S3Driver) PutWithContext(ctx context.Context, ls *LocalStream, overwrit
 	ul := s3manager.NewUploader(s.session)
 	err := ls.Walk(
 		func(fi fs.FileInfo, fullPath, name string) error {
-			var ctype string
 			f, err := os.Open(fullPath)
 			if err != nil {
 				return err
 			}
 			defer f.Close()
 
-			switch path.Ext(name) {
-			case PlaylistExt:
-				ctype = PlaylistContentType
-			case FragmentExt:
-				ctype = FragmentContentType
-			default:
+			ctype := ContentType(name)
+			if ctype == "" {
 				ctype = "text/plain"
 			}
 			logger.Debugw("uploading", "key", s3Key(ls.SDHash(), name), "ctype", ctype, "size", fi.Size(), "bucket", s.bucket)
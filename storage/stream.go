@@ -28,6 +28,20 @@ const (
 	PlaylistContentType = "application/x-mpegurl"
 	FragmentContentType = "video/mp2t"
 
+	DASHManifestName        = "manifest.mpd"
+	DASHManifestExt         = ".mpd"
+	DASHManifestContentType = "application/dash+xml"
+	FMP4FragmentExt         = ".m4s"
+	FMP4FragmentContentType = "video/iso.segment"
+	FMP4InitExt             = ".mp4"
+	FMP4InitContentType     = "video/mp4"
+	SubtitleExt             = ".vtt"
+	SubtitleContentType     = "text/vtt"
+	ThumbnailExt            = ".jpg"
+	ThumbnailContentType    = "image/jpeg"
+	PreviewWebPExt          = ".webp"
+	PreviewWebPContentType  = "image/webp"
+
 	SkipChecksum = "SkipChecksumForThisStream"
 )
 
@@ -54,7 +68,17 @@ type Manifest struct {
 	Size       int64  `yaml:",omitempty"`
 	Checksum   string `yaml:",omitempty"`
 
-	Ladder ladder.Ladder `yaml:",omitempty,flow"`
+	Ladder      ladder.Ladder          `yaml:",omitempty,flow"`
+	LadderName  string                 `yaml:"ladder_name,omitempty"`
+	AudioTracks []ladder.AudioTrack    `yaml:"audio_tracks,omitempty"`
+	Subtitles   []ladder.SubtitleTrack `yaml:",omitempty"`
+	// Thumbnails are seek preview files: WebVTT index followed by sprite sheets it references.
+	Thumbnails []string `yaml:",omitempty"`
+	// Poster is a representative frame image, Preview is a short muted clip of the video.
+	Poster  string `yaml:",omitempty"`
+	Preview string `yaml:",omitempty"`
+	// Passthrough are numbers of Ladder tiers that got source video copied into them without re-encoding.
+	Passthrough []int `yaml:",omitempty,flow"`
 }
 
 type StreamFileLoader func(rootPath ...string) ([]byte, error)
@@ -173,23 +197,34 @@ func (s *LocalStream) Walk(walker StreamWalker) error {
 	})
 }
 
-// WalkPlaylists processes Local HLS stream, calling `loader` to load and `processor`
-// for each master/child playlists and all the files they reference.
+// WalkPlaylists processes Local HLS or DASH stream, calling `loader` to load and `processor`
+// for each master/child playlists (or DASH manifest) and all the files they reference.
 // `processor` with filename as second argument.
 func (s *LocalStream) WalkPlaylists(loader StreamFileLoader, processor StreamFileProcessor) error {
+	processed := map[string]bool{}
 	doFile := func(path ...string) (io.Reader, error) {
+		name := path[len(path)-1]
 		data, err := loader(path...)
 		if err != nil {
 			return nil, err
 		}
+		// fMP4 init segments and files shared between HLS and DASH manifests should only be processed once.
+		if processed[name] {
+			return bytes.NewReader(data), nil
+		}
+		processed[name] = true
 
-		err = processor(data, path[len(path)-1])
+		err = processor(data, name)
 		if err != nil {
-			return nil, errors.Wrapf(err, `error processing stream item "%v"`, path[len(path)-1])
+			return nil, errors.Wrapf(err, `error processing stream item "%v"`, name)
 		}
 		return bytes.NewReader(data), err
 	}
 
+	if s.EntryPoint() == DASHManifestName {
+		return s.walkDASH(doFile)
+	}
+
 	data, err := doFile(s.Path, MasterPlaylistName)
 	if err != nil {
 		return err
@@ -202,26 +237,76 @@ func (s *LocalStream) WalkPlaylists(loader StreamFileLoader, processor StreamFil
 
 	masterpl := pl.(*m3u8.MasterPlaylist)
 	for _, plv := range masterpl.Variants {
-		data, err := doFile(s.Path, plv.URI)
-		if err != nil {
+		if err := s.walkMediaPlaylist(doFile, plv.URI); err != nil {
 			return err
 		}
+		for _, alt := range plv.Alternatives {
+			if alt == nil || alt.URI == "" {
+				continue
+			}
+			if err := s.walkMediaPlaylist(doFile, alt.URI); err != nil {
+				return err
+			}
+		}
+	}
 
-		p, _, err := m3u8.DecodeFrom(data, true)
-		if err != nil {
+	// CMAF streams carry DASH manifest alongside HLS playlists, referencing the same segments.
+	if _, err := os.Stat(path.Join(s.Path, DASHManifestName)); err == nil {
+		return s.walkDASH(doFile)
+	}
+	return nil
+}
+
+func (s *LocalStream) walkMediaPlaylist(doFile func(path ...string) (io.Reader, error), name string) error {
+	data, err := doFile(s.Path, name)
+	if err != nil {
+		return err
+	}
+
+	p, _, err := m3u8.DecodeFrom(data, true)
+	if err != nil {
+		return err
+	}
+	mediapl := p.(*m3u8.MediaPlaylist)
+
+	if mediapl.Map != nil && mediapl.Map.URI != "" {
+		if _, err := doFile(s.Path, mediapl.Map.URI); err != nil {
 			return err
 		}
-		mediapl := p.(*m3u8.MediaPlaylist)
-
-		for _, seg := range mediapl.Segments {
-			if seg == nil {
-				continue
-			}
-			_, err := doFile(s.Path, seg.URI)
-			if err != nil {
+	}
+	for _, seg := range mediapl.Segments {
+		if seg == nil {
+			continue
+		}
+		if seg.Map != nil && seg.Map.URI != "" {
+			if _, err := doFile(s.Path, seg.Map.URI); err != nil {
 				return err
 			}
 		}
+		if _, err := doFile(s.Path, seg.URI); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalStream) walkDASH(doFile func(path ...string) (io.Reader, error)) error {
+	data, err := doFile(s.Path, DASHManifestName)
+	if err != nil {
+		return err
+	}
+	mpd, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	files, err := mpdFiles(mpd)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if _, err := doFile(s.Path, f); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -236,6 +321,17 @@ func (s *LocalStream) BasePath() string {
 	return path.Base(s.Path)
 }
 
+// EntryPoint returns the name of the stream file players should be pointed to:
+// HLS master playlist or DASH manifest for DASH-only streams.
+func (s *LocalStream) EntryPoint() string {
+	if _, err := os.Stat(path.Join(s.Path, MasterPlaylistName)); os.IsNotExist(err) {
+		if _, err := os.Stat(path.Join(s.Path, DASHManifestName)); err == nil {
+			return DASHManifestName
+		}
+	}
+	return MasterPlaylistName
+}
+
 func (s *LocalStream) SDHash() string {
 	if s.Manifest == nil {
 		return ""
@@ -297,6 +393,30 @@ func (s *RemoteStream) Checksum() string {
 	return s.Manifest.Checksum
 }
 
+// ContentType returns HTTP content type for a stream file, determined by its extension.
+// Empty string is returned for unknown file types.
+func ContentType(name string) string {
+	switch path.Ext(name) {
+	case PlaylistExt:
+		return PlaylistContentType
+	case FragmentExt:
+		return FragmentContentType
+	case DASHManifestExt:
+		return DASHManifestContentType
+	case FMP4FragmentExt:
+		return FMP4FragmentContentType
+	case FMP4InitExt:
+		return FMP4InitContentType
+	case SubtitleExt:
+		return SubtitleContentType
+	case ThumbnailExt:
+		return ThumbnailContentType
+	case PreviewWebPExt:
+		return PreviewWebPContentType
+	}
+	return ""
+}
+
 func readFile(rootPath ...string) ([]byte, error) {
 	return ioutil.ReadFile(path.Join(rootPath...))
 }
@@ -42,3 +42,52 @@ func TestManifest_Faulty(t *testing.T) {
 	err = ols.ReadManifest()
 	assert.Error(t, err, `unmarshal errors`)
 }
+
+func TestWalkPlaylistsCMAF(t *testing.T) {
+	ls, err := OpenLocalStream("./testdata/dummy-cmaf", &Manifest{})
+	require.NoError(t, err)
+	assert.Equal(t, MasterPlaylistName, ls.EntryPoint())
+
+	seen := map[string]int{}
+	err = ls.WalkPlaylists(
+		func(rootPath ...string) ([]byte, error) {
+			switch path.Ext(rootPath[len(rootPath)-1]) {
+			case PlaylistExt, DASHManifestExt:
+				return ioutil.ReadFile(path.Join(rootPath...))
+			}
+			return make([]byte, 1000), nil
+		},
+		func(data []byte, name string) error {
+			seen[name]++
+			return nil
+		},
+	)
+	require.NoError(t, err)
+
+	assert.Len(t, seen, 17)
+	for name, count := range seen {
+		assert.Equal(t, 1, count, name)
+	}
+	for _, name := range []string{MasterPlaylistName, DASHManifestName, "media_2.m3u8", "init_0.mp4", "chunk_2_00003.m4s"} {
+		assert.Contains(t, seen, name)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	cases := map[string]string{
+		"master.m3u8":        PlaylistContentType,
+		"v0_s000001.ts":      FragmentContentType,
+		"manifest.mpd":       DASHManifestContentType,
+		"chunk_0_00001.m4s":  FMP4FragmentContentType,
+		"init_0.mp4":         FMP4InitContentType,
+		"sub_0_00001.vtt":    SubtitleContentType,
+		"thumbnails.vtt":     SubtitleContentType,
+		"thumbnails_001.jpg": ThumbnailContentType,
+		"preview.webp":       PreviewWebPContentType,
+		"preview.mp4":        FMP4InitContentType,
+		".manifest":          "",
+	}
+	for name, ctype := range cases {
+		assert.Equal(t, ctype, ContentType(name), name)
+	}
+}
@@ -1,19 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/karrick/godirwalk"
 	"github.com/lbryio/transcoder/client"
 	"github.com/lbryio/transcoder/db"
 	"github.com/lbryio/transcoder/encoder"
+	"github.com/lbryio/transcoder/ladder"
 	"github.com/lbryio/transcoder/manager"
 	"github.com/lbryio/transcoder/pkg/logging"
 	"github.com/lbryio/transcoder/pkg/logging/zapadapter"
@@ -44,8 +50,16 @@ var CLI struct {
 		MaxSize  int    `help:"Max size of videos to keep in gigabytes"`
 	} `cmd help:"Generate manifest files for videos"`
 	Transcode struct {
-		URL string `arg:"" help:"LBRY URL"`
+		URL   string `arg:"" help:"LBRY URL"`
+		Remux bool   `optional name:"remux" help:"Copy source video into the top tier when it is compatible"`
 	} `cmd help:"Download and transcode a specified video"`
+	Ladder struct {
+		Plan struct {
+			Ladder string `optional name:"ladder" help:"Ladder YAML file, default ladder is used if not set" type:"existingfile"`
+			Input  string `name:"input" help:"Video file to plan transcoding for" type:"existingfile"`
+			Output string `optional name:"output" help:"Output directory used in the printed command" default:"out"`
+		} `cmd help:"Print ladder tiers and ffmpeg command for a video without transcoding it"`
+	} `cmd help:"Encoding ladder tools"`
 }
 
 func main() {
@@ -132,20 +146,37 @@ func main() {
 			defer os.RemoveAll(tmpDir)
 		}
 
-		e, err := encoder.NewEncoder(encoder.Configure().Log(log))
+		cfg := encoder.Configure().Log(log)
+		if CLI.Transcode.Remux {
+			cfg = cfg.Remux(encoder.DefaultRemuxConfig)
+		}
+		e, err := encoder.NewEncoder(cfg)
 		if err != nil {
 			panic(err)
 		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
 		t := time.Now()
-		r, err := e.Encode(inPath, outPath)
+		r, err := e.Encode(ctx, inPath, outPath)
 		if err != nil {
 			panic(err)
 		}
 		for p := range r.Progress {
-			fmt.Printf("%.2f ", p.GetProgress())
+			fmt.Printf("%.2f%% %.2fx eta %v\n", p.Percent, p.Speed, p.ETA)
+		}
+		if err := r.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "transcoding failed: %v\n", err)
+			os.Exit(1)
 		}
 		fmt.Printf("done in %.2f seconds\n", time.Since(t).Seconds())
 		m.Ladder = r.Ladder
+		m.LadderName = r.Ladder.Name
+		m.AudioTracks = r.AudioTracks
+		m.Subtitles = r.Subtitles
+		m.Thumbnails = r.Thumbnails
+		m.Poster = r.Poster
+		m.Preview = r.Preview
+		m.Passthrough = r.Ladder.PassthroughTiers()
 		ls, err := storage.OpenLocalStream(outPath, m)
 		if err != nil {
 			panic(err)
@@ -154,7 +185,92 @@ func main() {
 		if err != nil {
 			panic(err)
 		}
+	case "ladder plan":
+		l := ladder.Default
+		if CLI.Ladder.Plan.Ladder != "" {
+			var err error
+			l, err = ladder.LoadFile(CLI.Ladder.Plan.Ladder)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid ladder: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		e, err := encoder.NewEncoder(encoder.Configure().Ladder(l))
+		if err != nil {
+			panic(err)
+		}
+		meta, report, err := e.Preflight(CLI.Ladder.Plan.Input)
+		if report != nil {
+			printPreflight(os.Stdout, report)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		tl, err := l.Tweak(meta)
+		if err != nil {
+			panic(err)
+		}
+		printPlan(os.Stdout, CLI.Ladder.Plan.Input, CLI.Ladder.Plan.Output, tl, meta)
 	default:
 		panic(ctx.Command())
 	}
 }
+
+// printPreflight writes preflight decision and issues found with the input.
+func printPreflight(w io.Writer, r *encoder.PreflightReport) {
+	fmt.Fprintf(w, "preflight: %v\n", r.Decision)
+	for _, i := range r.Issues {
+		if i.Class != "" {
+			fmt.Fprintf(w, "  [%v] %v: %v\n", i.Class, i.Check, i.Message)
+		} else {
+			fmt.Fprintf(w, "  %v: %v\n", i.Check, i.Message)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// printPlan writes ladder tiers and ffmpeg command line the encoder would run for the input.
+func printPlan(w io.Writer, input, output string, l ladder.Ladder, meta *ladder.Metadata) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tDEFINITION\tSIZE\tBITRATE\tRATE CONTROL\tAUDIO\tFPS\tCODEC\tHDR")
+	for n, t := range l.Tiers {
+		size := "-"
+		if t.Definition != ladder.DAudio {
+			size = fmt.Sprintf("%vx%v", t.Width, t.Height)
+		}
+		fps := "source"
+		if t.Framerate > 0 {
+			fps = strconv.Itoa(t.Framerate)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			n, t.Definition, size, t.VideoBitrate, ladder.TierRateControl(t), t.AudioBitrate, fps, l.TierCodec(t), t.HDR)
+	}
+	tw.Flush()
+
+	args := l.ArgumentSet(output, meta)
+	if l.TwoPass() {
+		printCommand(w, append(append([]string{"ffmpeg", "-i", input}, args.FirstPassArguments()...), os.DevNull))
+	}
+	cmd := []string{"ffmpeg", "-i", input}
+	cmd = append(cmd, args.GetStrArguments()...)
+	printCommand(w, append(cmd, path.Join(output, args.OutputName())))
+}
+
+func printCommand(w io.Writer, cmd []string) {
+	quoted := make([]string, len(cmd))
+	for i, a := range cmd {
+		quoted[i] = shellQuote(a)
+	}
+	fmt.Fprintf(w, "\n%v\n", strings.Join(quoted, " "))
+}
+
+// shellQuote quotes argument for it to be safely pasted into a POSIX shell.
+func shellQuote(a string) string {
+	if a != "" && strings.IndexFunc(a, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.,:/=+%@", r))
+	}) == -1 {
+		return a
+	}
+	return "'" + strings.ReplaceAll(a, "'", `'"'"'`) + "'"
+}
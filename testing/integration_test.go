@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/lbryio/transcoder/db"
+	"github.com/lbryio/transcoder/ladder"
 	"github.com/lbryio/transcoder/manager"
 	"github.com/lbryio/transcoder/pkg/mfr"
 	"github.com/lbryio/transcoder/storage"
@@ -46,7 +47,7 @@ func (s *integSuite) SetupSuite() {
 	s.lib = video.NewLibrary(libCfg)
 	s.mgr = manager.NewManager(s.lib, 10)
 
-	workers.SpawnEncoderWorkers(3, s.mgr)
+	workers.SpawnEncoderWorkers(3, s.mgr, ladder.NewRegistry())
 	s.httpAPI = manager.NewHttpAPI(
 		manager.ConfigureHttpAPI().
 			Debug(true).
@@ -0,0 +1,311 @@
+package tower
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lbryio/transcoder/tower/queue"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	adminPrefix = "/api/admin"
+
+	defaultTasksLimit = 100
+	maxTasksLimit     = 1000
+)
+
+var taskStatuses = map[queue.Status]bool{
+	queue.StatusNew:        true,
+	queue.StatusProcessing: true,
+	queue.StatusRetrying:   true,
+	queue.StatusErrored:    true,
+	queue.StatusFailed:     true,
+	queue.StatusDone:       true,
+	queue.StatusCancelled:  true,
+}
+
+type adminHandler struct {
+	s *Server
+	q *queue.Queries
+}
+
+type adminTask struct {
+	ID            string     `json:"id"`
+	Status        string     `json:"status"`
+	Worker        string     `json:"worker"`
+	URL           string     `json:"url"`
+	SDHash        string     `json:"sd_hash"`
+	Queue         string     `json:"queue,omitempty"`
+	Priority      int32      `json:"priority"`
+	Ladder        string     `json:"ladder,omitempty"`
+	Retries       int32      `json:"retries"`
+	Stage         string     `json:"stage,omitempty"`
+	StageProgress int32      `json:"stage_progress,omitempty"`
+	StageSpeed    float64    `json:"stage_speed,omitempty"`
+	StageETA      int32      `json:"stage_eta,omitempty"`
+	Result        string     `json:"result,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	ErrorClass    string     `json:"error_class,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
+type adminTaskDetails struct {
+	adminTask
+	ErrorLog  string           `json:"error_log,omitempty"`
+	Preflight json.RawMessage  `json:"preflight,omitempty"`
+	Stages    []adminTaskStage `json:"stages"`
+}
+
+type adminTaskStage struct {
+	Stage     string    `json:"stage"`
+	Attempt   int32     `json:"attempt"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type adminWorker struct {
+	ID        string    `json:"id"`
+	Capacity  int       `json:"capacity"`
+	Available int       `json:"available"`
+	LastSeen  time.Time `json:"last_seen"`
+	Alive     bool      `json:"alive"`
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// attachAdminHandler mounts admin API for inspecting and managing tasks and workers.
+func (s *Server) attachAdminHandler(r *router.Router) {
+	h := adminHandler{s: s, q: s.rpc.tasks.q}
+	g := r.Group(adminPrefix)
+	g.GET("/tasks", adminAuth(s.adminToken, h.listTasks))
+	g.GET("/tasks/{id}", adminAuth(s.adminToken, h.getTask))
+	g.POST("/tasks/{id}/retry", adminAuth(s.adminToken, h.retryTask))
+	g.POST("/tasks/{id}/cancel", adminAuth(s.adminToken, h.cancelTask))
+	g.GET("/workers", adminAuth(s.adminToken, h.listWorkers))
+}
+
+// adminAuth only lets through requests carrying `token` in `Authorization: Bearer` header.
+func adminAuth(token string, h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		auth := string(ctx.Request.Header.Peek("Authorization"))
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			writeJSON(ctx, http.StatusUnauthorized, adminError{"unauthorized"})
+			return
+		}
+		h(ctx)
+	}
+}
+
+// listTasks returns tasks, newest first. Accepted query params:
+// status, worker, from and to (RFC 3339 or YYYY-MM-DD, matched against task creation time, `to` is exclusive),
+// limit and offset.
+func (h adminHandler) listTasks(ctx *fasthttp.RequestCtx) {
+	params, err := parseTasksFilter(ctx.QueryArgs())
+	if err != nil {
+		writeJSON(ctx, http.StatusBadRequest, adminError{err.Error()})
+		return
+	}
+	tasks, err := h.q.ListTasks(context.Background(), params)
+	if err != nil {
+		h.internalError(ctx, err)
+		return
+	}
+	res := make([]adminTask, len(tasks))
+	for i, t := range tasks {
+		res[i] = newAdminTask(t)
+	}
+	writeJSON(ctx, http.StatusOK, res)
+}
+
+// getTask returns task details along with its error and stage history.
+func (h adminHandler) getTask(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	t, err := h.q.GetTask(context.Background(), id)
+	if err == sql.ErrNoRows {
+		writeJSON(ctx, http.StatusNotFound, adminError{"task not found"})
+		return
+	} else if err != nil {
+		h.internalError(ctx, err)
+		return
+	}
+	stages, err := h.q.GetTaskStages(context.Background(), id)
+	if err != nil {
+		h.internalError(ctx, err)
+		return
+	}
+	writeJSON(ctx, http.StatusOK, newAdminTaskDetails(t, stages))
+}
+
+// retryTask sends an errored, failed or cancelled task back to work on any worker.
+func (h adminHandler) retryTask(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	_, err := h.s.retryTask(id)
+	if err == sql.ErrNoRows {
+		h.notActionable(ctx, id, "retried")
+		return
+	} else if err != nil {
+		h.internalError(ctx, err)
+		return
+	}
+	h.s.log.Info("task retry requested", "tid", id)
+	h.getTask(ctx)
+}
+
+// cancelTask stops managing a task which is not finished yet.
+func (h adminHandler) cancelTask(ctx *fasthttp.RequestCtx) {
+	id, _ := ctx.UserValue("id").(string)
+	t, err := h.s.rpc.cancelTask(id)
+	if err == sql.ErrNoRows {
+		h.notActionable(ctx, id, "cancelled")
+		return
+	} else if err != nil {
+		h.internalError(ctx, err)
+		return
+	}
+	h.s.log.Info("task cancelled", "tid", id, "wid", t.Worker)
+	writeJSON(ctx, http.StatusOK, newAdminTask(t))
+}
+
+// listWorkers returns workers known to the tower along with their capacity, including those marked dead.
+func (h adminHandler) listWorkers(ctx *fasthttp.RequestCtx) {
+	workers := h.s.registry.list()
+	res := make([]adminWorker, len(workers))
+	for i, w := range workers {
+		res[i] = adminWorker{ID: w.id, Capacity: w.capacity, Available: w.available, LastSeen: w.lastSeen, Alive: !w.dead}
+	}
+	writeJSON(ctx, http.StatusOK, res)
+}
+
+// notActionable responds to a retry or cancel request for a task which is missing or is in a wrong status for it.
+func (h adminHandler) notActionable(ctx *fasthttp.RequestCtx, id, action string) {
+	t, err := h.q.GetTask(context.Background(), id)
+	if err == sql.ErrNoRows {
+		writeJSON(ctx, http.StatusNotFound, adminError{"task not found"})
+		return
+	} else if err != nil {
+		h.internalError(ctx, err)
+		return
+	}
+	writeJSON(ctx, http.StatusConflict, adminError{fmt.Sprintf("%v task cannot be %v", t.Status, action)})
+}
+
+func (h adminHandler) internalError(ctx *fasthttp.RequestCtx, err error) {
+	h.s.log.Error("admin api error", "path", string(ctx.Path()), "err", err)
+	writeJSON(ctx, http.StatusInternalServerError, adminError{err.Error()})
+}
+
+func parseTasksFilter(args *fasthttp.Args) (queue.ListTasksParams, error) {
+	p := queue.ListTasksParams{
+		Status:        string(args.Peek("status")),
+		Worker:        string(args.Peek("worker")),
+		CreatedBefore: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC),
+		Lim:           defaultTasksLimit,
+	}
+	if p.Status != "" && !taskStatuses[queue.Status(p.Status)] {
+		return p, fmt.Errorf("unknown status: %v", p.Status)
+	}
+	var err error
+	if v := args.Peek("from"); len(v) > 0 {
+		if p.CreatedAfter, err = parseAdminTime(string(v)); err != nil {
+			return p, err
+		}
+	}
+	if v := args.Peek("to"); len(v) > 0 {
+		if p.CreatedBefore, err = parseAdminTime(string(v)); err != nil {
+			return p, err
+		}
+	}
+	if v := args.Peek("limit"); len(v) > 0 {
+		limit, err := strconv.Atoi(string(v))
+		if err != nil || limit <= 0 || limit > maxTasksLimit {
+			return p, fmt.Errorf("limit must be between 1 and %v", maxTasksLimit)
+		}
+		p.Lim = int32(limit)
+	}
+	if v := args.Peek("offset"); len(v) > 0 {
+		offset, err := strconv.Atoi(string(v))
+		if err != nil || offset < 0 {
+			return p, fmt.Errorf("malformed offset: %s", v)
+		}
+		p.Off = int32(offset)
+	}
+	return p, nil
+}
+
+// parseAdminTime accepts RFC 3339 timestamps and plain dates. Tasks table stores UTC timestamps without time zone.
+func parseAdminTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return t, fmt.Errorf("malformed time: %v", v)
+	}
+	return t, nil
+}
+
+func newAdminTask(t queue.Task) adminTask {
+	v := adminTask{
+		ID:            t.ULID,
+		Status:        string(t.Status),
+		Worker:        t.Worker,
+		URL:           t.URL,
+		SDHash:        t.SDHash,
+		Queue:         t.Queue,
+		Priority:      t.Priority,
+		Ladder:        t.Ladder,
+		Retries:       t.Retries.Int32,
+		Stage:         t.Stage.String,
+		StageProgress: t.StageProgress.Int32,
+		StageSpeed:    t.StageSpeed.Float64,
+		StageETA:      t.StageEta.Int32,
+		Result:        t.Result.String,
+		Error:         t.Error.String,
+		ErrorClass:    t.ErrorClass.String,
+		CreatedAt:     t.CreatedAt,
+	}
+	if t.UpdatedAt.Valid {
+		v.UpdatedAt = &t.UpdatedAt.Time
+	}
+	return v
+}
+
+func newAdminTaskDetails(t queue.Task, stages []queue.TaskStage) adminTaskDetails {
+	d := adminTaskDetails{
+		adminTask: newAdminTask(t),
+		ErrorLog:  t.ErrorLog.String,
+		Stages:    make([]adminTaskStage, len(stages)),
+	}
+	if t.Preflight.Valid {
+		d.Preflight = json.RawMessage(t.Preflight.String)
+	}
+	for i, st := range stages {
+		d.Stages[i] = adminTaskStage{Stage: st.Stage, Attempt: st.Attempt, StartedAt: st.CreatedAt}
+	}
+	return d
+}
+
+func writeJSON(ctx *fasthttp.RequestCtx, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetBodyString(err.Error())
+		return
+	}
+	ctx.SetStatusCode(status)
+	ctx.SetContentType("application/json")
+	ctx.SetBody(body)
+}
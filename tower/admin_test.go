@@ -0,0 +1,99 @@
+package tower
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lbryio/transcoder/tower/queue"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestAdminAuth(t *testing.T) {
+	h := adminAuth("s3cret", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(http.StatusOK)
+	})
+	testCases := []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"s3cret", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusOK},
+	}
+	for _, tc := range testCases {
+		ctx := &fasthttp.RequestCtx{}
+		if tc.header != "" {
+			ctx.Request.Header.Set("Authorization", tc.header)
+		}
+		h(ctx)
+		assert.Equal(t, tc.status, ctx.Response.StatusCode(), tc.header)
+	}
+}
+
+func TestParseTasksFilter(t *testing.T) {
+	args := &fasthttp.Args{}
+	args.Parse("status=failed&worker=worker-1&from=2022-03-01&to=2022-03-02T12:00:00%2B02:00&limit=20&offset=40")
+	p, err := parseTasksFilter(args)
+	require.NoError(t, err)
+	assert.Equal(t, queue.ListTasksParams{
+		Status:        "failed",
+		Worker:        "worker-1",
+		CreatedAfter:  time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+		CreatedBefore: time.Date(2022, 3, 2, 10, 0, 0, 0, time.UTC),
+		Lim:           20,
+		Off:           40,
+	}, p)
+
+	p, err = parseTasksFilter(&fasthttp.Args{})
+	require.NoError(t, err)
+	assert.EqualValues(t, defaultTasksLimit, p.Lim)
+	assert.True(t, p.CreatedBefore.After(time.Now()))
+
+	for _, q := range []string{"status=running", "from=yesterday", "limit=0", "limit=5000", "offset=-1"} {
+		args := &fasthttp.Args{}
+		args.Parse(q)
+		_, err := parseTasksFilter(args)
+		assert.Error(t, err, q)
+	}
+}
+
+func TestAdminTaskDetails(t *testing.T) {
+	created := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	task := queue.Task{
+		ULID:       "01FXYZ",
+		Status:     queue.StatusFailed,
+		Worker:     "worker-1",
+		Retries:    sql.NullInt32{Int32: 1, Valid: true},
+		Stage:      sql.NullString{String: string(StageEncoding), Valid: true},
+		Error:      sql.NullString{String: "encoding failed", Valid: true},
+		ErrorClass: sql.NullString{String: "corrupt_input", Valid: true},
+		ErrorLog:   sql.NullString{String: "Invalid data found when processing input", Valid: true},
+		Preflight:  sql.NullString{String: `{"decision":"reject"}`, Valid: true},
+		CreatedAt:  created,
+	}
+	stages := []queue.TaskStage{
+		{ULID: "01FXYZ", Stage: string(StageDownloading), CreatedAt: created},
+		{ULID: "01FXYZ", Stage: string(StageEncoding), CreatedAt: created.Add(time.Minute)},
+		{ULID: "01FXYZ", Stage: string(StageEncoding), Attempt: 1, CreatedAt: created.Add(time.Hour)},
+	}
+	data, err := json.Marshal(newAdminTaskDetails(task, stages))
+	require.NoError(t, err)
+
+	var d map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &d))
+	assert.Equal(t, "failed", d["status"])
+	assert.Equal(t, "corrupt_input", d["error_class"])
+	assert.Equal(t, "Invalid data found when processing input", d["error_log"])
+	assert.Equal(t, map[string]interface{}{"decision": "reject"}, d["preflight"])
+	assert.NotContains(t, d, "updated_at")
+	assert.Len(t, d["stages"], 3)
+	assert.Equal(t, map[string]interface{}{"stage": "encoding", "attempt": 1.0, "started_at": "2022-03-01T11:00:00Z"}, d["stages"].([]interface{})[2])
+}
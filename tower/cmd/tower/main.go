@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/lbryio/transcoder/db"
 	"github.com/lbryio/transcoder/encoder"
@@ -36,6 +37,9 @@ var CLI struct {
 		HttpURL   string `help:"URL at which callback server will be accessible from the outside"`
 		StateFile string `optional:"" help:"State file to synchronize to and load on start up"`
 		DevMode   bool   `help:"Development mode (purges queues before start)"`
+
+		MaxRetries   int           `optional:"" help:"Number of retries after which errored task is marked as failed" default:"10"`
+		RetryBackoff time.Duration `optional:"" help:"Delay before the first retry of errored task, doubled for every next retry" default:"30s"`
 	} `cmd:"" help:"Start tower server"`
 	Debug bool `optional:"" help:"Enable debug logging" default:false`
 }
@@ -131,6 +135,15 @@ func serve() {
 		cfg.GetStringSlice("disabledchannels"),
 	)
 
+	ladderCfg := map[string]ladder.Config{}
+	if err := cfg.UnmarshalKey("ladders", &ladderCfg); err != nil {
+		log.Fatal("unable to read ladders config", err)
+	}
+	ladders, err := ladder.LoadRegistry(ladderCfg)
+	if err != nil {
+		log.Fatal("unable to load ladders", err)
+	}
+
 	cleanStopChan := video.SpawnRemoteLibraryCleaning(lib)
 
 	adQueue := cfg.GetStringMapString("adaptivequeue")
@@ -147,10 +160,17 @@ func serve() {
 		Logger(zapadapter.NewKV(logger)).
 		HttpServer(CLI.Serve.HttpBind, CLI.Serve.HttpURL).
 		VideoManager(mgr).
+		Ladders(ladders).
 		WorkDir(towerCfg["workdir"]).
 		RMQAddr(CLI.Serve.RMQAddr).
+		AdminToken(towerCfg["admintoken"]).
 		DB(qDB)
 
+	retryPolicy := tower.DefaultRetryPolicy
+	retryPolicy.MaxRetries = CLI.Serve.MaxRetries
+	retryPolicy.Backoff = CLI.Serve.RetryBackoff
+	serverConfig.RetryPolicy(retryPolicy)
+
 	if CLI.Serve.DevMode {
 		serverConfig = serverConfig.DevMode()
 	}
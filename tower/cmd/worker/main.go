@@ -5,7 +5,9 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
+	"github.com/lbryio/transcoder/encoder"
 	"github.com/lbryio/transcoder/manager"
 	"github.com/lbryio/transcoder/pkg/logging/zapadapter"
 	"github.com/lbryio/transcoder/storage"
@@ -27,6 +29,18 @@ var CLI struct {
 		Threads    int    `optional:"" help:"Encoding threads per encoding worker" default:"2"`
 		WorkDir    string `optional:"" help:"Directory for storing downloaded and transcoded files" default:"./"`
 		BlobServer string `optional:"" name:"blob-server" help:"LBRY blobserver address."`
+
+		AnalyzeComplexity bool `optional:"" help:"Adapt encoding ladder bitrates to content complexity" default:"false"`
+		Remux             bool `optional:"" help:"Copy compatible source video into the top ladder tier instead of encoding it" default:"false"`
+
+		ChunkedMinDuration time.Duration `optional:"" help:"Encode videos at least this long in parallel chunks, 0 to disable" default:"0"`
+		ChunkDuration      time.Duration `optional:"" help:"Length of chunks for chunked encoding" default:"5m"`
+		ChunkedParallel    int           `optional:"" help:"Chunks of a single video to encode in parallel" default:"4"`
+
+		MaxDuration  time.Duration `optional:"" help:"Reject inputs longer than this, 0 for no limit" default:"12h"`
+		MaxWidth     int           `optional:"" help:"Reject videos with longer side exceeding this, 0 for no limit" default:"7680"`
+		MaxHeight    int           `optional:"" help:"Reject videos with shorter side exceeding this, 0 for no limit" default:"4320"`
+		MaxFramerate float64       `optional:"" help:"Reject videos with framerate exceeding this, 0 for no limit" default:"120"`
 	} `cmd:"" help:"Start transcoding worker"`
 	Debug bool `optional:"" help:"Enable debug logging" default:"false"`
 }
@@ -68,13 +82,29 @@ func main() {
 		}
 		log.Infow("s3 storage configured", "endpoint", s3cfg["endpoint"])
 
-		c, err := tower.NewWorker(tower.DefaultWorkerConfig().
+		workerCfg := tower.DefaultWorkerConfig()
+		if CLI.Start.Remux {
+			workerCfg.Remux(encoder.DefaultRemuxConfig)
+		}
+		c, err := tower.NewWorker(workerCfg.
 			WorkerID(CLI.Start.WorkerID).
 			Logger(zapadapter.NewKV(logger.Named("tower.worker"))).
 			PoolSize(CLI.Start.Workers).
 			WorkDir(CLI.Start.WorkDir).
 			RMQAddr(CLI.Start.RMQAddr).
 			HttpServerBind(CLI.Start.HttpBind).
+			AnalyzeComplexity(CLI.Start.AnalyzeComplexity).
+			Chunked(encoder.ChunkedConfig{
+				MinDuration:   CLI.Start.ChunkedMinDuration,
+				ChunkDuration: CLI.Start.ChunkDuration,
+				Parallel:      CLI.Start.ChunkedParallel,
+			}).
+			Limits(encoder.PreflightLimits{
+				MaxDuration:  CLI.Start.MaxDuration,
+				MaxWidth:     CLI.Start.MaxWidth,
+				MaxHeight:    CLI.Start.MaxHeight,
+				MaxFramerate: CLI.Start.MaxFramerate,
+			}).
 			S3Driver(s3driver),
 		)
 		if err != nil {
@@ -10,6 +10,7 @@ const (
 	responsesQueueName    = "responses"
 	requestsQueueName     = "requests"
 	workerHandshakeQueue  = "worker-handshake"
+	workerStatusQueue     = "worker-status"
 	workRequestsQueue     = "work-requests"
 	taskStatusQueue       = "task-status"
 
@@ -18,10 +19,13 @@ const (
 	headerTaskID      = "task-id"
 	headerWorkerID    = "worker-id"
 	headerMessageType = "message-type"
+	headerAttempt     = "attempt"
 
-	mTypeProgress = "progress"
-	mTypeSuccess  = "success"
-	mTypeError    = "error"
+	mTypeProgress  = "progress"
+	mTypeSuccess   = "success"
+	mTypeError     = "error"
+	mTypeHeartbeat = "heartbeat"
+	mTypeCancel    = "cancel"
 
 	defaultHeartbeatInterval = 30 * time.Second
 	maxFailedAttempts        = 5
@@ -1,6 +1,8 @@
 package tower
 
 import (
+	"github.com/lbryio/transcoder/encoder"
+	"github.com/lbryio/transcoder/ladder"
 	"github.com/lbryio/transcoder/storage"
 )
 
@@ -12,11 +14,39 @@ type MsgTranscodingTask struct {
 	TaskID string `json:"tid"`
 	URL    string `json:"url"`
 	SDHash string `json:"sd_hash"`
+	// Ladder is the encoding ladder selected for the task, worker uses its default ladder if not set.
+	Ladder *ladder.Ladder `json:"ladder,omitempty"`
+	// Queue is the name of the manager pool queue the request came from.
+	Queue string `json:"queue,omitempty"`
+	// Priority is derived from Queue, tasks with higher priority are retried first.
+	Priority int32 `json:"priority"`
+	// Attempt is sent back with every task status message so the tower can reject messages
+	// from attempts which have timed out and were reassigned.
+	Attempt int32 `json:"attempt"`
+}
+
+// MsgTaskCancel tells the worker to stop running the task.
+type MsgTaskCancel struct {
+	TaskID string `json:"tid"`
 }
 
 type taskProgress struct {
 	Stage   RequestStage `json:"stage"`
 	Percent float32      `json:"progress"`
+	encodingProgress
+	// Preflight is reported once, when encoding starts.
+	Preflight *encoder.PreflightReport `json:"preflight,omitempty"`
+}
+
+// encodingProgress holds encoding stage details, they are not reported for other stages.
+type encodingProgress struct {
+	// Speed is encoding speed as a multiple of realtime.
+	Speed float64 `json:"speed,omitempty"`
+	// Bitrate is current output bitrate in kbit/s.
+	Bitrate float64 `json:"bitrate,omitempty"`
+	Frames  int     `json:"frames,omitempty"`
+	// ETA is estimated number of seconds remaining until the stage is done.
+	ETA int `json:"eta,omitempty"`
 }
 
 type taskResult struct {
@@ -26,6 +56,10 @@ type taskResult struct {
 type taskError struct {
 	err   error
 	fatal bool
+	// class and log describe encoder failures, see encoder.FailureOf.
+	class     encoder.FailureClass
+	log       string
+	preflight *encoder.PreflightReport
 }
 
 type mPipelineError struct {
@@ -38,6 +72,8 @@ type workerMessage struct {
 
 type workerMsgMeta struct {
 	tid, wid, mType string
+	// attempt is -1 for workers which do not report it.
+	attempt int32
 }
 
 type MsgWorkerHandshake struct {
@@ -47,6 +83,14 @@ type MsgWorkerHandshake struct {
 	SessionID string `json:"session_id"`
 }
 
+// MsgWorkerStatus is sent by workers periodically, workers which stop sending it are considered dead.
+type MsgWorkerStatus struct {
+	WorkerID  string `json:"worker_id"`
+	Capacity  int    `json:"capacity"`
+	Available int    `json:"available"`
+	SessionID string `json:"session_id"`
+}
+
 type MsgWorkerRequest struct {
 	WorkerID  string `json:"worker_id"`
 	SessionID string `json:"session"`
@@ -55,13 +99,25 @@ type MsgWorkerRequest struct {
 type MsgWorkerProgress struct {
 	Stage   RequestStage `json:"stage"`
 	Percent float32      `json:"progress"`
+	encodingProgress
+	// Preflight is the report of input preflight checks, sent once when encoding starts.
+	Preflight *encoder.PreflightReport `json:"preflight,omitempty"`
 }
 
 type MsgWorkerError struct {
 	Error string `json:"error"`
 	Fatal bool   `json:"fatal"`
+	// Class is encoder failure class, empty for errors in other stages.
+	Class string `json:"class,omitempty"`
+	// Log is the tail of ffmpeg log for encoder failures.
+	Log string `json:"log,omitempty"`
+	// Preflight is set for inputs rejected by preflight checks.
+	Preflight *encoder.PreflightReport `json:"preflight,omitempty"`
 }
 
+// MsgWorkerHeartbeat is sent periodically by workers for every task they are running.
+type MsgWorkerHeartbeat struct{}
+
 type MsgWorkerSuccess struct {
 	RemoteStream *storage.RemoteStream `json:"remote_stream"`
 }
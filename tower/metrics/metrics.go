@@ -25,6 +25,23 @@ var (
 		Name: "workers_spent_seconds",
 	}, []string{LabelWorkerName, LabelStage})
 
+	// Worker registry totals, only workers which are alive are counted.
+	RegistryWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "registry_workers",
+	})
+	RegistryCapacity = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "registry_capacity",
+	})
+	RegistryAvailable = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "registry_available",
+	})
+	RegistryDeadWorkers = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "registry_dead_workers",
+	})
+	TranscodingRequestsRequeued = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "transcoding_requests_requeued",
+	})
+
 	TranscodingRequestsPublished = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "transcoding_requests_published",
 	})
@@ -41,6 +58,9 @@ var (
 	TranscodingRequestsErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "transcoding_requests_errors",
 	}, []string{LabelWorkerName})
+	TranscodingRequestsTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "transcoding_requests_timeouts",
+	}, []string{LabelWorkerName})
 )
 
 func RegisterTowerMetrics() {
@@ -48,6 +68,8 @@ func RegisterTowerMetrics() {
 		prometheus.MustRegister(
 			WorkersSpentSeconds,
 			TranscodingRequestsRunning, TranscodingRequestsRetries, TranscodingRequestsErrors, TranscodingRequestsDone,
+			TranscodingRequestsRequeued, TranscodingRequestsTimeouts,
+			RegistryWorkers, RegistryCapacity, RegistryAvailable, RegistryDeadWorkers,
 		)
 	})
 }
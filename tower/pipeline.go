@@ -115,7 +115,20 @@ func (c *pipeline) Process(stop chan struct{}, task workerTask) {
 	var ls *storage.LocalStream
 	log := logging.AddLogRef(c.log, task.payload.SDHash)
 
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-task.cancelled:
+			log.Info("task cancelled, stopping")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	go func() {
+		defer cancel()
 		var origFile, encodedPath string
 		errMtr := metrics.TranscodingErrorsCount
 
@@ -156,27 +169,64 @@ func (c *pipeline) Process(stop chan struct{}, task workerTask) {
 			task.progress <- taskProgress{Stage: StageEncoding}
 
 			runMtr.Inc()
-			res, err := c.encoder.Encode(origFile, encodedPath)
+			var res *encoder.Result
+			var err error
+			if task.payload.Ladder != nil {
+				res, err = c.encoder.EncodeWithLadder(ctx, origFile, encodedPath, *task.payload.Ladder)
+			} else {
+				res, err = c.encoder.Encode(ctx, origFile, encodedPath)
+			}
 			if err != nil {
 				log.Error("encoder failed", "err", err)
 				spentMtr.Add(time.Since(timer).Seconds())
 				errMtr.WithLabelValues(string(StageEncoding)).Inc()
 				runMtr.Dec()
-				task.errors <- taskError{err: errors.Wrap(err, "encoder failed"), fatal: true}
+				task.errors <- encoderError(errors.Wrap(err, "encoder failed"))
 				return
 			}
 
-			seen := map[int]bool{}
+			log.Info("input passed preflight checks", "decision", res.Preflight.Decision, "issues", len(res.Preflight.Issues))
+			task.progress <- taskProgress{Stage: StageEncoding, Preflight: res.Preflight}
+			seen := map[int]bool{0: true}
 			for p := range res.Progress {
-				pg := int(math.Ceil(p.GetProgress()))
+				pg := int(math.Ceil(p.Percent))
 				if pg%5 == 0 && !seen[pg] {
 					seen[pg] = true
-					task.progress <- taskProgress{Percent: float32(pg), Stage: StageEncoding}
+					task.progress <- taskProgress{
+						Percent: float32(pg),
+						Stage:   StageEncoding,
+						encodingProgress: encodingProgress{
+							Speed:   p.Speed,
+							Bitrate: p.Bitrate,
+							Frames:  p.Frames,
+							ETA:     int(p.ETA.Seconds()),
+						},
+					}
+				}
+			}
+			if err := res.Err(); err != nil {
+				log.Error("encoding failed", "err", err)
+				spentMtr.Add(time.Since(timer).Seconds())
+				errMtr.WithLabelValues(string(StageEncoding)).Inc()
+				runMtr.Dec()
+				if err == encoder.ErrCancelled {
+					// Cancelled tasks are picked up again, by this or another worker.
+					task.errors <- taskError{err: err}
+				} else {
+					task.errors <- encoderError(errors.Wrap(err, "encoding failed"))
 				}
+				return
 			}
 
 			m := storage.NewManifest(task.payload.URL, resolved.ChannelURI, task.payload.SDHash)
 			m.Ladder = res.Ladder
+			m.LadderName = res.Ladder.Name
+			m.Passthrough = res.Ladder.PassthroughTiers()
+			m.AudioTracks = res.AudioTracks
+			m.Subtitles = res.Subtitles
+			m.Thumbnails = res.Thumbnails
+			m.Poster = res.Poster
+			m.Preview = res.Preview
 
 			ls, err = storage.OpenLocalStream(encodedPath, m)
 			if err != nil {
@@ -231,3 +281,15 @@ func (c *pipeline) Process(stop chan struct{}, task workerTask) {
 		}
 	}()
 }
+
+// encoderError classifies encoder failure, only failures which may not happen again are retried.
+// Inputs rejected by preflight checks carry the preflight report.
+func encoderError(err error) taskError {
+	class, log := encoder.FailureOf(err)
+	te := taskError{err: err, fatal: !class.Retriable(), class: class, log: log}
+	var pe *encoder.PreflightError
+	if errors.As(err, &pe) {
+		te.preflight = pe.Report
+	}
+	return te
+}
@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE tasks
+  ADD COLUMN stage_speed real,
+  ADD COLUMN stage_eta integer;
+
+-- +migrate Down
+ALTER TABLE tasks
+  DROP COLUMN stage_speed,
+  DROP COLUMN stage_eta;
@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE tasks
+  ADD COLUMN error_class text,
+  ADD COLUMN error_log text;
+
+-- +migrate Down
+ALTER TABLE tasks
+  DROP COLUMN error_class,
+  DROP COLUMN error_log;
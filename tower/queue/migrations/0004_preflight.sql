@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE tasks
+  ADD COLUMN preflight text;
+
+-- +migrate Down
+ALTER TABLE tasks
+  DROP COLUMN preflight;
@@ -0,0 +1,17 @@
+-- +migrate Up notransaction
+ALTER TYPE status ADD VALUE IF NOT EXISTS 'cancelled';
+
+CREATE TABLE task_stages (
+    id SERIAL NOT NULL PRIMARY KEY,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+
+    ulid text NOT NULL REFERENCES tasks (ulid) ON DELETE CASCADE,
+    stage text NOT NULL,
+    attempt integer NOT NULL DEFAULT 0,
+
+    UNIQUE ("ulid", "stage", "attempt")
+);
+
+-- +migrate Down
+-- Postgres cannot drop enum values, 'cancelled' status is left in place.
+DROP TABLE task_stages;
@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE tasks
+  ADD COLUMN retry_at timestamp;
+
+-- +migrate Down
+ALTER TABLE tasks
+  DROP COLUMN retry_at;
@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE tasks
+  ADD COLUMN queue text NOT NULL DEFAULT '',
+  ADD COLUMN priority integer NOT NULL DEFAULT 0;
+
+-- +migrate Down
+ALTER TABLE tasks
+  DROP COLUMN priority,
+  DROP COLUMN queue;
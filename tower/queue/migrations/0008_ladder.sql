@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE tasks
+  ADD COLUMN ladder text NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE tasks
+  DROP COLUMN ladder;
@@ -17,6 +17,7 @@ const (
 	StatusErrored    Status = "errored"
 	StatusFailed     Status = "failed"
 	StatusDone       Status = "done"
+	StatusCancelled  Status = "cancelled"
 )
 
 func (e *Status) Scan(src interface{}) error {
@@ -45,4 +46,21 @@ type Task struct {
 	URL           string
 	SDHash        string
 	Result        sql.NullString
+	StageSpeed    sql.NullFloat64
+	StageEta      sql.NullInt32
+	ErrorClass    sql.NullString
+	ErrorLog      sql.NullString
+	Preflight     sql.NullString
+	RetryAt       sql.NullTime
+	Queue         string
+	Priority      int32
+	Ladder        string
+}
+
+type TaskStage struct {
+	ID        int32
+	CreatedAt time.Time
+	ULID      string
+	Stage     string
+	Attempt   int32
 }
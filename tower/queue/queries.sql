@@ -1,8 +1,8 @@
 -- name: CreateTask :one
 INSERT INTO tasks (
-  status, ulid, worker, url, sd_hash
+  status, ulid, worker, url, sd_hash, queue, priority, ladder
 ) VALUES (
-  'new', $1, $2, $3, $4
+  'new', $1, $2, $3, $4, $5, $6, $7
 )
 RETURNING *;
 
@@ -24,19 +24,31 @@ AND url = $1 AND sd_hash = $2 LIMIT 1;
 
 -- name: GetActiveTasks :many
 SELECT * FROM tasks
-WHERE status IN ('new', 'processing', 'retrying', 'errored');
+WHERE status IN ('new', 'processing', 'retrying')
+ORDER BY priority DESC, created_at;
 
 -- name: GetActiveTasksForWorker :many
 SELECT * FROM tasks
-WHERE status IN ('new', 'processing', 'retrying', 'errored') AND worker = $1;
+WHERE status IN ('new', 'processing', 'retrying') AND worker = $1
+ORDER BY priority DESC, created_at;
+
+-- name: ListTasks :many
+SELECT * FROM tasks
+WHERE (@status::text = '' OR status::text = @status::text)
+AND (@worker::text = '' OR worker = @worker::text)
+AND created_at >= @created_after::timestamp AND created_at < @created_before::timestamp
+ORDER BY created_at DESC
+LIMIT @lim::integer OFFSET @off::integer;
 
 -- name: GetRetriableTasks :many
 SELECT * FROM tasks
-WHERE status = 'errored' AND retries < 10;
+WHERE status = 'errored' AND retries < @max_retries::integer
+AND (retry_at IS NULL OR retry_at <= NOW())
+ORDER BY priority DESC, retry_at;
 
 -- name: SetStageProgress :one
 UPDATE tasks
-SET stage = $2, stage_progress = $3, status = 'processing', updated_at = NOW() WHERE ulid = $1
+SET stage = $2, stage_progress = $3, stage_speed = $4, stage_eta = $5, status = 'processing', updated_at = NOW() WHERE ulid = $1
 RETURNING *;
 
 -- name: SetStatus :one
@@ -46,20 +58,71 @@ RETURNING *;
 
 -- name: SetError :one
 UPDATE tasks
-SET status = 'errored', error = $2, updated_at = NOW() WHERE ulid = $1
+SET status = 'errored', error = $2, error_class = $3, error_log = $4, retry_at = $5, updated_at = NOW() WHERE ulid = $1
 RETURNING *;
 
 -- name: MarkRetrying :one
 UPDATE tasks
-SET status = 'retrying', retries = retries + 1, updated_at = NOW() WHERE ulid = $1
+SET status = 'retrying', retries = retries + 1, updated_at = NOW() WHERE ulid = $1 AND status = 'errored'
 RETURNING *;
 
+-- name: RetryTask :one
+UPDATE tasks
+SET status = 'retrying', retries = retries + 1, updated_at = NOW()
+WHERE ulid = $1 AND status IN ('errored', 'failed', 'cancelled')
+RETURNING *;
+
+-- name: ReassignTask :one
+UPDATE tasks
+SET worker = $2, status = 'retrying', updated_at = NOW() WHERE ulid = $1
+RETURNING *;
+
+-- name: MarkTimedOut :one
+UPDATE tasks
+SET status = 'retrying', stage = 'timed_out_requeued', retries = retries + 1, updated_at = NOW()
+WHERE ulid = $1 AND retries = $2 AND status IN ('new', 'processing', 'retrying')
+RETURNING *;
+
+-- name: FailTimedOut :one
+UPDATE tasks
+SET status = 'failed', error = $3, updated_at = NOW()
+WHERE ulid = $1 AND retries = $2 AND status IN ('new', 'processing', 'retrying')
+RETURNING *;
+
+-- name: CancelTask :one
+UPDATE tasks
+SET status = 'cancelled', updated_at = NOW()
+WHERE ulid = $1 AND status NOT IN ('done', 'failed', 'cancelled')
+RETURNING *;
+
+-- name: FailExhaustedTasks :execrows
+UPDATE tasks
+SET status = 'failed', updated_at = NOW()
+WHERE status = 'errored' AND retries >= @max_retries::integer;
+
 -- name: MarkFailed :one
 UPDATE tasks
-SET status = 'failed', error = $2, updated_at = NOW() WHERE ulid = $1
+SET status = 'failed', error = $2, error_class = $3, error_log = $4, updated_at = NOW() WHERE ulid = $1
 RETURNING *;
 
 -- name: MarkDone :one
 UPDATE tasks
 SET status = 'done', stage = 'done', result = $2, updated_at = NOW() WHERE ulid = $1
 RETURNING *;
+
+-- name: SetPreflight :exec
+UPDATE tasks
+SET preflight = $2, updated_at = NOW() WHERE ulid = $1;
+
+-- name: AddTaskStage :exec
+INSERT INTO task_stages (
+  ulid, stage, attempt
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (ulid, stage, attempt) DO NOTHING;
+
+-- name: GetTaskStages :many
+SELECT * FROM task_stages
+WHERE ulid = $1
+ORDER BY id;
@@ -6,22 +6,83 @@ package queue
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
+const addTaskStage = `-- name: AddTaskStage :exec
+INSERT INTO task_stages (
+  ulid, stage, attempt
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (ulid, stage, attempt) DO NOTHING
+`
+
+type AddTaskStageParams struct {
+	ULID    string
+	Stage   string
+	Attempt int32
+}
+
+func (q *Queries) AddTaskStage(ctx context.Context, arg AddTaskStageParams) error {
+	_, err := q.db.ExecContext(ctx, addTaskStage, arg.ULID, arg.Stage, arg.Attempt)
+	return err
+}
+
+const cancelTask = `-- name: CancelTask :one
+UPDATE tasks
+SET status = 'cancelled', updated_at = NOW()
+WHERE ulid = $1 AND status NOT IN ('done', 'failed', 'cancelled')
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
+`
+
+func (q *Queries) CancelTask(ctx context.Context, ulid string) (Task, error) {
+	row := q.db.QueryRowContext(ctx, cancelTask, ulid)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ULID,
+		&i.Status,
+		&i.Retries,
+		&i.Stage,
+		&i.StageProgress,
+		&i.Error,
+		&i.Worker,
+		&i.URL,
+		&i.SDHash,
+		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
+	)
+	return i, err
+}
+
 const createTask = `-- name: CreateTask :one
 INSERT INTO tasks (
-  status, ulid, worker, url, sd_hash
+  status, ulid, worker, url, sd_hash, queue, priority, ladder
 ) VALUES (
-  'new', $1, $2, $3, $4
+  'new', $1, $2, $3, $4, $5, $6, $7
 )
-RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
 `
 
 type CreateTaskParams struct {
-	ULID   string
-	Worker string
-	URL    string
-	SDHash string
+	ULID     string
+	Worker   string
+	URL      string
+	SDHash   string
+	Queue    string
+	Priority int32
+	Ladder   string
 }
 
 func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (Task, error) {
@@ -30,6 +91,9 @@ func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (Task, e
 		arg.Worker,
 		arg.URL,
 		arg.SDHash,
+		arg.Queue,
+		arg.Priority,
+		arg.Ladder,
 	)
 	var i Task
 	err := row.Scan(
@@ -46,13 +110,80 @@ func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (Task, e
 		&i.URL,
 		&i.SDHash,
 		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
+	)
+	return i, err
+}
+
+const failExhaustedTasks = `-- name: FailExhaustedTasks :execrows
+UPDATE tasks
+SET status = 'failed', updated_at = NOW()
+WHERE status = 'errored' AND retries >= $1::integer
+`
+
+func (q *Queries) FailExhaustedTasks(ctx context.Context, maxRetries int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, failExhaustedTasks, maxRetries)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const failTimedOut = `-- name: FailTimedOut :one
+UPDATE tasks
+SET status = 'failed', error = $3, updated_at = NOW()
+WHERE ulid = $1 AND retries = $2 AND status IN ('new', 'processing', 'retrying')
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
+`
+
+type FailTimedOutParams struct {
+	ULID    string
+	Retries sql.NullInt32
+	Error   sql.NullString
+}
+
+func (q *Queries) FailTimedOut(ctx context.Context, arg FailTimedOutParams) (Task, error) {
+	row := q.db.QueryRowContext(ctx, failTimedOut, arg.ULID, arg.Retries, arg.Error)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ULID,
+		&i.Status,
+		&i.Retries,
+		&i.Stage,
+		&i.StageProgress,
+		&i.Error,
+		&i.Worker,
+		&i.URL,
+		&i.SDHash,
+		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
 	)
 	return i, err
 }
 
 const getActiveTasks = `-- name: GetActiveTasks :many
-SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result FROM tasks
-WHERE status IN ('new', 'processing', 'retrying', 'errored')
+SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder FROM tasks
+WHERE status IN ('new', 'processing', 'retrying')
+ORDER BY priority DESC, created_at
 `
 
 func (q *Queries) GetActiveTasks(ctx context.Context) ([]Task, error) {
@@ -78,6 +209,15 @@ func (q *Queries) GetActiveTasks(ctx context.Context) ([]Task, error) {
 			&i.URL,
 			&i.SDHash,
 			&i.Result,
+			&i.StageSpeed,
+			&i.StageEta,
+			&i.ErrorClass,
+			&i.ErrorLog,
+			&i.Preflight,
+			&i.RetryAt,
+			&i.Queue,
+			&i.Priority,
+			&i.Ladder,
 		); err != nil {
 			return nil, err
 		}
@@ -93,8 +233,9 @@ func (q *Queries) GetActiveTasks(ctx context.Context) ([]Task, error) {
 }
 
 const getActiveTasksForWorker = `-- name: GetActiveTasksForWorker :many
-SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result FROM tasks
-WHERE status IN ('new', 'processing', 'retrying', 'errored') AND worker = $1
+SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder FROM tasks
+WHERE status IN ('new', 'processing', 'retrying') AND worker = $1
+ORDER BY priority DESC, created_at
 `
 
 func (q *Queries) GetActiveTasksForWorker(ctx context.Context, worker string) ([]Task, error) {
@@ -120,6 +261,15 @@ func (q *Queries) GetActiveTasksForWorker(ctx context.Context, worker string) ([
 			&i.URL,
 			&i.SDHash,
 			&i.Result,
+			&i.StageSpeed,
+			&i.StageEta,
+			&i.ErrorClass,
+			&i.ErrorLog,
+			&i.Preflight,
+			&i.RetryAt,
+			&i.Queue,
+			&i.Priority,
+			&i.Ladder,
 		); err != nil {
 			return nil, err
 		}
@@ -135,7 +285,7 @@ func (q *Queries) GetActiveTasksForWorker(ctx context.Context, worker string) ([
 }
 
 const getAllTasks = `-- name: GetAllTasks :many
-SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result FROM tasks
+SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder FROM tasks
 `
 
 func (q *Queries) GetAllTasks(ctx context.Context) ([]Task, error) {
@@ -161,6 +311,15 @@ func (q *Queries) GetAllTasks(ctx context.Context) ([]Task, error) {
 			&i.URL,
 			&i.SDHash,
 			&i.Result,
+			&i.StageSpeed,
+			&i.StageEta,
+			&i.ErrorClass,
+			&i.ErrorLog,
+			&i.Preflight,
+			&i.RetryAt,
+			&i.Queue,
+			&i.Priority,
+			&i.Ladder,
 		); err != nil {
 			return nil, err
 		}
@@ -176,12 +335,14 @@ func (q *Queries) GetAllTasks(ctx context.Context) ([]Task, error) {
 }
 
 const getRetriableTasks = `-- name: GetRetriableTasks :many
-SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result FROM tasks
-WHERE status = 'errored' AND retries < 10
+SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder FROM tasks
+WHERE status = 'errored' AND retries < $1::integer
+AND (retry_at IS NULL OR retry_at <= NOW())
+ORDER BY priority DESC, retry_at
 `
 
-func (q *Queries) GetRetriableTasks(ctx context.Context) ([]Task, error) {
-	rows, err := q.db.QueryContext(ctx, getRetriableTasks)
+func (q *Queries) GetRetriableTasks(ctx context.Context, maxRetries int32) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, getRetriableTasks, maxRetries)
 	if err != nil {
 		return nil, err
 	}
@@ -203,6 +364,15 @@ func (q *Queries) GetRetriableTasks(ctx context.Context) ([]Task, error) {
 			&i.URL,
 			&i.SDHash,
 			&i.Result,
+			&i.StageSpeed,
+			&i.StageEta,
+			&i.ErrorClass,
+			&i.ErrorLog,
+			&i.Preflight,
+			&i.RetryAt,
+			&i.Queue,
+			&i.Priority,
+			&i.Ladder,
 		); err != nil {
 			return nil, err
 		}
@@ -218,7 +388,7 @@ func (q *Queries) GetRetriableTasks(ctx context.Context) ([]Task, error) {
 }
 
 const getRunnableTaskByPayload = `-- name: GetRunnableTaskByPayload :one
-SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result FROM tasks
+SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder FROM tasks
 WHERE status NOT IN ('done', 'failed')
 AND url = $1 AND sd_hash = $2 LIMIT 1
 `
@@ -245,12 +415,21 @@ func (q *Queries) GetRunnableTaskByPayload(ctx context.Context, arg GetRunnableT
 		&i.URL,
 		&i.SDHash,
 		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
 	)
 	return i, err
 }
 
 const getTask = `-- name: GetTask :one
-SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result FROM tasks
+SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder FROM tasks
 WHERE ulid = $1 LIMIT 1
 `
 
@@ -271,12 +450,21 @@ func (q *Queries) GetTask(ctx context.Context, ulid string) (Task, error) {
 		&i.URL,
 		&i.SDHash,
 		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
 	)
 	return i, err
 }
 
 const getTaskBySDHash = `-- name: GetTaskBySDHash :one
-SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result FROM tasks
+SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder FROM tasks
 WHERE sd_hash = $1 LIMIT 1
 `
 
@@ -297,14 +485,129 @@ func (q *Queries) GetTaskBySDHash(ctx context.Context, sdHash string) (Task, err
 		&i.URL,
 		&i.SDHash,
 		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
 	)
 	return i, err
 }
 
+const getTaskStages = `-- name: GetTaskStages :many
+SELECT id, created_at, ulid, stage, attempt FROM task_stages
+WHERE ulid = $1
+ORDER BY id
+`
+
+func (q *Queries) GetTaskStages(ctx context.Context, ulid string) ([]TaskStage, error) {
+	rows, err := q.db.QueryContext(ctx, getTaskStages, ulid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskStage
+	for rows.Next() {
+		var i TaskStage
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.ULID,
+			&i.Stage,
+			&i.Attempt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTasks = `-- name: ListTasks :many
+SELECT id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder FROM tasks
+WHERE ($1::text = '' OR status::text = $1::text)
+AND ($2::text = '' OR worker = $2::text)
+AND created_at >= $3::timestamp AND created_at < $4::timestamp
+ORDER BY created_at DESC
+LIMIT $5::integer OFFSET $6::integer
+`
+
+type ListTasksParams struct {
+	Status        string
+	Worker        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Lim           int32
+	Off           int32
+}
+
+func (q *Queries) ListTasks(ctx context.Context, arg ListTasksParams) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, listTasks,
+		arg.Status,
+		arg.Worker,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.Lim,
+		arg.Off,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ULID,
+			&i.Status,
+			&i.Retries,
+			&i.Stage,
+			&i.StageProgress,
+			&i.Error,
+			&i.Worker,
+			&i.URL,
+			&i.SDHash,
+			&i.Result,
+			&i.StageSpeed,
+			&i.StageEta,
+			&i.ErrorClass,
+			&i.ErrorLog,
+			&i.Preflight,
+			&i.RetryAt,
+			&i.Queue,
+			&i.Priority,
+			&i.Ladder,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const markDone = `-- name: MarkDone :one
 UPDATE tasks
 SET status = 'done', stage = 'done', result = $2, updated_at = NOW() WHERE ulid = $1
-RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
 `
 
 type MarkDoneParams struct {
@@ -329,23 +632,81 @@ func (q *Queries) MarkDone(ctx context.Context, arg MarkDoneParams) (Task, error
 		&i.URL,
 		&i.SDHash,
 		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
 	)
 	return i, err
 }
 
 const markFailed = `-- name: MarkFailed :one
 UPDATE tasks
-SET status = 'failed', error = $2, updated_at = NOW() WHERE ulid = $1
-RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result
+SET status = 'failed', error = $2, error_class = $3, error_log = $4, updated_at = NOW() WHERE ulid = $1
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
 `
 
 type MarkFailedParams struct {
-	ULID  string
-	Error sql.NullString
+	ULID       string
+	Error      sql.NullString
+	ErrorClass sql.NullString
+	ErrorLog   sql.NullString
 }
 
 func (q *Queries) MarkFailed(ctx context.Context, arg MarkFailedParams) (Task, error) {
-	row := q.db.QueryRowContext(ctx, markFailed, arg.ULID, arg.Error)
+	row := q.db.QueryRowContext(ctx, markFailed,
+		arg.ULID,
+		arg.Error,
+		arg.ErrorClass,
+		arg.ErrorLog,
+	)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ULID,
+		&i.Status,
+		&i.Retries,
+		&i.Stage,
+		&i.StageProgress,
+		&i.Error,
+		&i.Worker,
+		&i.URL,
+		&i.SDHash,
+		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
+	)
+	return i, err
+}
+
+const markTimedOut = `-- name: MarkTimedOut :one
+UPDATE tasks
+SET status = 'retrying', stage = 'timed_out_requeued', retries = retries + 1, updated_at = NOW()
+WHERE ulid = $1 AND retries = $2 AND status IN ('new', 'processing', 'retrying')
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
+`
+
+type MarkTimedOutParams struct {
+	ULID    string
+	Retries sql.NullInt32
+}
+
+func (q *Queries) MarkTimedOut(ctx context.Context, arg MarkTimedOutParams) (Task, error) {
+	row := q.db.QueryRowContext(ctx, markTimedOut, arg.ULID, arg.Retries)
 	var i Task
 	err := row.Scan(
 		&i.ID,
@@ -361,14 +722,23 @@ func (q *Queries) MarkFailed(ctx context.Context, arg MarkFailedParams) (Task, e
 		&i.URL,
 		&i.SDHash,
 		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
 	)
 	return i, err
 }
 
 const markRetrying = `-- name: MarkRetrying :one
 UPDATE tasks
-SET status = 'retrying', retries = retries + 1, updated_at = NOW() WHERE ulid = $1
-RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result
+SET status = 'retrying', retries = retries + 1, updated_at = NOW() WHERE ulid = $1 AND status = 'errored'
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
 `
 
 func (q *Queries) MarkRetrying(ctx context.Context, ulid string) (Task, error) {
@@ -388,23 +758,119 @@ func (q *Queries) MarkRetrying(ctx context.Context, ulid string) (Task, error) {
 		&i.URL,
 		&i.SDHash,
 		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
+	)
+	return i, err
+}
+
+const reassignTask = `-- name: ReassignTask :one
+UPDATE tasks
+SET worker = $2, status = 'retrying', updated_at = NOW() WHERE ulid = $1
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
+`
+
+type ReassignTaskParams struct {
+	ULID   string
+	Worker string
+}
+
+func (q *Queries) ReassignTask(ctx context.Context, arg ReassignTaskParams) (Task, error) {
+	row := q.db.QueryRowContext(ctx, reassignTask, arg.ULID, arg.Worker)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ULID,
+		&i.Status,
+		&i.Retries,
+		&i.Stage,
+		&i.StageProgress,
+		&i.Error,
+		&i.Worker,
+		&i.URL,
+		&i.SDHash,
+		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
+	)
+	return i, err
+}
+
+const retryTask = `-- name: RetryTask :one
+UPDATE tasks
+SET status = 'retrying', retries = retries + 1, updated_at = NOW()
+WHERE ulid = $1 AND status IN ('errored', 'failed', 'cancelled')
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
+`
+
+func (q *Queries) RetryTask(ctx context.Context, ulid string) (Task, error) {
+	row := q.db.QueryRowContext(ctx, retryTask, ulid)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ULID,
+		&i.Status,
+		&i.Retries,
+		&i.Stage,
+		&i.StageProgress,
+		&i.Error,
+		&i.Worker,
+		&i.URL,
+		&i.SDHash,
+		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
 	)
 	return i, err
 }
 
 const setError = `-- name: SetError :one
 UPDATE tasks
-SET status = 'errored', error = $2, updated_at = NOW() WHERE ulid = $1
-RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result
+SET status = 'errored', error = $2, error_class = $3, error_log = $4, retry_at = $5, updated_at = NOW() WHERE ulid = $1
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
 `
 
 type SetErrorParams struct {
-	ULID  string
-	Error sql.NullString
+	ULID       string
+	Error      sql.NullString
+	ErrorClass sql.NullString
+	ErrorLog   sql.NullString
+	RetryAt    sql.NullTime
 }
 
 func (q *Queries) SetError(ctx context.Context, arg SetErrorParams) (Task, error) {
-	row := q.db.QueryRowContext(ctx, setError, arg.ULID, arg.Error)
+	row := q.db.QueryRowContext(ctx, setError,
+		arg.ULID,
+		arg.Error,
+		arg.ErrorClass,
+		arg.ErrorLog,
+		arg.RetryAt,
+	)
 	var i Task
 	err := row.Scan(
 		&i.ID,
@@ -420,24 +886,56 @@ func (q *Queries) SetError(ctx context.Context, arg SetErrorParams) (Task, error
 		&i.URL,
 		&i.SDHash,
 		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
 	)
 	return i, err
 }
 
+const setPreflight = `-- name: SetPreflight :exec
+UPDATE tasks
+SET preflight = $2, updated_at = NOW() WHERE ulid = $1
+`
+
+type SetPreflightParams struct {
+	ULID      string
+	Preflight sql.NullString
+}
+
+func (q *Queries) SetPreflight(ctx context.Context, arg SetPreflightParams) error {
+	_, err := q.db.ExecContext(ctx, setPreflight, arg.ULID, arg.Preflight)
+	return err
+}
+
 const setStageProgress = `-- name: SetStageProgress :one
 UPDATE tasks
-SET stage = $2, stage_progress = $3, status = 'processing', updated_at = NOW() WHERE ulid = $1
-RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result
+SET stage = $2, stage_progress = $3, stage_speed = $4, stage_eta = $5, status = 'processing', updated_at = NOW() WHERE ulid = $1
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
 `
 
 type SetStageProgressParams struct {
 	ULID          string
 	Stage         sql.NullString
 	StageProgress sql.NullInt32
+	StageSpeed    sql.NullFloat64
+	StageEta      sql.NullInt32
 }
 
 func (q *Queries) SetStageProgress(ctx context.Context, arg SetStageProgressParams) (Task, error) {
-	row := q.db.QueryRowContext(ctx, setStageProgress, arg.ULID, arg.Stage, arg.StageProgress)
+	row := q.db.QueryRowContext(ctx, setStageProgress,
+		arg.ULID,
+		arg.Stage,
+		arg.StageProgress,
+		arg.StageSpeed,
+		arg.StageEta,
+	)
 	var i Task
 	err := row.Scan(
 		&i.ID,
@@ -453,6 +951,15 @@ func (q *Queries) SetStageProgress(ctx context.Context, arg SetStageProgressPara
 		&i.URL,
 		&i.SDHash,
 		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
 	)
 	return i, err
 }
@@ -460,7 +967,7 @@ func (q *Queries) SetStageProgress(ctx context.Context, arg SetStageProgressPara
 const setStatus = `-- name: SetStatus :one
 UPDATE tasks
 SET status = $2 WHERE ulid = $1
-RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result
+RETURNING id, created_at, updated_at, ulid, status, retries, stage, stage_progress, error, worker, url, sd_hash, result, stage_speed, stage_eta, error_class, error_log, preflight, retry_at, queue, priority, ladder
 `
 
 type SetStatusParams struct {
@@ -485,6 +992,15 @@ func (q *Queries) SetStatus(ctx context.Context, arg SetStatusParams) (Task, err
 		&i.URL,
 		&i.SDHash,
 		&i.Result,
+		&i.StageSpeed,
+		&i.StageEta,
+		&i.ErrorClass,
+		&i.ErrorLog,
+		&i.Preflight,
+		&i.RetryAt,
+		&i.Queue,
+		&i.Priority,
+		&i.Ladder,
 	)
 	return i, err
 }
@@ -0,0 +1,104 @@
+package tower
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lbryio/transcoder/tower/metrics"
+)
+
+type worker struct {
+	id        string
+	capacity  int
+	available int
+	lastSeen  time.Time
+	// dead is set for workers which stopped reporting their status, they are not counted towards registry totals.
+	dead bool
+}
+
+type workerRegistry struct {
+	sync.RWMutex
+	workers   map[string]*worker
+	capacity  int
+	available int
+}
+
+func newWorkerRegistry() *workerRegistry {
+	return &workerRegistry{workers: map[string]*worker{}}
+}
+
+// update records status reported by a worker, registering it if not seen before.
+// Returns true if the worker is new or was previously marked dead.
+func (r *workerRegistry) update(wid string, capacity, available int, seen time.Time) bool {
+	r.Lock()
+	defer r.Unlock()
+	w, ok := r.workers[wid]
+	if !ok {
+		w = &worker{id: wid}
+		r.workers[wid] = w
+	}
+	revived := !ok || w.dead
+	w.capacity = capacity
+	w.available = available
+	w.lastSeen = seen
+	w.dead = false
+	r.recount()
+	return revived
+}
+
+// sweep marks workers which have not reported since `deadline` as dead and returns their IDs.
+func (r *workerRegistry) sweep(deadline time.Time) []string {
+	r.Lock()
+	defer r.Unlock()
+	dead := []string{}
+	for _, w := range r.workers {
+		if !w.dead && w.lastSeen.Before(deadline) {
+			w.dead = true
+			dead = append(dead, w.id)
+		}
+	}
+	if len(dead) > 0 {
+		metrics.RegistryDeadWorkers.Add(float64(len(dead)))
+		r.recount()
+	}
+	sort.Strings(dead)
+	return dead
+}
+
+// recount updates registry totals and their metrics, must be called with registry locked.
+func (r *workerRegistry) recount() {
+	var alive int
+	r.capacity, r.available = 0, 0
+	for _, w := range r.workers {
+		if w.dead {
+			continue
+		}
+		alive++
+		r.capacity += w.capacity
+		r.available += w.available
+	}
+	metrics.RegistryWorkers.Set(float64(alive))
+	metrics.RegistryCapacity.Set(float64(r.capacity))
+	metrics.RegistryAvailable.Set(float64(r.available))
+}
+
+// alive is true if the worker is registered and keeps reporting its status.
+func (r *workerRegistry) alive(wid string) bool {
+	r.RLock()
+	defer r.RUnlock()
+	w, ok := r.workers[wid]
+	return ok && !w.dead
+}
+
+// list returns a snapshot of registered workers ordered by id.
+func (r *workerRegistry) list() []worker {
+	r.RLock()
+	defer r.RUnlock()
+	workers := make([]worker, 0, len(r.workers))
+	for _, w := range r.workers {
+		workers = append(workers, *w)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].id < workers[j].id })
+	return workers
+}
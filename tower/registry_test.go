@@ -0,0 +1,37 @@
+package tower
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerRegistry(t *testing.T) {
+	r := newWorkerRegistry()
+	now := time.Now()
+
+	assert.True(t, r.update("worker-b", 4, 1, now))
+	assert.True(t, r.update("worker-a", 2, 2, now.Add(-time.Minute)))
+	assert.False(t, r.update("worker-b", 4, 3, now))
+	assert.Equal(t, 6, r.capacity)
+	assert.Equal(t, 5, r.available)
+
+	workers := r.list()
+	require.Len(t, workers, 2)
+	assert.Equal(t, "worker-a", workers[0].id)
+	assert.Equal(t, 3, workers[1].available)
+
+	assert.Equal(t, []string{"worker-a"}, r.sweep(now.Add(-10*time.Second)))
+	assert.Empty(t, r.sweep(now.Add(-10*time.Second)))
+	assert.False(t, r.alive("worker-a"))
+	assert.True(t, r.alive("worker-b"))
+	assert.False(t, r.alive("worker-c"))
+	assert.Equal(t, 4, r.capacity)
+	assert.Equal(t, 3, r.available)
+
+	assert.True(t, r.update("worker-a", 2, 0, now))
+	assert.True(t, r.alive("worker-a"))
+	assert.Equal(t, 6, r.capacity)
+}
@@ -0,0 +1,88 @@
+package tower
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/lbryio/transcoder/tower/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RetryPolicy defines when errored tasks are retried and when they are given up on.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after which an errored task is marked as failed.
+	MaxRetries int
+	// Backoff is the delay before the first retry, it is doubled for every next retry up to MaxBackoff.
+	Backoff, MaxBackoff time.Duration
+	// Jitter is the fraction of the delay which is randomized, 0.2 means ±20%.
+	Jitter float64
+}
+
+// DefaultRetryPolicy retries errored tasks up to 10 times, starting 30 seconds after the error and
+// waiting up to an hour between later retries.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 10,
+	Backoff:    30 * time.Second,
+	MaxBackoff: time.Hour,
+	Jitter:     0.2,
+}
+
+// exhausted is true if a task that has been retried `retries` times should not be retried anymore.
+func (p RetryPolicy) exhausted(retries int32) bool {
+	return int(retries) >= p.MaxRetries
+}
+
+// delay returns how long to wait before retrying a task that has been retried `retries` times.
+// `rnd` is a random number in [0, 1) used for jitter.
+func (p RetryPolicy) delay(retries int32, rnd float64) time.Duration {
+	d := float64(p.Backoff) * math.Pow(2, float64(retries))
+	if max := float64(p.MaxBackoff); p.MaxBackoff > 0 && d > max {
+		d = max
+	}
+	d *= 1 + p.Jitter*(2*rnd-1)
+	return time.Duration(d)
+}
+
+// nextRetry returns the time at which a task that has been retried `retries` times should be retried.
+// It is in UTC like the rest of task timestamps.
+func (p RetryPolicy) nextRetry(retries int32) time.Time {
+	return time.Now().UTC().Add(p.delay(retries, rand.Float64()))
+}
+
+// startRetryingTasks periodically picks up errored tasks which are due for a retry and hands them
+// to the next worker requesting work. Tasks out of retries are marked as failed.
+func (s *Server) startRetryingTasks() {
+	ticker := time.NewTicker(s.timings[TRequestSweep])
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.retryErroredTasks()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+func (s *Server) retryErroredTasks() {
+	tl := s.rpc.tasks
+	failed, err := tl.q.FailExhaustedTasks(context.Background(), int32(tl.retryPolicy.MaxRetries))
+	if err != nil {
+		s.log.Error("failure marking exhausted tasks as failed", "err", err)
+	} else if failed > 0 {
+		s.log.Info("tasks out of retries marked as failed", "count", failed)
+	}
+
+	retried, err := tl.loadRetriable()
+	if err != nil {
+		s.log.Error("failure loading retriable tasks", "err", err)
+	}
+	for _, at := range retried {
+		s.log.Info("retrying errored task", "tid", at.id, "wid", at.workerID, "retries", at.retries)
+		metrics.TranscodingRequestsRetries.With(prometheus.Labels{metrics.LabelWorkerName: at.workerID}).Inc()
+		go s.manageTask(at)
+		s.rpc.requeue(at)
+	}
+}
@@ -0,0 +1,25 @@
+package tower
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxRetries: 5, Backoff: 10 * time.Second, MaxBackoff: time.Minute, Jitter: 0.2}
+
+	assert.Equal(t, 10*time.Second, p.delay(0, 0.5))
+	assert.Equal(t, 20*time.Second, p.delay(1, 0.5))
+	assert.Equal(t, 40*time.Second, p.delay(2, 0.5))
+	assert.Equal(t, time.Minute, p.delay(3, 0.5))
+	assert.Equal(t, time.Minute, p.delay(100, 0.5))
+
+	assert.Equal(t, 8*time.Second, p.delay(0, 0))
+	assert.InDelta(t, float64(12*time.Second), float64(p.delay(0, 0.9999999)), float64(time.Millisecond))
+
+	assert.False(t, p.exhausted(4))
+	assert.True(t, p.exhausted(5))
+	assert.True(t, RetryPolicy{}.exhausted(0))
+}
@@ -2,13 +2,16 @@ package tower
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/lbryio/transcoder/encoder"
 	"github.com/lbryio/transcoder/manager"
 	"github.com/lbryio/transcoder/pkg/logging"
 	"github.com/lbryio/transcoder/tower/metrics"
@@ -33,7 +36,10 @@ type towerRPC struct {
 	*rpc
 	tasks      *taskList
 	retryTasks *retryTasks
-	randPool   sync.Pool
+	registry   *workerRegistry
+	// requeued tasks are handed to whichever worker requests work first.
+	requeued *taskQueue
+	randPool sync.Pool
 
 	videoManager *manager.VideoManager
 }
@@ -43,11 +49,18 @@ type workerRPC struct {
 	capacity, available int
 	capacityChan        chan int
 	sessionID           string
+	// statusInterval is how often worker status is reported to the tower, statusTTL is how long the report stays valid.
+	statusInterval, statusTTL time.Duration
+	// heartbeatInterval is how often the tower is notified about each running task.
+	heartbeatInterval time.Duration
+	// running holds cancel channels of tasks being processed by the worker, keyed by task ID.
+	running   map[string]chan struct{}
+	runningMu sync.Mutex
 }
 
 type retryTasks struct {
 	sync.RWMutex
-	workers map[string]chan *activeTask
+	workers map[string]*taskQueue
 }
 
 func newrpc(rmqAddr string, log logging.KVLogger) (*rpc, error) {
@@ -97,7 +110,9 @@ func newTowerRPC(rmqAddr string, tasks *taskList, log logging.KVLogger) (*towerR
 	t := &towerRPC{
 		rpc:        rpc,
 		tasks:      tasks,
-		retryTasks: &retryTasks{workers: map[string]chan *activeTask{}},
+		retryTasks: &retryTasks{workers: map[string]*taskQueue{}},
+		registry:   newWorkerRegistry(),
+		requeued:   newTaskQueue(),
 		randPool: sync.Pool{
 			New: func() interface{} {
 				return rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -116,9 +131,14 @@ func newWorkerRPC(rmqAddr string, log logging.KVLogger) (*workerRPC, error) {
 	if err != nil {
 		return nil, err
 	}
+	t := defaultTimings()
 	w := &workerRPC{
-		rpc:       rpc,
-		sessionID: time.Now().Format(time.RFC3339),
+		rpc:               rpc,
+		sessionID:         time.Now().Format(time.RFC3339),
+		statusInterval:    t[TWorkerStatus],
+		statusTTL:         t[TWorkerStatusTimeout],
+		heartbeatInterval: t[TRequestHeartbeat],
+		running:           map[string]chan struct{}{},
 	}
 	return w, nil
 }
@@ -144,7 +164,7 @@ func (s *rpc) startConsuming(queue string, handler rabbitmq.Handler, concurrency
 }
 
 func (s *towerRPC) declareQueues() error {
-	queues := []string{workRequestsQueue, taskStatusQueue, workerHandshakeQueue}
+	queues := []string{workRequestsQueue, taskStatusQueue, workerHandshakeQueue, workerStatusQueue}
 	for _, q := range queues {
 		if _, err := s.backCh.QueueDeclare(q, true, false, false, false, amqp.Table{}); err != nil {
 			return err
@@ -154,7 +174,7 @@ func (s *towerRPC) declareQueues() error {
 }
 
 func (s *towerRPC) deleteQueues() error {
-	queues := []string{workRequestsQueue, taskStatusQueue, workerHandshakeQueue}
+	queues := []string{workRequestsQueue, taskStatusQueue, workerHandshakeQueue, workerStatusQueue}
 	for _, q := range queues {
 		if _, err := s.backCh.QueueDelete(q, false, false, false); err != nil {
 			return err
@@ -176,7 +196,14 @@ func (s *towerRPC) getMsgMeta(d rabbitmq.Delivery) (*workerMsgMeta, error) {
 	if !ok {
 		return nil, errors.New("message type missing")
 	}
-	return &workerMsgMeta{wid: wid, tid: tid, mType: mType}, nil
+	meta := &workerMsgMeta{wid: wid, tid: tid, mType: mType, attempt: -1}
+	switch attempt := d.Headers[headerAttempt].(type) {
+	case int32:
+		meta.attempt = attempt
+	case int64:
+		meta.attempt = int32(attempt)
+	}
+	return meta, nil
 }
 
 func (s *rpc) consumeTaskStatuses(queue string, handler rabbitmq.Handler) error {
@@ -194,15 +221,21 @@ func (s *towerRPC) handleTaskStatus(at *activeTask, msgi interface{}, meta *work
 	switch meta.mType {
 	case mTypeError:
 		msg := msgi.(*MsgWorkerError)
-		ll.Info("task error received", "err", msg.Error, "fatal", msg.Fatal)
+		if msg.Class != "" {
+			// Encoder failures are retried depending on their cause.
+			msg.Fatal = !encoder.FailureClass(msg.Class).Retriable()
+		}
+		ll.Info("task error received", "err", msg.Error, "fatal", msg.Fatal, "class", msg.Class)
 		_, err := at.SetError(*msg)
 		if err != nil {
 			ll.Warn("error setting task error", "err", err)
 		}
 	case mTypeProgress:
 		msg := msgi.(*MsgWorkerProgress)
-		s.log.Debug("task progress received", "tid", at.id, "stage", msg.Stage, "percent", msg.Percent)
+		s.log.Debug("task progress received", "tid", at.id, "stage", msg.Stage, "percent", msg.Percent, "speed", msg.Speed, "eta", msg.ETA)
 		at.RecordProgress(*msg)
+	case mTypeHeartbeat:
+		at.beat()
 	case mTypeSuccess:
 		msg := msgi.(*MsgWorkerSuccess)
 		s.log.Info("task result message received", "tid", at.id)
@@ -249,6 +282,8 @@ func (s *towerRPC) startConsumingWorkRequests() (<-chan *activeTask, error) {
 			msg = &MsgWorkerProgress{}
 		case mTypeSuccess:
 			msg = &MsgWorkerSuccess{}
+		case mTypeHeartbeat:
+			msg = &MsgWorkerHeartbeat{}
 		default:
 			s.log.Error("unknown message type", "type", meta.mType)
 		}
@@ -264,6 +299,12 @@ func (s *towerRPC) startConsumingWorkRequests() (<-chan *activeTask, error) {
 			s.log.Error("no matching active task found", "tid", meta.tid, "wid", meta.wid)
 			return rabbitmq.NackDiscard
 		}
+		if !at.accepts(meta) {
+			// Attempt has timed out or the task was moved to another worker.
+			s.log.Warn("discarding message from expired task attempt",
+				"tid", meta.tid, "wid", meta.wid, "attempt", meta.attempt, "type", meta.mType)
+			return rabbitmq.NackDiscard
+		}
 		s.handleTaskStatus(at, msg, meta)
 
 		return rabbitmq.Ack
@@ -281,14 +322,8 @@ func (s *towerRPC) startConsumingWorkRequests() (<-chan *activeTask, error) {
 			return rabbitmq.NackDiscard
 		}
 		ll := s.log.With("wid", mwh.WorkerID)
+		s.registry.update(mwh.WorkerID, mwh.Capacity, mwh.Available, time.Now())
 
-		s.retryTasks.Lock()
-		retryChan, ok := s.retryTasks.workers[mwh.WorkerID]
-		if !ok {
-			retryChan = make(chan *activeTask)
-			s.retryTasks.workers[mwh.WorkerID] = retryChan
-		}
-		s.retryTasks.Unlock()
 		ll.Info("retrieving running tasks")
 
 		runningTasks, err := s.tasks.q.GetActiveTasksForWorker(context.Background(), mwh.WorkerID)
@@ -305,7 +340,23 @@ func (s *towerRPC) startConsumingWorkRequests() (<-chan *activeTask, error) {
 				ll.Error("no corresponding active task found", "db_tid", dbt.ULID, "err", err)
 				continue
 			}
-			retryChan <- at
+			s.retryTasks.push(at)
+		}
+		return rabbitmq.Ack
+	}, 1, true)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.startConsuming(workerStatusQueue, func(d rabbitmq.Delivery) rabbitmq.Action {
+		mws := MsgWorkerStatus{}
+		err := json.Unmarshal(d.Body, &mws)
+		if err != nil {
+			s.log.Warn("botched message received", "err", err)
+			return rabbitmq.NackDiscard
+		}
+		if s.registry.update(mws.WorkerID, mws.Capacity, mws.Available, time.Now()) {
+			s.log.Info("worker is up", "wid", mws.WorkerID, "capacity", mws.Capacity, "available", mws.Available)
 		}
 		return rabbitmq.Ack
 	}, 1, true)
@@ -325,25 +376,12 @@ func (s *towerRPC) startConsumingWorkRequests() (<-chan *activeTask, error) {
 
 		// Fetching an existing task that can be retried before dispatching work request to tower
 		s.retryTasks.RLock()
-		retryChan := s.retryTasks.workers[wr.WorkerID]
+		retryQueue := s.retryTasks.workers[wr.WorkerID]
 		s.retryTasks.RUnlock()
 
-		select {
-		case at := <-retryChan:
-			ll := s.log.With("wid", at.workerID, "tid", at.id)
-			if at.exPayload == nil {
-				ll.Error("empty payload for retried task", "err", err)
-				return rabbitmq.NackDiscard
-			}
-			mtt := at.exPayload
-			s.publishTask(d.ReplyTo, *mtt)
-			if err != nil {
-				ll.Error("failure publishing task", "err", err)
-				return rabbitmq.NackDiscard
-			}
-			ll.Info("re-published task", "payload", mtt)
-		default:
-			at := s.tasks.newEmptyTask(wr.WorkerID, s.generateULID())
+		at := nextTask(retryQueue, s.requeued)
+		if at == nil || !s.redispatch(d.ReplyTo, wr.WorkerID, at) {
+			at = s.tasks.newEmptyTask(wr.WorkerID, s.generateULID())
 			s.dispatchActiveTask(d.ReplyTo, activeTaskChan, at)
 		}
 
@@ -356,6 +394,129 @@ func (s *towerRPC) startConsumingWorkRequests() (<-chan *activeTask, error) {
 	return activeTaskChan, nil
 }
 
+// redispatch publishes a retried or requeued task to the worker requesting work, reassigning the task to it
+// if needed. Returns false if the task was not sent and the worker should get a new task instead.
+func (s *towerRPC) redispatch(wrkQueue, wid string, at *activeTask) bool {
+	ll := s.log.With("wid", wid, "tid", at.id)
+	if !at.dequeue() {
+		ll.Info("retried task has already been dispatched")
+		return false
+	}
+	if cur, ok := s.tasks.get(at.id); !ok || cur != at {
+		ll.Info("retried task is no longer active")
+		return false
+	}
+	if at.exPayload == nil {
+		ll.Error("empty payload for retried task")
+		return false
+	}
+	if at.workerID != wid {
+		prev := at.workerID
+		if err := at.reassign(wid); err != nil {
+			ll.Error("failure reassigning task", "err", err)
+			s.requeue(at)
+			return false
+		}
+		ll.Info("task reassigned", "previous_wid", prev)
+	}
+	mtt := *at.exPayload
+	at.Lock()
+	mtt.Attempt = at.retries
+	at.Unlock()
+	if err := s.publishTask(wrkQueue, mtt); err != nil {
+		ll.Error("failure publishing task", "err", err)
+		s.requeue(at)
+		return false
+	}
+	at.markDispatched()
+	ll.Info("re-published task", "payload", mtt)
+	return true
+}
+
+// requeue hands the task to the next worker requesting work, regardless of the worker it was assigned to.
+func (s *towerRPC) requeue(at *activeTask) {
+	if !at.enqueue() {
+		return
+	}
+	metrics.TranscodingRequestsRequeued.Inc()
+	s.requeued.push(at)
+}
+
+// cancelTask cancels the task and tells the worker it is assigned to to stop running it.
+func (s *towerRPC) cancelTask(id string) (queue.Task, error) {
+	t, err := s.tasks.cancel(id)
+	if err != nil {
+		return t, err
+	}
+	if t.Worker != "" {
+		if err := s.publishCancel(t.Worker, id); err != nil {
+			s.log.Warn("failure notifying worker of cancelled task", "tid", id, "wid", t.Worker, "err", err)
+		}
+	}
+	return t, nil
+}
+
+// requeueWorkerTasks requeues active tasks of a dead worker, including those waiting to be retried by it.
+// Current attempts of the tasks are expired so late messages from the worker are discarded.
+func (s *towerRPC) requeueWorkerTasks(wid string) (int, error) {
+	seen := map[string]bool{}
+	expireAndRequeue := func(at *activeTask) {
+		seen[at.id] = true
+		failed, err := at.expire(at.attempt(), "worker is gone")
+		if errors.Is(err, errAttemptExpired) {
+			return
+		} else if err != nil {
+			s.log.Warn("failure expiring task attempt", "tid", at.id, "wid", wid, "err", err)
+			return
+		}
+		if !failed {
+			s.requeue(at)
+		}
+	}
+	s.retryTasks.RLock()
+	retryQueue := s.retryTasks.workers[wid]
+	s.retryTasks.RUnlock()
+	if retryQueue != nil {
+		for _, at := range retryQueue.drain() {
+			at.dequeue()
+			expireAndRequeue(at)
+		}
+	}
+
+	dbTasks, err := s.tasks.q.GetActiveTasksForWorker(context.Background(), wid)
+	if err != nil && err != sql.ErrNoRows {
+		return len(seen), err
+	}
+	for _, dt := range dbTasks {
+		at, ok := s.tasks.get(dt.ULID)
+		if !ok || seen[at.id] {
+			continue
+		}
+		expireAndRequeue(at)
+	}
+	return len(seen), nil
+}
+
+// forWorker returns the queue of tasks to be retried by the worker, creating it if needed.
+func (r *retryTasks) forWorker(wid string) *taskQueue {
+	r.Lock()
+	defer r.Unlock()
+	retryQueue, ok := r.workers[wid]
+	if !ok {
+		retryQueue = newTaskQueue()
+		r.workers[wid] = retryQueue
+	}
+	return retryQueue
+}
+
+// push queues the task to be picked up with the next work request from the worker it was assigned to.
+func (r *retryTasks) push(at *activeTask) {
+	if !at.enqueue() {
+		return
+	}
+	r.forWorker(at.workerID).push(at)
+}
+
 func (s *towerRPC) dispatchActiveTask(wrkQueue string, activeTaskChan chan *activeTask, at *activeTask) {
 	activeTaskChan <- at
 	go func() {
@@ -382,10 +543,13 @@ func (s *towerRPC) dispatchActiveTask(wrkQueue string, activeTaskChan chan *acti
 				}
 
 				_, err = s.tasks.q.CreateTask(context.Background(), queue.CreateTaskParams{
-					ULID:   at.id,
-					Worker: at.workerID,
-					URL:    mtt.URL,
-					SDHash: mtt.SDHash,
+					ULID:     at.id,
+					Worker:   at.workerID,
+					URL:      mtt.URL,
+					SDHash:   mtt.SDHash,
+					Queue:    mtt.Queue,
+					Priority: mtt.Priority,
+					Ladder:   ladderName(mtt.Ladder),
 				})
 				if err != nil {
 					s.log.Error("error saving task to db", "err", err, "ulid", at.id)
@@ -400,6 +564,7 @@ func (s *towerRPC) dispatchActiveTask(wrkQueue string, activeTaskChan chan *acti
 					s.tasks.delete(at.id)
 					return
 				}
+				at.markDispatched()
 				s.log.Info("published task", "wid", at.workerID, "tid", at.id, "payload", mtt)
 				return
 			case <-at.success:
@@ -428,8 +593,29 @@ func (s *towerRPC) publishTask(wrkQueue string, mtt MsgTranscodingTask) error {
 	)
 }
 
-func (s *workerRPC) sendTaskStatus(queue, tid, mType string, message interface{}) error {
-	headers := rabbitmq.Table{headerTaskID: tid, headerWorkerID: s.id, headerMessageType: mType}
+// publishCancel tells the worker to stop running the task.
+func (s *towerRPC) publishCancel(wid, tid string) error {
+	body, err := json.Marshal(MsgTaskCancel{TaskID: tid})
+	if err != nil {
+		return err
+	}
+	return s.publisher.Publish(
+		body,
+		[]string{workerQueueName(wid)},
+		rabbitmq.WithPublishOptionsTimestamp(time.Now()),
+		rabbitmq.WithPublishOptionsContentType("application/json"),
+		rabbitmq.WithPublishOptionsExchange(workersExchange),
+		rabbitmq.WithPublishOptionsHeaders(rabbitmq.Table{headerMessageType: mTypeCancel}),
+	)
+}
+
+func (s *workerRPC) sendTaskStatus(queue string, mtt MsgTranscodingTask, mType string, message interface{}) error {
+	headers := rabbitmq.Table{
+		headerTaskID:      mtt.TaskID,
+		headerWorkerID:    s.id,
+		headerMessageType: mType,
+		headerAttempt:     mtt.Attempt,
+	}
 	ll := s.log.With("type", mType, "message", message, "headers", headers)
 	body, err := json.Marshal(message)
 	if err != nil {
@@ -452,7 +638,12 @@ func (s *workerRPC) sendTaskStatus(queue, tid, mType string, message interface{}
 	)
 }
 func (s *workerRPC) workerQueueName() string {
-	return fmt.Sprintf("worker-tasks-%v", s.id)
+	return workerQueueName(s.id)
+}
+
+// workerQueueName is the name of the queue worker `wid` receives its tasks from.
+func workerQueueName(wid string) string {
+	return fmt.Sprintf("worker-tasks-%v", wid)
 }
 
 func (s *workerRPC) sendWorkRequest() error {
@@ -492,6 +683,23 @@ func (s *workerRPC) sendWorkerHandshake() error {
 	)
 }
 
+func (s *workerRPC) sendWorkerStatus() error {
+	msg := MsgWorkerStatus{
+		WorkerID:  s.id,
+		Capacity:  s.capacity,
+		Available: s.available,
+		SessionID: s.sessionID,
+	}
+	body, _ := json.Marshal(msg)
+	return s.publisher.Publish(
+		body,
+		[]string{workerStatusQueue},
+		rabbitmq.WithPublishOptionsContentType("application/json"),
+		rabbitmq.WithPublishOptionsExpiration(strconv.FormatInt(s.statusTTL.Milliseconds(), 10)),
+		rabbitmq.WithPublishOptionsHeaders(rabbitmq.Table{headerWorkerID: s.id}),
+	)
+}
+
 func (s *workerRPC) startWorking(concurrency int) (<-chan workerTask, error) {
 	requests := make(chan workerTask)
 	s.capacity = concurrency
@@ -505,6 +713,10 @@ func (s *workerRPC) startWorking(concurrency int) (<-chan workerTask, error) {
 	// Start listening for replies to work requests
 	err = s.consumer.StartConsuming(
 		func(d rabbitmq.Delivery) rabbitmq.Action {
+			if mType, _ := d.Headers[headerMessageType].(string); mType == mTypeCancel {
+				s.cancelTask(d.Body)
+				return rabbitmq.Ack
+			}
 			var mtt MsgTranscodingTask
 			err := json.Unmarshal(d.Body, &mtt)
 			if err != nil {
@@ -518,23 +730,41 @@ func (s *workerRPC) startWorking(concurrency int) (<-chan workerTask, error) {
 				s.capacityChan <- -1
 				defer func() { s.capacityChan <- 1 }()
 				wt := createWorkerTask(mtt)
+				s.track(wt)
+				defer s.untrack(wt)
 				requests <- wt
 
+				var heartbeats <-chan time.Time
+				if s.heartbeatInterval > 0 {
+					t := time.NewTicker(s.heartbeatInterval)
+					defer t.Stop()
+					heartbeats = t.C
+				}
 				for {
 					var err error
 					select {
+					case <-heartbeats:
+						err = s.sendTaskStatus(taskStatusQueue, mtt, mTypeHeartbeat, &MsgWorkerHeartbeat{})
+						if err != nil {
+							s.log.Warn("error publishing task heartbeat", "err", err)
+						}
 					case p := <-wt.progress:
-						err = s.sendTaskStatus(taskStatusQueue, mtt.TaskID, mTypeProgress, &MsgWorkerProgress{
-							Stage:   p.Stage,
-							Percent: p.Percent,
+						err = s.sendTaskStatus(taskStatusQueue, mtt, mTypeProgress, &MsgWorkerProgress{
+							Stage:            p.Stage,
+							Percent:          p.Percent,
+							encodingProgress: p.encodingProgress,
+							Preflight:        p.Preflight,
 						})
 						if err != nil {
 							s.log.Warn("error publishing task progress", "err", err)
 						}
 					case te := <-wt.errors:
-						err = s.sendTaskStatus(taskStatusQueue, mtt.TaskID, mTypeError, &MsgWorkerError{
-							Error: te.err.Error(),
-							Fatal: te.fatal,
+						err = s.sendTaskStatus(taskStatusQueue, mtt, mTypeError, &MsgWorkerError{
+							Error:     te.err.Error(),
+							Fatal:     te.fatal,
+							Class:     string(te.class),
+							Log:       te.log,
+							Preflight: te.preflight,
 						})
 						if err != nil {
 							s.log.Error("error publishing task error", "err", err)
@@ -542,14 +772,14 @@ func (s *workerRPC) startWorking(concurrency int) (<-chan workerTask, error) {
 						return
 					case r := <-wt.result:
 						metrics.TranscodedStreamsCount.Inc()
-						err = s.sendTaskStatus(taskStatusQueue, mtt.TaskID, mTypeSuccess, &MsgWorkerSuccess{RemoteStream: r.remoteStream})
+						err = s.sendTaskStatus(taskStatusQueue, mtt, mTypeSuccess, &MsgWorkerSuccess{RemoteStream: r.remoteStream})
 						if err != nil {
 							s.log.Error("error publishing task result", "err", err)
 						}
 						return
 					case <-s.stopChan:
 						s.log.Info("worker exiting")
-						err = s.sendTaskStatus(taskStatusQueue, mtt.TaskID, mTypeError, &MsgWorkerError{Error: "worker exiting"})
+						err = s.sendTaskStatus(taskStatusQueue, mtt, mTypeError, &MsgWorkerError{Error: "worker exiting"})
 						if err != nil {
 							s.log.Warn("error while publishing exit message", "err", err)
 						}
@@ -572,8 +802,18 @@ func (s *workerRPC) startWorking(concurrency int) (<-chan workerTask, error) {
 	s.log.Info("consuming work queue", "queue", s.workerQueueName())
 
 	go func() {
+		var statusTicker <-chan time.Time
+		if s.statusInterval > 0 {
+			t := time.NewTicker(s.statusInterval)
+			defer t.Stop()
+			statusTicker = t.C
+		}
 		for {
 			select {
+			case <-statusTicker:
+				if err := s.sendWorkerStatus(); err != nil {
+					s.log.Warn("failure sending worker status", "err", err)
+				}
 			case val := <-s.capacityChan:
 				s.available += val
 				metrics.WorkerCapability.WithLabelValues(metrics.WorkerStatusAvailable).Set(float64(s.available))
@@ -598,12 +838,48 @@ func (s *workerRPC) startWorking(concurrency int) (<-chan workerTask, error) {
 	return requests, nil
 }
 
+// track registers the task as running so it can be cancelled by the tower.
+func (s *workerRPC) track(wt workerTask) {
+	s.runningMu.Lock()
+	s.running[wt.payload.TaskID] = wt.cancelled
+	s.runningMu.Unlock()
+}
+
+// untrack removes the task from running tasks unless it has been replaced by another attempt.
+func (s *workerRPC) untrack(wt workerTask) {
+	s.runningMu.Lock()
+	if s.running[wt.payload.TaskID] == wt.cancelled {
+		delete(s.running, wt.payload.TaskID)
+	}
+	s.runningMu.Unlock()
+}
+
+// cancelTask stops the running task the cancel message is for.
+func (s *workerRPC) cancelTask(body []byte) {
+	var m MsgTaskCancel
+	if err := json.Unmarshal(body, &m); err != nil {
+		s.log.Warn("botched cancel message received", "err", err)
+		return
+	}
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	cancelled, ok := s.running[m.TaskID]
+	if !ok {
+		s.log.Info("cancelled task is not running", "tid", m.TaskID)
+		return
+	}
+	s.log.Info("cancelling task", "tid", m.TaskID)
+	delete(s.running, m.TaskID)
+	close(cancelled)
+}
+
 func createWorkerTask(mtt MsgTranscodingTask) workerTask {
 	return workerTask{
-		payload:  mtt,
-		progress: make(chan taskProgress),
-		result:   make(chan taskResult),
-		errors:   make(chan taskError),
+		payload:   mtt,
+		progress:  make(chan taskProgress),
+		result:    make(chan taskResult),
+		errors:    make(chan taskError),
+		cancelled: make(chan struct{}),
 	}
 }
 
@@ -10,10 +10,12 @@ import (
 	"time"
 
 	"github.com/Pallinder/go-randomdata"
+	"github.com/lbryio/transcoder/ladder"
 	"github.com/lbryio/transcoder/pkg/logging/zapadapter"
 	"github.com/lbryio/transcoder/storage"
 	"github.com/lbryio/transcoder/tower/queue"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -77,7 +79,7 @@ func (s *rpcSuite) TestWorkRequests() {
 			// Simulate work
 			for wt := range taskChan {
 				for i := 0; i <= 10; i++ {
-					wt.progress <- taskProgress{Percent: float32(i * 10)}
+					wt.progress <- taskProgress{Percent: float32(i * 10), encodingProgress: encodingProgress{Speed: 2, ETA: 10 - i}}
 					time.Sleep(50 * time.Millisecond)
 				}
 				wt.result <- taskResult{remoteStream: &storage.RemoteStream{URL: randomdata.Alphanumeric(25), Manifest: &storage.Manifest{URL: randomdata.Alphanumeric(25)}}}
@@ -106,6 +108,7 @@ func (s *rpcSuite) TestWorkRequests() {
 					select {
 					case p := <-at.progress:
 						total += p.Percent
+						s.EqualValues(2, p.Speed)
 						t.Reset(timeout)
 					case <-ctx.Done():
 						s.FailNowf("unexpected timeout waiting for task progress", "%s timed out", at.workerID)
@@ -294,46 +297,20 @@ func (s *rpcSuite) TestRetry() {
 		}
 	}()
 
+	// Retry immediately, second attempt is the last one
+	s.tower.tasks.retryPolicy = RetryPolicy{MaxRetries: 1}
 	activeTaskChan, err := s.tower.startConsumingWorkRequests()
 	s.Require().NoError(err)
 
-	var retriedTask *activeTask
 	stopChan := make(chan struct{})
-	errors := make(chan MsgWorkerError)
-	progress := make(chan MsgWorkerProgress)
-	manageTask := func(at *activeTask) {
-		for {
-			select {
-			case progress <- <-at.progress:
-			case errors <- <-at.errors:
-				return
-			case <-at.success:
-				// s.FailNow("unexpected done signal received")
-				return
-			case <-stopChan:
-				return
-			}
-		}
-	}
-
-	wg := sync.WaitGroup{}
-	wg.Add(1)
+	defer close(stopChan)
+	at := <-activeTaskChan
+	at.SendPayload(payload)
 	go func() {
-		task := <-activeTaskChan
-		task.SendPayload(payload)
-		go manageTask(task)
 		for {
 			select {
 			case task := <-activeTaskChan:
-				if task.exPayload != nil {
-					retriedTask = task
-					wg.Done()
-					task.SendPayload(task.exPayload)
-					go manageTask(task)
-				} else {
-					task.SendPayload(&MsgTranscodingTask{SDHash: randomdata.Alphanumeric(96), URL: "lbry://what"})
-					go manageTask(task)
-				}
+				task.SendPayload(&MsgTranscodingTask{SDHash: randomdata.Alphanumeric(96), URL: "lbry://what"})
 			case <-stopChan:
 				return
 			}
@@ -342,18 +319,29 @@ func (s *rpcSuite) TestRetry() {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	select {
-	case e := <-errors:
-		s.Equal("a minor error", e.Error)
-		s.False(e.Fatal)
-	case p := <-progress:
-		s.EqualValues(10, p.Percent)
-	case <-ctx.Done():
-		s.FailNow("timed out waiting for task progress")
+firstAttempt:
+	for {
+		select {
+		case e := <-at.errors:
+			s.Equal("a minor error", e.Error)
+			s.False(e.Fatal)
+			break firstAttempt
+		case p := <-at.progress:
+			s.EqualValues(10, p.Percent)
+		case <-ctx.Done():
+			s.FailNow("timed out waiting for task error")
+		}
 	}
 
-	wg.Wait()
-	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	retried, err := s.tower.tasks.loadRetriable()
+	s.Require().NoError(err)
+	s.Require().Len(retried, 1)
+	retriedTask := retried[0]
+	s.Equal(at.id, retriedTask.id)
+	s.EqualValues(1, retriedTask.retries)
+	s.tower.requeue(retriedTask)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 taskWatch:
 	for {
@@ -374,5 +362,88 @@ taskWatch:
 	s.Require().NoError(err)
 	s.Equal("cannot proceed at all", t.Error.String)
 	s.Equal(queue.StatusFailed, t.Status)
+	s.EqualValues(1, t.Retries.Int32)
 	s.EqualValues(20, t.StageProgress.Int32)
 }
+
+func (s *rpcSuite) TestExpire() {
+	s.tower.tasks.retryPolicy = RetryPolicy{MaxRetries: 1}
+	dbt, err := s.tower.tasks.q.CreateTask(context.Background(), queue.CreateTaskParams{
+		ULID: s.tower.generateULID(), Worker: "testworker-1", URL: "lbry://what", SDHash: randomdata.Alphanumeric(96),
+	})
+	s.Require().NoError(err)
+	at := s.tower.tasks.newActiveTask(dbt.Worker, dbt.ULID, s.tower.tasks.newPayload(dbt))
+	s.tower.tasks.insert(at)
+
+	// Dead worker sweep and timeout ticker racing for the same attempt
+	failed, err := at.expire(0, "no heartbeat")
+	s.Require().NoError(err)
+	s.False(failed)
+	_, err = at.expire(0, "worker is gone")
+	s.ErrorIs(err, errAttemptExpired)
+	s.EqualValues(1, at.attempt())
+
+	failed, err = at.expire(1, "no heartbeat")
+	s.Require().NoError(err)
+	s.True(failed)
+	_, err = at.expire(1, "worker is gone")
+	s.ErrorIs(err, errAttemptExpired)
+	select {
+	case <-at.failed:
+	default:
+		s.Fail("task not marked as failed")
+	}
+	_, ok := s.tower.tasks.get(at.id)
+	s.False(ok)
+
+	dbt, err = s.tower.tasks.q.GetTask(context.Background(), at.id)
+	s.Require().NoError(err)
+	s.Equal(queue.StatusFailed, dbt.Status)
+	s.Equal("no heartbeat (out of retries)", dbt.Error.String)
+}
+
+func TestWorkerRPCCancelTask(t *testing.T) {
+	w := &workerRPC{rpc: &rpc{log: zapadapter.NewKV(nil)}, running: map[string]chan struct{}{}}
+	wt := createWorkerTask(MsgTranscodingTask{TaskID: "task-1"})
+	cancelled := func() bool {
+		select {
+		case <-wt.cancelled:
+			return true
+		default:
+			return false
+		}
+	}
+	w.track(wt)
+
+	w.cancelTask([]byte(`{"tid": "task-2"}`))
+	w.cancelTask([]byte(`botched`))
+	assert.False(t, cancelled())
+
+	w.cancelTask([]byte(`{"tid": "task-1"}`))
+	assert.True(t, cancelled())
+	// Repeated cancel messages must not close the channel again
+	w.cancelTask([]byte(`{"tid": "task-1"}`))
+	w.untrack(wt)
+	assert.Empty(t, w.running)
+}
+
+func (s *rpcSuite) TestRetryKeepsLadder() {
+	premium := ladder.Default
+	premium.Tiers = premium.Tiers[:1]
+	s.tower.tasks.ladders.Add("premium", premium)
+	dbt, err := s.tower.tasks.q.CreateTask(context.Background(), queue.CreateTaskParams{
+		ULID: s.tower.generateULID(), Worker: "testworker-1", URL: "lbry://what", SDHash: randomdata.Alphanumeric(96),
+		Ladder: "premium",
+	})
+	s.Require().NoError(err)
+	_, err = s.tower.tasks.q.MarkFailed(context.Background(), queue.MarkFailedParams{
+		ULID: dbt.ULID, Error: sql.NullString{String: "cannot proceed at all", Valid: true},
+	})
+	s.Require().NoError(err)
+
+	at, err := s.tower.tasks.retry(dbt.ULID)
+	s.Require().NoError(err)
+	s.Require().NotNil(at.exPayload.Ladder)
+	s.Equal("premium", at.exPayload.Ladder.Name)
+	s.Len(at.exPayload.Ladder.Tiers, 1)
+}
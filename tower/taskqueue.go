@@ -0,0 +1,98 @@
+package tower
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// taskQueue holds tasks waiting for a worker. Tasks with higher priority come out first,
+// tasks with the same priority come out in the order they were pushed.
+type taskQueue struct {
+	sync.Mutex
+	tasks taskHeap
+	seq   uint64
+}
+
+type queuedTask struct {
+	at       *activeTask
+	priority int32
+	seq      uint64
+}
+
+type taskHeap []queuedTask
+
+func (h taskHeap) Len() int { return len(h) }
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h taskHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *taskHeap) Push(x interface{}) { *h = append(*h, x.(queuedTask)) }
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	qt := old[n-1]
+	*h = old[:n-1]
+	return qt
+}
+
+func newTaskQueue() *taskQueue {
+	return &taskQueue{}
+}
+
+func (q *taskQueue) push(at *activeTask) {
+	q.Lock()
+	defer q.Unlock()
+	q.seq++
+	heap.Push(&q.tasks, queuedTask{at: at, priority: at.priority(), seq: q.seq})
+}
+
+// pop returns the next task or nil if the queue is empty.
+func (q *taskQueue) pop() *activeTask {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.tasks) == 0 {
+		return nil
+	}
+	return heap.Pop(&q.tasks).(queuedTask).at
+}
+
+// peek returns priority of the next task, ok is false if the queue is empty.
+func (q *taskQueue) peek() (priority int32, ok bool) {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.tasks) == 0 {
+		return 0, false
+	}
+	return q.tasks[0].priority, true
+}
+
+// drain empties the queue, returning its tasks in order.
+func (q *taskQueue) drain() []*activeTask {
+	tasks := []*activeTask{}
+	for at := q.pop(); at != nil; at = q.pop() {
+		tasks = append(tasks, at)
+	}
+	return tasks
+}
+
+// nextTask pops the highest priority task out of several queues, preferring earlier queues on ties.
+// Nil queues are skipped.
+func nextTask(queues ...*taskQueue) *activeTask {
+	var next *taskQueue
+	var top int32
+	for _, q := range queues {
+		if q == nil {
+			continue
+		}
+		if p, ok := q.peek(); ok && (next == nil || p > top) {
+			next, top = q, p
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	return next.pop()
+}
@@ -0,0 +1,45 @@
+package tower
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func queuedTasks(priorities ...int32) []*activeTask {
+	tasks := make([]*activeTask, len(priorities))
+	for i, p := range priorities {
+		tasks[i] = &activeTask{exPayload: &MsgTranscodingTask{Priority: p}}
+	}
+	return tasks
+}
+
+func TestTaskQueue(t *testing.T) {
+	q := newTaskQueue()
+	assert.Nil(t, q.pop())
+
+	tasks := queuedTasks(1, 4, 1, 2, 4)
+	for _, at := range tasks {
+		q.push(at)
+	}
+	q.push(&activeTask{})
+	for _, i := range []int{1, 4, 3, 0, 2} {
+		assert.Same(t, tasks[i], q.pop())
+	}
+	assert.Nil(t, q.pop().exPayload)
+	assert.Nil(t, q.pop())
+}
+
+func TestNextTask(t *testing.T) {
+	own, common := newTaskQueue(), newTaskQueue()
+	tasks := queuedTasks(1, 3, 3)
+	own.push(tasks[0])
+	own.push(tasks[1])
+	common.push(tasks[2])
+
+	assert.Same(t, tasks[1], nextTask(own, nil, common))
+	assert.Same(t, tasks[2], nextTask(own, nil, common))
+	assert.Same(t, tasks[0], nextTask(own, nil, common))
+	assert.Nil(t, nextTask(own, nil, common))
+	assert.Equal(t, []*activeTask{}, own.drain())
+}
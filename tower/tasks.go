@@ -3,13 +3,25 @@ package tower
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"math"
 	"sync"
+	"time"
 
+	"github.com/lbryio/transcoder/encoder"
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/lbryio/transcoder/manager"
 	"github.com/lbryio/transcoder/tower/queue"
+
+	"github.com/pkg/errors"
 )
 
+// errAttemptExpired is returned when the task attempt has already been expired or the task is no longer running.
+var errAttemptExpired = errors.New("task attempt already expired")
+
 type activeTask struct {
+	sync.Mutex
 	id        string
 	workerID  string
 	restored  bool
@@ -19,28 +31,59 @@ type activeTask struct {
 	progress  chan MsgWorkerProgress
 	errors    chan MsgWorkerError
 	success   chan MsgWorkerSuccess
-	tl        *taskList
+	cancelled chan struct{}
+	// failed is closed when the task runs out of retries on timeout.
+	failed chan struct{}
+	tl     *taskList
+	// stage is the latest stage recorded in task stage history.
+	stage RequestStage
+	// queued is set while the task is waiting in a retry queue to be picked up by a worker.
+	queued bool
+	// dispatched, updated and heartbeat are the times current attempt was sent to a worker,
+	// last reported progress and last sent any message.
+	dispatched, updated, heartbeat time.Time
+}
+
+// stageTimeouts are multiples of TRequestTimeoutBase a task may spend in a stage without reporting progress.
+var stageTimeouts = map[RequestStage]int{
+	StagePending:     5,
+	StageDownloading: 30,
+	StageEncoding:    10,
+	StageUploading:   30,
 }
 
+const (
+	defaultStageTimeout = 10
+	// heartbeatTimeout is a multiple of TRequestTimeoutBase after which a silent task is considered lost.
+	heartbeatTimeout = 2
+)
+
 type workerTask struct {
 	payload  MsgTranscodingTask
 	progress chan taskProgress
 	errors   chan taskError
 	result   chan taskResult
+	// cancelled is closed when the tower cancels the task.
+	cancelled chan struct{}
 }
 
 type taskList struct {
 	sync.RWMutex
-	active    map[string]*activeTask
-	q         *queue.Queries
-	retryChan chan *activeTask
+	active      map[string]*activeTask
+	q           *queue.Queries
+	retryChan   chan *activeTask
+	retryPolicy RetryPolicy
+	// ladders resolve ladder names stored on tasks when they are restored or retried.
+	ladders *ladder.Registry
 }
 
 func newTaskList(q *queue.Queries) (*taskList, error) {
 	tl := &taskList{
-		q:         q,
-		active:    map[string]*activeTask{},
-		retryChan: make(chan *activeTask),
+		q:           q,
+		active:      map[string]*activeTask{},
+		retryChan:   make(chan *activeTask),
+		retryPolicy: DefaultRetryPolicy,
+		ladders:     ladder.NewRegistry(),
 	}
 	return tl, nil
 }
@@ -53,8 +96,11 @@ func (t *taskList) restore() (<-chan *activeTask, error) {
 	}
 	restored := []*activeTask{}
 	for _, dt := range dbt {
-		at := t.newActiveTask(dt.Worker, dt.ULID, &MsgTranscodingTask{SDHash: dt.SDHash, URL: dt.URL})
+		at := t.newActiveTask(dt.Worker, dt.ULID, t.newPayload(dt))
 		at.restored = true
+		at.retries = dt.Retries.Int32
+		// Worker gets the time limit of the current stage to report back before the task is requeued.
+		at.dispatched = time.Now()
 		at.tl.insert(at)
 		restored = append(restored, at)
 	}
@@ -67,32 +113,42 @@ func (t *taskList) restore() (<-chan *activeTask, error) {
 	return restoreChan, nil
 }
 
-func (t *taskList) loadRetriable(taskChan chan<- *activeTask) error {
-	dbTasks, err := t.q.GetRetriableTasks(context.Background())
+// loadRetriable marks errored tasks which are due for a retry as retrying and moves them back into active tasks.
+// Returned tasks are not dispatched to any worker yet.
+func (t *taskList) loadRetriable() ([]*activeTask, error) {
+	dbTasks, err := t.q.GetRetriableTasks(context.Background(), int32(t.retryPolicy.MaxRetries))
 	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-	for _, dt := range dbTasks {
-		at := t.newActiveTask(dt.Worker, dt.ULID, &MsgTranscodingTask{SDHash: dt.SDHash, URL: dt.URL})
-		at.retries = dt.Retries.Int32 + 1
-		at.tl.insert(at)
-		taskChan <- at
+		return nil, err
 	}
+	retried := []*activeTask{}
 	for _, dt := range dbTasks {
-		t.q.MarkRetrying(context.Background(), dt.ULID)
+		dt, err = t.q.MarkRetrying(context.Background(), dt.ULID)
+		if err == sql.ErrNoRows {
+			// Task has been retried or cancelled in the meantime.
+			continue
+		} else if err != nil {
+			return retried, err
+		}
+		at := t.newActiveTask(dt.Worker, dt.ULID, t.newPayload(dt))
+		at.restored = true
+		at.retries = dt.Retries.Int32
+		t.insert(at)
+		retried = append(retried, at)
 	}
-	return nil
+	return retried, nil
 }
 
 func (t *taskList) newEmptyTask(wid, ulid string) *activeTask {
 	at := &activeTask{
-		workerID: wid,
-		id:       ulid,
-		payload:  make(chan MsgTranscodingTask),
-		progress: make(chan MsgWorkerProgress),
-		errors:   make(chan MsgWorkerError),
-		success:  make(chan MsgWorkerSuccess),
-		tl:       t,
+		workerID:  wid,
+		id:        ulid,
+		payload:   make(chan MsgTranscodingTask),
+		progress:  make(chan MsgWorkerProgress),
+		errors:    make(chan MsgWorkerError),
+		success:   make(chan MsgWorkerSuccess),
+		cancelled: make(chan struct{}),
+		failed:    make(chan struct{}),
+		tl:        t,
 	}
 	return at
 }
@@ -106,6 +162,8 @@ func (t *taskList) newActiveTask(wid, ulid string, exPayload *MsgTranscodingTask
 		progress:  make(chan MsgWorkerProgress),
 		errors:    make(chan MsgWorkerError),
 		success:   make(chan MsgWorkerSuccess),
+		cancelled: make(chan struct{}),
+		failed:    make(chan struct{}),
 		tl:        t,
 	}
 	if exPayload != nil {
@@ -114,6 +172,24 @@ func (t *taskList) newActiveTask(wid, ulid string, exPayload *MsgTranscodingTask
 	return at
 }
 
+// newPayload recreates the payload of a task stored in the database, along with the ladder selected for it.
+// Tasks whose ladder is no longer registered are left for the worker to encode with its default ladder.
+func (t *taskList) newPayload(dt queue.Task) *MsgTranscodingTask {
+	mtt := &MsgTranscodingTask{SDHash: dt.SDHash, URL: dt.URL, Queue: dt.Queue, Priority: dt.Priority}
+	if l, ok := t.ladders.Get(dt.Ladder); ok {
+		mtt.Ladder = &l
+	}
+	return mtt
+}
+
+// ladderName returns the name of the ladder or an empty string for tasks without one.
+func ladderName(l *ladder.Ladder) string {
+	if l == nil {
+		return ""
+	}
+	return l.Name
+}
+
 func (t *taskList) insert(at *activeTask) {
 	t.Lock()
 	t.active[at.id] = at
@@ -133,17 +209,214 @@ func (t *taskList) get(ref string) (*activeTask, bool) {
 	return at, ok
 }
 
+// retry moves a task which has errored, failed or was cancelled back into active tasks.
+// Returned task is not dispatched to any worker yet.
+func (t *taskList) retry(id string) (*activeTask, error) {
+	dbt, err := t.q.RetryTask(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	at := t.newActiveTask(dbt.Worker, dbt.ULID, t.newPayload(dbt))
+	at.restored = true
+	at.retries = dbt.Retries.Int32
+	t.insert(at)
+	return at, nil
+}
+
+// cancel marks a task as cancelled and removes it from active tasks. Further status messages from the worker
+// running the task are discarded as they no longer match any active task, see towerRPC.cancelTask for stopping the worker.
+func (t *taskList) cancel(id string) (queue.Task, error) {
+	dbt, err := t.q.CancelTask(context.Background(), id)
+	if err != nil {
+		return dbt, err
+	}
+	if at, ok := t.get(id); ok {
+		t.delete(id)
+		close(at.cancelled)
+	}
+	return dbt, nil
+}
+
+// progress reports transcoding progress of the task for the stream, see manager.ProgressSource.
+func (t *taskList) progress(sdHash string) (manager.TranscodingProgress, bool) {
+	dbt, err := t.q.GetTaskBySDHash(context.Background(), sdHash)
+	if err != nil {
+		return manager.TranscodingProgress{}, false
+	}
+	switch dbt.Status {
+	case queue.StatusNew, queue.StatusProcessing, queue.StatusRetrying:
+	default:
+		return manager.TranscodingProgress{}, false
+	}
+	return manager.TranscodingProgress{
+		Progress: int(dbt.StageProgress.Int32),
+		Speed:    dbt.StageSpeed.Float64,
+		ETA:      int(dbt.StageEta.Int32),
+		Started:  &dbt.CreatedAt,
+	}, true
+}
+
+// reassign moves the task to another worker.
+func (at *activeTask) reassign(wid string) error {
+	_, err := at.tl.q.ReassignTask(context.Background(), queue.ReassignTaskParams{ULID: at.id, Worker: wid})
+	if err != nil {
+		return err
+	}
+	at.Lock()
+	at.workerID = wid
+	at.Unlock()
+	return nil
+}
+
+// priority returns the priority of task payload, tasks without payload have the lowest priority.
+func (at *activeTask) priority() int32 {
+	if at.exPayload == nil {
+		return 0
+	}
+	return at.exPayload.Priority
+}
+
+// enqueue marks the task as waiting for a worker. Returns false if it is already waiting.
+func (at *activeTask) enqueue() bool {
+	at.Lock()
+	defer at.Unlock()
+	if at.queued {
+		return false
+	}
+	at.queued = true
+	return true
+}
+
+// dequeue clears the waiting mark. Returns false if the task was not waiting, meaning it has been
+// dispatched or requeued elsewhere already.
+func (at *activeTask) dequeue() bool {
+	at.Lock()
+	defer at.Unlock()
+	queued := at.queued
+	at.queued = false
+	return queued
+}
+
+// markDispatched starts timing the current attempt.
+func (at *activeTask) markDispatched() {
+	at.Lock()
+	at.dispatched = time.Now()
+	at.updated, at.heartbeat = time.Time{}, time.Time{}
+	at.Unlock()
+}
+
+// beat records a sign of life from the worker running the task.
+func (at *activeTask) beat() {
+	at.Lock()
+	at.heartbeat = time.Now()
+	at.Unlock()
+}
+
+// accepts is true if the message comes from the worker running the current attempt of the task.
+// Messages from workers not reporting attempts are matched by worker only.
+func (at *activeTask) accepts(meta *workerMsgMeta) bool {
+	at.Lock()
+	defer at.Unlock()
+	return meta.wid == at.workerID && (meta.attempt < 0 || meta.attempt == at.retries)
+}
+
+// timedOut returns the reason the current attempt is considered lost or an empty string if it is not.
+// Limits are multiples of `base`, see stageTimeouts.
+func (at *activeTask) timedOut(base time.Duration, now time.Time) string {
+	at.Lock()
+	defer at.Unlock()
+	if at.queued || at.dispatched.IsZero() {
+		return ""
+	}
+	stage := at.stage
+	if stage == "" {
+		stage = StagePending
+	}
+	limit, ok := stageTimeouts[stage]
+	if !ok {
+		limit = defaultStageTimeout
+	}
+	if d := now.Sub(latest(at.dispatched, at.updated)); d > time.Duration(limit)*base {
+		return fmt.Sprintf("no progress in %v stage for %v", stage, d.Round(time.Second))
+	}
+	if d := now.Sub(latest(at.dispatched, at.heartbeat)); d > heartbeatTimeout*base {
+		return fmt.Sprintf("no heartbeat for %v", d.Round(time.Second))
+	}
+	return ""
+}
+
+// attempt returns the number of the current task attempt.
+func (at *activeTask) attempt() int32 {
+	at.Lock()
+	defer at.Unlock()
+	return at.retries
+}
+
+// expire ends the attempt so the task can be requeued. Status messages from the attempt are rejected after that.
+// Only the first call for an attempt succeeds, later ones get errAttemptExpired.
+// If the task is out of retries, it is marked as failed and removed from active tasks instead, `failed` is true then.
+func (at *activeTask) expire(attempt int32, reason string) (failed bool, err error) {
+	if at.attempt() != attempt {
+		return false, errAttemptExpired
+	}
+	retries := sql.NullInt32{Int32: attempt, Valid: true}
+	if at.tl.retryPolicy.exhausted(attempt) {
+		_, err := at.tl.q.FailTimedOut(context.Background(), queue.FailTimedOutParams{
+			ULID:    at.id,
+			Retries: retries,
+			Error:   sql.NullString{String: fmt.Sprintf("%v (out of retries)", reason), Valid: true},
+		})
+		if err == sql.ErrNoRows {
+			return false, errAttemptExpired
+		} else if err != nil {
+			return false, err
+		}
+		at.tl.delete(at.id)
+		close(at.failed)
+		return true, at.recordStage(StageFailed, attempt)
+	}
+	t, err := at.tl.q.MarkTimedOut(context.Background(), queue.MarkTimedOutParams{ULID: at.id, Retries: retries})
+	if err == sql.ErrNoRows {
+		return false, errAttemptExpired
+	} else if err != nil {
+		return false, err
+	}
+	if err := at.recordStage(StageTimedOutRequeued, attempt); err != nil {
+		return false, err
+	}
+	at.Lock()
+	at.retries = t.Retries.Int32
+	at.stage = ""
+	at.dispatched = time.Time{}
+	at.Unlock()
+	return false, nil
+}
+
 func (at *activeTask) SendPayload(mtt *MsgTranscodingTask) {
 	mtt.TaskID = at.id
 	at.payload <- *mtt
 }
 
 func (at *activeTask) RecordProgress(m MsgWorkerProgress) (queue.Task, error) {
+	at.Lock()
+	at.updated = time.Now()
+	at.heartbeat = at.updated
+	at.Unlock()
+	if m.Preflight != nil {
+		if err := at.SetPreflight(m.Preflight); err != nil {
+			return queue.Task{}, err
+		}
+	}
 	t, err := at.tl.q.SetStageProgress(context.Background(), queue.SetStageProgressParams{
 		ULID:          at.id,
 		Stage:         sql.NullString{String: string(m.Stage), Valid: true},
 		StageProgress: sql.NullInt32{Int32: int32(math.Ceil(float64(m.Percent))), Valid: true},
+		StageSpeed:    sql.NullFloat64{Float64: m.Speed, Valid: m.Speed > 0},
+		StageEta:      sql.NullInt32{Int32: int32(m.ETA), Valid: m.ETA > 0},
 	})
+	if err == nil {
+		err = at.recordStage(m.Stage, t.Retries.Int32)
+	}
 	select {
 	case at.progress <- m:
 	default:
@@ -154,15 +427,29 @@ func (at *activeTask) RecordProgress(m MsgWorkerProgress) (queue.Task, error) {
 func (at *activeTask) SetError(m MsgWorkerError) (queue.Task, error) {
 	var t queue.Task
 	var err error
+	if m.Preflight != nil {
+		if err := at.SetPreflight(m.Preflight); err != nil {
+			return t, err
+		}
+	}
+	if !m.Fatal && at.tl.retryPolicy.exhausted(at.retries) {
+		m.Fatal = true
+		m.Error = fmt.Sprintf("%v (out of retries)", m.Error)
+	}
 	if m.Fatal {
 		t, err = at.tl.q.MarkFailed(context.Background(), queue.MarkFailedParams{
-			ULID:  at.id,
-			Error: sql.NullString{String: m.Error, Valid: true},
+			ULID:       at.id,
+			Error:      sql.NullString{String: m.Error, Valid: true},
+			ErrorClass: sql.NullString{String: m.Class, Valid: m.Class != ""},
+			ErrorLog:   sql.NullString{String: m.Log, Valid: m.Log != ""},
 		})
 	} else {
 		t, err = at.tl.q.SetError(context.Background(), queue.SetErrorParams{
-			ULID:  at.id,
-			Error: sql.NullString{String: m.Error, Valid: true},
+			ULID:       at.id,
+			Error:      sql.NullString{String: m.Error, Valid: true},
+			ErrorClass: sql.NullString{String: m.Class, Valid: m.Class != ""},
+			ErrorLog:   sql.NullString{String: m.Log, Valid: m.Log != ""},
+			RetryAt:    sql.NullTime{Time: at.tl.retryPolicy.nextRetry(at.retries), Valid: true},
 		})
 	}
 	if err != nil {
@@ -176,14 +463,52 @@ func (at *activeTask) SetError(m MsgWorkerError) (queue.Task, error) {
 	return t, err
 }
 
+// SetPreflight stores input preflight report on the task.
+func (at *activeTask) SetPreflight(r *encoder.PreflightReport) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return at.tl.q.SetPreflight(context.Background(), queue.SetPreflightParams{
+		ULID:      at.id,
+		Preflight: sql.NullString{String: string(data), Valid: true},
+	})
+}
+
 func (at *activeTask) MarkDone(m MsgWorkerSuccess) (queue.Task, error) {
 	t, err := at.tl.q.MarkDone(context.Background(), queue.MarkDoneParams{
 		ULID:   at.id,
 		Result: sql.NullString{String: m.RemoteStream.URL, Valid: true},
 	})
+	if err == nil {
+		err = at.recordStage(StageDone, t.Retries.Int32)
+	}
 	select {
 	case at.success <- m:
 	default:
 	}
 	return t, err
 }
+
+// recordStage adds the stage to task stage history when the task enters it.
+func (at *activeTask) recordStage(stage RequestStage, attempt int32) error {
+	at.Lock()
+	if at.stage == stage {
+		at.Unlock()
+		return nil
+	}
+	at.stage = stage
+	at.Unlock()
+	return at.tl.q.AddTaskStage(context.Background(), queue.AddTaskStageParams{
+		ULID:    at.id,
+		Stage:   string(stage),
+		Attempt: attempt,
+	})
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
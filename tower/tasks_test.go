@@ -0,0 +1,67 @@
+package tower
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lbryio/transcoder/ladder"
+	"github.com/lbryio/transcoder/tower/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveTaskTimedOut(t *testing.T) {
+	base := time.Minute
+	now := time.Now()
+	testCases := []struct {
+		name    string
+		task    *activeTask
+		timeout bool
+	}{
+		{"not dispatched", &activeTask{}, false},
+		{"queued", &activeTask{queued: true, dispatched: now.Add(-time.Hour)}, false},
+		{"just dispatched", &activeTask{dispatched: now.Add(-time.Minute)}, false},
+		{"never picked up", &activeTask{dispatched: now.Add(-6 * time.Minute)}, true},
+		{"downloading", &activeTask{stage: StageDownloading, dispatched: now.Add(-20 * time.Minute), heartbeat: now}, false},
+		{"stuck encoding", &activeTask{
+			stage: StageEncoding, dispatched: now.Add(-time.Hour), updated: now.Add(-11 * time.Minute), heartbeat: now}, true},
+		{"encoding", &activeTask{
+			stage: StageEncoding, dispatched: now.Add(-time.Hour), updated: now.Add(-time.Minute), heartbeat: now}, false},
+		{"no heartbeat", &activeTask{
+			stage: StageEncoding, dispatched: now.Add(-time.Hour), updated: now.Add(-time.Minute), heartbeat: now.Add(-3 * time.Minute)}, true},
+		{"unknown stage", &activeTask{stage: StageMetadataFill, dispatched: now.Add(-11 * time.Minute), heartbeat: now}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason := tc.task.timedOut(base, now)
+			assert.Equal(t, tc.timeout, reason != "", reason)
+		})
+	}
+}
+
+func TestActiveTaskAccepts(t *testing.T) {
+	at := &activeTask{workerID: "worker-2", retries: 3}
+	assert.True(t, at.accepts(&workerMsgMeta{wid: "worker-2", attempt: 3}))
+	assert.True(t, at.accepts(&workerMsgMeta{wid: "worker-2", attempt: -1}))
+	assert.False(t, at.accepts(&workerMsgMeta{wid: "worker-2", attempt: 2}))
+	assert.False(t, at.accepts(&workerMsgMeta{wid: "worker-1", attempt: 3}))
+	assert.False(t, at.accepts(&workerMsgMeta{wid: "worker-1", attempt: -1}))
+}
+
+func TestTaskListNewPayload(t *testing.T) {
+	premium := ladder.Default
+	premium.Tiers = premium.Tiers[:1]
+	tl, err := newTaskList(nil)
+	assert.NoError(t, err)
+	tl.ladders.Add("premium", premium)
+
+	mtt := tl.newPayload(queue.Task{SDHash: "abc", URL: "lbry://what", Queue: "priority", Priority: 4, Ladder: "premium"})
+	if assert.NotNil(t, mtt.Ladder) {
+		assert.Equal(t, "premium", mtt.Ladder.Name)
+		assert.Len(t, mtt.Ladder.Tiers, 1)
+	}
+	assert.Equal(t, "priority", mtt.Queue)
+	assert.EqualValues(t, 4, mtt.Priority)
+
+	assert.Nil(t, tl.newPayload(queue.Task{SDHash: "abc", Ladder: "removed"}).Ladder)
+	assert.Nil(t, tl.newPayload(queue.Task{SDHash: "abc"}).Ladder)
+}
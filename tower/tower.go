@@ -7,10 +7,10 @@ import (
 	"fmt"
 	"path"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/fasthttp/router"
+	"github.com/lbryio/transcoder/ladder"
 	"github.com/lbryio/transcoder/manager"
 	"github.com/lbryio/transcoder/pkg/logging"
 	"github.com/lbryio/transcoder/tower/metrics"
@@ -39,9 +39,12 @@ type ServerConfig struct {
 	workDir, workDirUploads string
 	httpServerBind          string
 	httpServerURL           string
+	adminToken              string
 	log                     logging.KVLogger
 	videoManager            *manager.VideoManager
+	ladders                 *ladder.Registry
 	timings                 map[string]time.Duration
+	retryPolicy             RetryPolicy
 	state                   *State
 	devMode                 bool
 }
@@ -57,20 +60,6 @@ type Server struct {
 	backCh *amqp.Channel
 }
 
-type worker struct {
-	id        string
-	capacity  int
-	available int
-	lastSeen  time.Time
-}
-
-type workerRegistry struct {
-	sync.RWMutex
-	workers   map[string]*worker
-	capacity  int
-	available int
-}
-
 type Timings map[string]time.Duration
 
 func DefaultServerConfig() *ServerConfig {
@@ -80,6 +69,8 @@ func DefaultServerConfig() *ServerConfig {
 		httpServerBind: ":18080",
 		log:            logging.NoopKVLogger{},
 		timings:        defaultTimings(),
+		retryPolicy:    DefaultRetryPolicy,
+		ladders:        ladder.NewRegistry(),
 	}
 }
 
@@ -95,6 +86,12 @@ func (c *ServerConfig) Timings(t Timings) *ServerConfig {
 	return c
 }
 
+// RetryPolicy configures how errored tasks are retried, see RetryPolicy.
+func (c *ServerConfig) RetryPolicy(p RetryPolicy) *ServerConfig {
+	c.retryPolicy = p
+	return c
+}
+
 func (c *ServerConfig) HttpServer(bind, url string) *ServerConfig {
 	c.httpServerBind = bind
 	if !strings.HasSuffix(url, "/") {
@@ -104,11 +101,24 @@ func (c *ServerConfig) HttpServer(bind, url string) *ServerConfig {
 	return c
 }
 
+// AdminToken enables admin API, requests to it must carry the token as `Authorization: Bearer <token>` header.
+func (c *ServerConfig) AdminToken(token string) *ServerConfig {
+	c.adminToken = token
+	return c
+}
+
 func (c *ServerConfig) VideoManager(manager *manager.VideoManager) *ServerConfig {
 	c.videoManager = manager
 	return c
 }
 
+// Ladders configures named ladders which are selected for transcoding tasks based on their channel
+// or the manager queue they came from. Only the default ladder is used if not set.
+func (c *ServerConfig) Ladders(r *ladder.Registry) *ServerConfig {
+	c.ladders = r
+	return c
+}
+
 func (c *ServerConfig) WorkDir(workDir string) *ServerConfig {
 	c.workDir = workDir
 	return c
@@ -139,7 +149,6 @@ func NewServer(config *ServerConfig) (*Server, error) {
 
 	s := Server{
 		ServerConfig: config,
-		registry:     &workerRegistry{workers: map[string]*worker{}},
 		stopChan:     make(chan struct{}),
 	}
 
@@ -152,11 +161,16 @@ func NewServer(config *ServerConfig) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	tl.retryPolicy = config.retryPolicy
+	if config.ladders != nil {
+		tl.ladders = config.ladders
+	}
 	s.rpc, err = newTowerRPC(s.rmqAddr, tl, s.log)
 	if err != nil {
 		return nil, err
 	}
 	s.rpc.videoManager = s.videoManager
+	s.registry = s.rpc.registry
 
 	return &s, nil
 }
@@ -167,8 +181,10 @@ func (s *Server) StartAll() error {
 	}
 
 	s.rpc.declareQueues()
+	s.videoManager.SetProgressSource(s.rpc.tasks.progress)
 
-	// go s.startWatchingWorkerStatus()
+	go s.startWatchingWorkerStatus()
+	go s.startRetryingTasks()
 	if err := s.startForwardingRequests(s.videoManager.Requests()); err != nil {
 		return err
 	}
@@ -202,9 +218,13 @@ func (s *Server) startForwardingRequests(requests <-chan *manager.TranscodingReq
 					var mtt *MsgTranscodingTask
 					for {
 						trReq := <-requests
+						l := s.ladders.Select(trReq.ChannelURI, trReq.Queue)
 						mtt = &MsgTranscodingTask{
-							URL:    trReq.URI,
-							SDHash: trReq.SDHash,
+							URL:      trReq.URI,
+							SDHash:   trReq.SDHash,
+							Ladder:   &l,
+							Queue:    trReq.Queue,
+							Priority: s.videoManager.Pool().Priority(trReq.Queue),
 						}
 						_, err = s.rpc.tasks.q.GetTaskBySDHash(context.Background(), mtt.SDHash)
 						if err != nil {
@@ -237,10 +257,33 @@ func (s *Server) manageTask(at *activeTask) {
 	metrics.TranscodingRequestsRunning.With(labels).Inc()
 	defer metrics.TranscodingRequestsRunning.With(labels).Dec()
 	ll.Info("managing task", "restored", at.restored)
+	timeoutTicker := time.NewTicker(s.timings[TRequestSweep])
+	defer timeoutTicker.Stop()
 	for {
 		select {
+		case <-timeoutTicker.C:
+			attempt := at.attempt()
+			reason := at.timedOut(s.timings[TRequestTimeoutBase], time.Now())
+			if reason == "" {
+				continue
+			}
+			ll.Warn("task timed out", "reason", reason, "attempt", attempt)
+			metrics.TranscodingRequestsTimeouts.With(labels).Inc()
+			failed, err := at.expire(attempt, reason)
+			if errors.Is(err, errAttemptExpired) {
+				continue
+			} else if err != nil {
+				ll.Error("failure expiring task attempt", "err", err)
+				continue
+			}
+			if failed {
+				ll.Error("task out of retries, marked as failed", "reason", reason)
+				metrics.TranscodingRequestsErrors.With(labels).Inc()
+				return
+			}
+			s.rpc.requeue(at)
 		case p := <-at.progress:
-			ll.Info("progress received", "progress", p.Percent, "stage", p.Stage)
+			ll.Info("progress received", "progress", p.Percent, "stage", p.Stage, "speed", p.Speed, "eta", p.ETA)
 		case e := <-at.errors:
 			ll.Error("task errored", "err", e)
 			metrics.TranscodingRequestsErrors.With(labels).Inc()
@@ -261,6 +304,46 @@ func (s *Server) manageTask(at *activeTask) {
 			ll.Info("added remote stream", "url", d.RemoteStream.URL)
 			metrics.TranscodingRequestsDone.With(labels).Inc()
 			return
+		case <-at.cancelled:
+			ll.Info("task cancelled")
+			return
+		case <-at.failed:
+			ll.Error("task out of retries, marked as failed")
+			metrics.TranscodingRequestsErrors.With(labels).Inc()
+			return
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// retryTask puts an errored, failed or cancelled task back to work. Like scheduled retries, it is handed
+// to the next worker requesting work rather than the one it failed on.
+func (s *Server) retryTask(id string) (*activeTask, error) {
+	at, err := s.rpc.tasks.retry(id)
+	if err != nil {
+		return nil, err
+	}
+	go s.manageTask(at)
+	s.rpc.requeue(at)
+	return at, nil
+}
+
+// startWatchingWorkerStatus marks workers which stopped reporting their status as dead and requeues their tasks.
+func (s *Server) startWatchingWorkerStatus() {
+	timeout := s.timings[TWorkerStatusTimeout]
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, wid := range s.registry.sweep(time.Now().Add(-timeout)) {
+				n, err := s.rpc.requeueWorkerTasks(wid)
+				if err != nil {
+					s.log.Error("failure requeueing dead worker tasks", "wid", wid, "err", err)
+				}
+				s.log.Warn("worker stopped reporting status, marked dead", "wid", wid, "requeued", n)
+			}
 		case <-s.stopChan:
 			return
 		}
@@ -277,6 +360,12 @@ func (s *Server) startHttpServer() error {
 
 	router.GET("/debug/pprof/{profile:*}", pprofhandler.PprofHandler)
 
+	if s.adminToken != "" {
+		s.attachAdminHandler(router)
+	} else {
+		s.log.Warn("admin token is not set, admin api disabled")
+	}
+
 	s.log.Info("starting tower http server", "addr", s.httpServerBind, "url", s.httpServerURL)
 	// TODO: Cleanup middleware attachment.
 	httpServer := &fasthttp.Server{
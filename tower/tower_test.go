@@ -125,3 +125,23 @@ func (s *towerSuite) TestSuccess() {
 	_, err = s.s3drv.GetFragment(v.RemotePath, storage.MasterPlaylistName)
 	s.NoError(err, "remote path does not exist: %s/%s", v.RemotePath, storage.MasterPlaylistName)
 }
+
+func (s *towerSuite) TestWorkerCancelTask() {
+	wrk, err := NewWorker(DefaultWorkerConfig().
+		S3Driver(s.s3drv).
+		PoolSize(1).
+		WorkDir(s.T().TempDir()).
+		Logger(zapadapter.NewKV(nil)),
+	)
+	s.Require().NoError(err)
+	defer wrk.rpc.Stop()
+
+	wt := createWorkerTask(MsgTranscodingTask{TaskID: "task-1"})
+	wrk.rpc.track(wt)
+	wrk.rpc.cancelTask([]byte(`{"tid": "task-1"}`))
+	select {
+	case <-wt.cancelled:
+	default:
+		s.Fail("task not cancelled")
+	}
+}
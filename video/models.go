@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/lbryio/transcoder/ladder"
 	"github.com/lbryio/transcoder/storage"
 )
 
@@ -26,10 +27,40 @@ type Video struct {
 // GetLocation returns a video location suitable for using in HTTP redirect response.
 // Bool in return value signifies if it's a remote location (S3) or local (relative HTTP path).
 func (v Video) GetLocation() (string, bool) {
+	return v.GetFileLocation(v.entryPoint())
+}
+
+// GetTypeLocation returns the location of the stream entry point for `streamType`
+// (ladder.TypeHLS or ladder.TypeDASH), in the same form as GetLocation.
+// ok is false if the video is not packaged for that stream type.
+func (v Video) GetTypeLocation(streamType string) (location string, remote, ok bool) {
+	var name string
+	switch {
+	case streamType == ladder.TypeDASH && (v.Type == ladder.TypeDASH || v.Type == ladder.TypeCMAF):
+		name = storage.DASHManifestName
+	case streamType == ladder.TypeHLS && v.Type != ladder.TypeDASH:
+		name = storage.MasterPlaylistName
+	default:
+		return "", false, false
+	}
+	location, remote = v.GetFileLocation(name)
+	return location, remote, true
+}
+
+// GetFileLocation returns location of an arbitrary stream file, in the same form as GetLocation.
+func (v Video) GetFileLocation(name string) (string, bool) {
 	if v.Path != "" {
-		return fmt.Sprintf("%v/%v", v.Path, storage.MasterPlaylistName), false
+		return fmt.Sprintf("%v/%v", v.Path, name), false
+	}
+	return fmt.Sprintf("remote://%v/%v", v.RemotePath, name), true
+}
+
+// entryPoint returns the name of the file players should start playback from.
+func (v Video) entryPoint() string {
+	if v.Type == ladder.TypeDASH {
+		return storage.DASHManifestName
 	}
-	return fmt.Sprintf("remote://%v/%v", v.RemotePath, storage.MasterPlaylistName), true
+	return storage.MasterPlaylistName
 }
 
 func (v Video) GetSize() int64 {
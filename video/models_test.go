@@ -3,6 +3,7 @@ package video
 import (
 	"testing"
 
+	"github.com/lbryio/transcoder/ladder"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,4 +26,34 @@ func TestVideo(t *testing.T) {
 	url, remote = v.GetLocation()
 	assert.True(t, remote)
 	assert.Equal(t, "remote://ashsadasldkhaw/master.m3u8", url)
+
+	url, remote = v.GetFileLocation("poster.jpg")
+	assert.True(t, remote)
+	assert.Equal(t, "remote://ashsadasldkhaw/poster.jpg", url)
+
+	v = &Video{Path: "ashsadasldkhaw", RemotePath: "ashsadasldkhaw"}
+	url, remote = v.GetFileLocation("poster.jpg")
+	assert.False(t, remote)
+	assert.Equal(t, "ashsadasldkhaw/poster.jpg", url)
+}
+
+func TestVideoGetTypeLocation(t *testing.T) {
+	testCases := []struct {
+		videoType, kind, location string
+		ok                        bool
+	}{
+		{"", ladder.TypeHLS, "remote://abc/master.m3u8", true},
+		{"", ladder.TypeDASH, "", false},
+		{ladder.TypeDASH, ladder.TypeDASH, "remote://abc/manifest.mpd", true},
+		{ladder.TypeDASH, ladder.TypeHLS, "", false},
+		{ladder.TypeCMAF, ladder.TypeDASH, "remote://abc/manifest.mpd", true},
+		{ladder.TypeCMAF, ladder.TypeHLS, "remote://abc/master.m3u8", true},
+	}
+	for _, tc := range testCases {
+		v := Video{RemotePath: "abc", Type: tc.videoType}
+		location, remote, ok := v.GetTypeLocation(tc.kind)
+		assert.Equal(t, tc.ok, ok, "%v as %v", tc.videoType, tc.kind)
+		assert.Equal(t, tc.location, location, "%v as %v", tc.videoType, tc.kind)
+		assert.Equal(t, tc.ok, remote)
+	}
 }
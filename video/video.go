@@ -3,11 +3,15 @@ package video
 import (
 	"context"
 	"errors"
+	"io"
+	"os"
+	"path"
 	"time"
 
 	"github.com/lbryio/transcoder/db"
 	"github.com/lbryio/transcoder/ladder"
 	"github.com/lbryio/transcoder/storage"
+	"gopkg.in/yaml.v3"
 )
 
 type RemoteDriver interface {
@@ -91,7 +95,7 @@ func (q Library) AddLocalStream(url, channel string, ls storage.LocalStream) (*V
 	p := AddParams{
 		URL:      url,
 		SDHash:   ls.SDHash(),
-		Type:     ladder.TypeHLS,
+		Type:     streamType(ls.Manifest),
 		Channel:  channel,
 		Path:     ls.BasePath(),
 		Size:     ls.Size(),
@@ -114,11 +118,19 @@ func (q Library) AddRemoteStream(rs storage.RemoteStream) (*Video, error) {
 		RemotePath: rs.URL,
 		Size:       rs.Size(),
 		Checksum:   rs.Checksum(),
-		Type:       ladder.TypeHLS,
+		Type:       streamType(m),
 	}
 	return q.queries.Add(context.Background(), p)
 }
 
+// streamType determines video type from the ladder recorded in stream manifest.
+func streamType(m *storage.Manifest) string {
+	if m == nil {
+		return ladder.TypeHLS
+	}
+	return m.Ladder.StreamType()
+}
+
 func (q Library) Get(sdHash string) (*Video, error) {
 	return q.queries.Get(context.Background(), sdHash)
 }
@@ -127,6 +139,51 @@ func (q Library) Path() string {
 	return q.local.Path()
 }
 
+// Artwork holds locations of video poster image and animated preview, in the same form as Video.GetLocation returns.
+// Empty location means the file was not produced for the video.
+type Artwork struct {
+	Poster, Preview string
+	Remote          bool
+}
+
+// Artwork reads stream manifest of the video from local or remote storage and returns
+// locations of poster and preview files recorded in it.
+func (q Library) Artwork(v *Video) (*Artwork, error) {
+	m, err := q.readManifest(v)
+	if err != nil {
+		return nil, err
+	}
+	a := &Artwork{}
+	if m.Poster != "" {
+		a.Poster, a.Remote = v.GetFileLocation(m.Poster)
+	}
+	if m.Preview != "" {
+		a.Preview, a.Remote = v.GetFileLocation(m.Preview)
+	}
+	return a, nil
+}
+
+func (q Library) readManifest(v *Video) (*storage.Manifest, error) {
+	var r io.ReadCloser
+	var err error
+	if v.Path != "" {
+		r, err = os.Open(path.Join(q.local.Path(), v.Path, storage.ManifestName))
+	} else if q.remote != nil {
+		r, err = q.remote.GetFragment(v.SDHash, storage.ManifestName)
+	} else {
+		return nil, errors.New("video is not available locally and remote storage is not configured")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	m := &storage.Manifest{}
+	if err := yaml.NewDecoder(r).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (q Library) Furlough(v *Video) error {
 	ll := logger.With("sd_hash", v.SDHash)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -1,6 +1,7 @@
 package workers
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
@@ -22,8 +23,10 @@ import (
 )
 
 type encoderWorker struct {
+	ctx     context.Context
 	mgr     *manager.VideoManager
 	encoder encoder.Encoder
+	ladders *ladder.Registry
 }
 
 func (w encoderWorker) Work(t dispatcher.Task) error {
@@ -69,7 +72,7 @@ func (w encoderWorker) Work(t dispatcher.Task) error {
 		}
 	}
 
-	res, err := w.encoder.Encode(streamFH.Name(), streamPath)
+	res, err := w.encoder.EncodeWithLadder(w.ctx, streamFH.Name(), streamPath, w.ladders.Select(r.ChannelURI, r.Queue))
 	if err != nil {
 		r.Reject()
 		TranscodingErrorsCount.WithLabelValues("encode").Inc()
@@ -80,10 +83,21 @@ func (w encoderWorker) Work(t dispatcher.Task) error {
 	TranscodingRunning.Inc()
 
 	for i := range res.Progress {
-		ll.Debugw("encoding", "progress", fmt.Sprintf("%.2f", i.GetProgress()))
+		ll.Debugw("encoding", "progress", fmt.Sprintf("%.2f", i.Percent), "speed", i.Speed, "eta", i.ETA)
 	}
 
 	TranscodingRunning.Dec()
+	if err := res.Err(); err != nil {
+		if errors.Is(err, encoder.ErrCancelled) {
+			r.Release()
+			ll.Infow("transcoding request released", "reason", "encoding cancelled")
+		} else {
+			r.Reject()
+			TranscodingErrorsCount.WithLabelValues("encode").Inc()
+		}
+		cleanupLocalStream()
+		return err
+	}
 	TranscodingSpentSeconds.Add(tmr.Duration())
 
 	md, _ := strconv.ParseFloat(res.OrigMeta.FMeta.Format.Duration, 64)
@@ -95,6 +109,7 @@ func (w encoderWorker) Work(t dispatcher.Task) error {
 		"duration", res.OrigMeta.FMeta.Format.Duration,
 		"bitrate", res.OrigMeta.FMeta.Format.GetBitRate(),
 		"channel", r.ChannelURI,
+		"ladder", res.Ladder.Name,
 	)
 
 	time.Sleep(2 * time.Second)
@@ -108,7 +123,7 @@ func (w encoderWorker) Work(t dispatcher.Task) error {
 	_, err = lib.Add(video.AddParams{
 		URL:      r.URI,
 		SDHash:   r.SDHash,
-		Type:     ladder.TypeHLS,
+		Type:     res.Ladder.StreamType(),
 		Channel:  r.ChannelURI,
 		Path:     ls.BasePath(),
 		Size:     ls.Size(),
@@ -132,7 +147,8 @@ func (w encoderWorker) Work(t dispatcher.Task) error {
 	return nil
 }
 
-func SpawnEncoderWorkers(wnum int, mgr *manager.VideoManager) chan<- interface{} {
+// SpawnEncoderWorkers starts encoding requests coming from the manager, picking ladders for them from `ladders`.
+func SpawnEncoderWorkers(wnum int, mgr *manager.VideoManager, ladders *ladder.Registry) chan<- interface{} {
 	RegisterMetrics()
 
 	logger.Infof("starting %v encoders", wnum)
@@ -140,7 +156,8 @@ func SpawnEncoderWorkers(wnum int, mgr *manager.VideoManager) chan<- interface{}
 	if err != nil {
 		logger.Fatal(err)
 	}
-	worker := encoderWorker{mgr: mgr, encoder: enc}
+	ctx, cancel := context.WithCancel(context.Background())
+	worker := encoderWorker{ctx: ctx, mgr: mgr, encoder: enc, ladders: ladders}
 	d := dispatcher.Start(wnum, worker, 0)
 	stopChan := make(chan interface{})
 
@@ -155,6 +172,7 @@ func SpawnEncoderWorkers(wnum int, mgr *manager.VideoManager) chan<- interface{}
 					d.Dispatch(e)
 				}
 			case <-stopChan:
+				cancel()
 				d.Stop()
 				return
 			// case <-time.After(10 * time.Millisecond):